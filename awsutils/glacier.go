@@ -12,9 +12,9 @@ import (
 var AccountId string
 var Session *session.Session
 
-func LoadAccountSession(awsId, awsSecret string)  {
+func LoadAccountSession(awsId, awsSecret, awsProfile string)  {
 	var err error
-	Session = BuildSession(awsId, awsSecret)
+	Session = BuildSession(awsId, awsSecret, awsProfile)
 	AccountId, err = GetAccountId(Session)
 	utils.ExitIfError(err)
 }
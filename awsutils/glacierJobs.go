@@ -15,21 +15,43 @@ import (
 	"code.cloudfoundry.org/bytefmt"
 	"github.com/aws/aws-sdk-go/service/glacier/glacieriface"
 	"strings"
+	"rsg/bandwidth"
 )
 
 type jobIdsAtStartupStruct struct {
 	fileRetrievalJobIdByRangeByArchiveId map[string]map[string]string
+	completionDateByJobId                map[string]time.Time
+	creationDateByJobId                  map[string]time.Time
 	MappingInventoryJobId                string
-	MappingRetrievalJobId                string
+	mappingRetrievalJobIdByArchiveId     map[string]string
+	DataInventoryJobId                   string
 }
 
 type Archive struct {
-	ArchiveId string
-	Size      uint64
+	ArchiveId    string
+	Size         uint64
+	CreationDate string
 }
 
 var WaitTime = 5 * time.Minute
-var JobIdsAtStartup = &jobIdsAtStartupStruct{fileRetrievalJobIdByRangeByArchiveId: make(map[string]map[string]string)}
+// usual duration of a retrieval job
+const JobDuration = 4 * time.Hour
+// output of a job can be downloaded during 24 hours after its completion
+const JobOutputAvailability = 24 * time.Hour
+// Loaded in package variable because shared by all downloads of the process
+var DownloadLimiter *bandwidth.Limiter
+var JobIdsAtStartup = newJobIdsAtStartup()
+
+func newJobIdsAtStartup() *jobIdsAtStartupStruct {
+	return &jobIdsAtStartupStruct{fileRetrievalJobIdByRangeByArchiveId: make(map[string]map[string]string),
+		completionDateByJobId: make(map[string]time.Time),
+		creationDateByJobId: make(map[string]time.Time),
+		mappingRetrievalJobIdByArchiveId: make(map[string]string)}
+}
+
+func ResetJobIdsAtStartup() {
+	JobIdsAtStartup = newJobIdsAtStartup()
+}
 
 // for test
 func AddRetrievalJobAtStartup(archiveId, retrievalByteRange, jobId string) {
@@ -41,6 +63,16 @@ func AddRetrievalJobAtStartup(archiveId, retrievalByteRange, jobId string) {
 	fileRetrievalJobIdByRange[retrievalByteRange] = jobId
 }
 
+// for test
+func AddMappingRetrievalJobAtStartup(archiveId, jobId string) {
+	JobIdsAtStartup.mappingRetrievalJobIdByArchiveId[archiveId] = jobId
+}
+
+// for test
+func AddRetrievalJobCompletionAtStartup(jobId string, completionDate time.Time) {
+	JobIdsAtStartup.completionDateByJobId[jobId] = completionDate
+}
+
 func LoadJobIdsAtStartup(glacierClient glacieriface.GlacierAPI, mappingVault, vault string) {
 	fileRetrievalJobCounter := 0
 	recordJobsFn := func(page *glacier.ListJobsOutput, lastPage bool) bool {
@@ -48,7 +80,7 @@ func LoadJobIdsAtStartup(glacierClient glacieriface.GlacierAPI, mappingVault, va
 			if *desc.StatusCode == "InProgress" || *desc.StatusCode == "Succeeded" {
 				if *desc.Action == "ArchiveRetrieval" {
 					if strings.HasSuffix(*desc.VaultARN, "_mapping") {
-						JobIdsAtStartup.MappingRetrievalJobId = *desc.JobId
+						JobIdsAtStartup.mappingRetrievalJobIdByArchiveId[*desc.ArchiveId] = *desc.JobId
 					} else {
 						fileRetrievalJobIdByRange, ok := JobIdsAtStartup.fileRetrievalJobIdByRangeByArchiveId[*desc.ArchiveId]
 						if !ok {
@@ -59,10 +91,19 @@ func LoadJobIdsAtStartup(glacierClient glacieriface.GlacierAPI, mappingVault, va
 							fileRetrievalJobIdByRange[*desc.RetrievalByteRange] = *desc.JobId
 							fileRetrievalJobCounter++
 						}
+						if completionDate := parseJobDate(desc.CompletionDate); !completionDate.IsZero() {
+							JobIdsAtStartup.completionDateByJobId[*desc.JobId] = completionDate
+						}
+						if creationDate := parseJobDate(desc.CreationDate); !creationDate.IsZero() {
+							JobIdsAtStartup.creationDateByJobId[*desc.JobId] = creationDate
+						}
 					}
-				} else {
+				} else if desc.InventoryRetrievalParameters == nil || desc.InventoryRetrievalParameters.Limit == nil {
+					// inventories limited to some archives were started by previous versions
 					if strings.HasSuffix(*desc.VaultARN, "_mapping") {
 						JobIdsAtStartup.MappingInventoryJobId = *desc.JobId
+					} else {
+						JobIdsAtStartup.DataInventoryJobId = *desc.JobId
 					}
 				}
 			}
@@ -74,14 +115,39 @@ func LoadJobIdsAtStartup(glacierClient glacieriface.GlacierAPI, mappingVault, va
 	if JobIdsAtStartup.MappingInventoryJobId != "" {
 		outputs.Printfln(outputs.Verbose, "Mapping inventory job found : %s", JobIdsAtStartup.MappingInventoryJobId)
 	}
-	if JobIdsAtStartup.MappingRetrievalJobId != "" {
-		outputs.Printfln(outputs.Verbose, "Mapping retrivial job found : %s", JobIdsAtStartup.MappingRetrievalJobId)
+	if JobIdsAtStartup.DataInventoryJobId != "" {
+		outputs.Printfln(outputs.Verbose, "Data inventory job found : %s", JobIdsAtStartup.DataInventoryJobId)
+	}
+	for archiveId, jobId := range JobIdsAtStartup.mappingRetrievalJobIdByArchiveId {
+		outputs.Printfln(outputs.Verbose, "Mapping retrivial job found for archive %s : %s", archiveId, jobId)
 	}
 	if fileRetrievalJobCounter > 0 {
 		outputs.Printfln(outputs.Verbose, "%v file retrivial job found", fileRetrievalJobCounter)
 	}
 }
 
+func (jobIdsAtStartup *jobIdsAtStartupStruct) GetJobIdForMappingRetrieval(archiveId string) string {
+	return jobIdsAtStartup.mappingRetrievalJobIdByArchiveId[archiveId]
+}
+
+// zero if the job was not completed at startup
+func (jobIdsAtStartup *jobIdsAtStartupStruct) GetJobCompletionDate(jobId string) time.Time {
+	return jobIdsAtStartup.completionDateByJobId[jobId]
+}
+
+// zero if unknown
+func (jobIdsAtStartup *jobIdsAtStartupStruct) GetJobCreationDate(jobId string) time.Time {
+	return jobIdsAtStartup.creationDateByJobId[jobId]
+}
+
+func (jobIdsAtStartup *jobIdsAtStartupStruct) ForgetFileRetrievalJob(archiveId, retrievalByteRange string) {
+	if fileRetrievalJobIdByRange, ok := jobIdsAtStartup.fileRetrievalJobIdByRangeByArchiveId[archiveId]; ok {
+		delete(jobIdsAtStartup.completionDateByJobId, fileRetrievalJobIdByRange[retrievalByteRange])
+		delete(jobIdsAtStartup.creationDateByJobId, fileRetrievalJobIdByRange[retrievalByteRange])
+		delete(fileRetrievalJobIdByRange, retrievalByteRange)
+	}
+}
+
 func (jobIdsAtStartup *jobIdsAtStartupStruct) GetJobIdForFileRetrieval(archiveId, retrievalByteRange string) string {
 	if fileRetrievalJobIdByRange, ok := jobIdsAtStartup.fileRetrievalJobIdByRangeByArchiveId[archiveId]; ok {
 		if fileRetrievalJobId, ok := fileRetrievalJobIdByRange[retrievalByteRange]; ok {
@@ -91,20 +157,51 @@ func (jobIdsAtStartup *jobIdsAtStartupStruct) GetJobIdForFileRetrieval(archiveId
 	return ""
 }
 
-func WaitJobIsCompleted(glacierClient glacieriface.GlacierAPI, vault, jobId string) {
+type JobFailedError struct {
+	JobId         string
+	StatusMessage string
+}
+
+func (err *JobFailedError) Error() string {
+	return "Job " + err.JobId + " has failed: " + err.StatusMessage
+}
+
+func jobHasFailed(desc *glacier.JobDescription) bool {
+	return aws.StringValue(desc.StatusCode) == glacier.StatusCodeFailed
+}
+
+// return the completion date of the job, zero if aws does not give it, exit if the job has failed
+func WaitJobIsCompleted(glacierClient glacieriface.GlacierAPI, vault, jobId string) time.Time {
 	for {
-		completed, err := JobIsCompleted(glacierClient, vault, jobId)
-		if completed {
-			return
-		} else if err != nil {
-			utils.ExitIfError(err)
+		resp, err := DescribeJob(glacierClient, vault, jobId)
+		utils.ExitIfError(err)
+		if resp.Completed != nil && *resp.Completed {
+			if jobHasFailed(resp) {
+				utils.ExitIfError(&JobFailedError{JobId: jobId, StatusMessage: aws.StringValue(resp.StatusMessage)})
+			}
+			return parseJobDate(resp.CompletionDate)
 		}
 		time.Sleep(1 * WaitTime)
 	}
 }
 
+func parseJobDate(date *string) time.Time {
+	if date == nil {
+		return time.Time{}
+	}
+	parsedDate, err := time.Parse(time.RFC3339, *date)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsedDate
+}
+
+// a JobFailedError if the job has completed with the Failed status
 func JobIsCompleted(glacierClient glacieriface.GlacierAPI, vault, jobId string) (bool, error) {
 	if resp, err := DescribeJob(glacierClient, vault, jobId); err == nil {
+		if *resp.Completed && jobHasFailed(resp) {
+			return false, &JobFailedError{JobId: jobId, StatusMessage: aws.StringValue(resp.StatusMessage)}
+		}
 		return *resp.Completed, nil
 	} else {
 		return false, err
@@ -150,7 +247,7 @@ func DownloadPartialArchiveTo(glacierClient glacieriface.GlacierAPI, vault, jobI
 	file.Seek(int64(fromByteToWrite), os.SEEK_SET)
 	utils.ExitIfError(err)
 	outputs.Printfln(outputs.Verbose, "Copy file into: %v", destPath)
-	written, err := io.Copy(file, resp.Body)
+	written, err := io.Copy(file, DownloadLimiter.Reader(resp.Body))
 	written64 := uint64(written)
 	outputs.Printfln(outputs.Verbose, "%v copied", bytefmt.ByteSize(written64))
 	utils.ExitIfError(err)
@@ -158,11 +255,13 @@ func DownloadPartialArchiveTo(glacierClient glacieriface.GlacierAPI, vault, jobI
 }
 
 type JobStartStatus struct {
-	JobId         string
-	IsResumed     bool
-	IsSuccess     bool
-	Err           error
-	SizeRetrieved uint64
+	JobId          string
+	IsResumed      bool
+	IsSuccess      bool
+	Err            error
+	SizeRetrieved  uint64
+	CreationDate   time.Time // zero if unknown
+	CompletionDate time.Time // zero if the job is not completed or not resumed
 }
 
 func StartRetrieveArchiveJob(glacierClient glacieriface.GlacierAPI, vault string, archive Archive) JobStartStatus {
@@ -183,8 +282,17 @@ func StartRetrievePartialArchiveJob(glacierClient glacieriface.GlacierAPI, vault
 	}
 	rangeToRetrieve = strconv.FormatUint(fromByte, 10) + "-" + strconv.FormatUint(fromByte + sizeToRetrieve - 1, 10)
 
-	if existingJobsId := JobIdsAtStartup.GetJobIdForFileRetrieval(archive.ArchiveId, rangeToRetrieve); existingJobsId != "" {
-		return JobStartStatus{JobId: existingJobsId, IsResumed: true, IsSuccess: true, SizeRetrieved: sizeToRetrieve}
+	existingJobsId := JobIdsAtStartup.GetJobIdForFileRetrieval(archive.ArchiveId, rangeToRetrieve)
+	completionDate := JobIdsAtStartup.GetJobCompletionDate(existingJobsId)
+	if existingJobsId != "" && !completionDate.IsZero() && !completionDate.Add(JobOutputAvailability).After(time.Now()) {
+		outputs.Printfln(outputs.Warning, "Output of job %s found at startup has expired, range %s of archive %s is retrieved again with a new job",
+			existingJobsId, rangeToRetrieve, archive.ArchiveId)
+		JobIdsAtStartup.ForgetFileRetrievalJob(archive.ArchiveId, rangeToRetrieve)
+		existingJobsId = ""
+	}
+	if existingJobsId != "" {
+		return JobStartStatus{JobId: existingJobsId, IsResumed: true, IsSuccess: true, SizeRetrieved: sizeToRetrieve,
+			CreationDate: JobIdsAtStartup.GetJobCreationDate(existingJobsId), CompletionDate: completionDate}
 	} else {
 		params := &glacier.InitiateJobInput{
 			AccountId: aws.String(AccountId),
@@ -201,11 +309,20 @@ func StartRetrievePartialArchiveJob(glacierClient glacieriface.GlacierAPI, vault
 		if err != nil {
 			return JobStartStatus{IsSuccess: false, Err: err}
 		}
-		return JobStartStatus{JobId: *resp.JobId, IsResumed: false, IsSuccess: true, SizeRetrieved: sizeToRetrieve}
+		return JobStartStatus{JobId: *resp.JobId, IsResumed: false, IsSuccess: true, SizeRetrieved: sizeToRetrieve, CreationDate: time.Now()}
 	}
 }
 
+type DataRetrievalPolicy struct {
+	Strategy     string
+	BytesPerHour uint64 // only defined for BytesPerHour strategy
+}
+
 func GetDataRetrievalStrategy(glacierClient glacieriface.GlacierAPI) string {
+	return GetDataRetrievalPolicy(glacierClient).Strategy
+}
+
+func GetDataRetrievalPolicy(glacierClient glacieriface.GlacierAPI) DataRetrievalPolicy {
 	params := &glacier.GetDataRetrievalPolicyInput{
 		AccountId:  &AccountId,
 	}
@@ -213,16 +330,20 @@ func GetDataRetrievalStrategy(glacierClient glacieriface.GlacierAPI) string {
 	resp, err := glacierClient.GetDataRetrievalPolicy(params)
 	outputs.Printfln(outputs.Verbose, "Aws response: %v (error %v)\n", resp, err)
 	utils.ExitIfError(err)
-	return *resp.Policy.Rules[0].Strategy
+	rule := resp.Policy.Rules[0]
+	policy := DataRetrievalPolicy{Strategy: *rule.Strategy}
+	if rule.BytesPerHour != nil && *rule.BytesPerHour > 0 {
+		policy.BytesPerHour = uint64(*rule.BytesPerHour)
+	}
+	return policy
 }
 
-func InventoryTowElementsOfVault(glacierClient glacieriface.GlacierAPI, vault string) string {
+func InventoryVault(glacierClient glacieriface.GlacierAPI, vault string) string {
 	params := &glacier.InitiateJobInput{
 		AccountId: aws.String(AccountId),
 		VaultName: aws.String(vault),
 		JobParameters: &glacier.JobParameters{
 			Type:        aws.String("inventory-retrieval"),
-			InventoryRetrievalParameters: &glacier.InventoryRetrievalJobInput{Limit: aws.String("2")},
 		},
 	}
 	outputs.Printfln(outputs.Verbose, "Aws call: glacier.InitiateJob(%v)", params)
@@ -233,10 +354,11 @@ func InventoryTowElementsOfVault(glacierClient glacieriface.GlacierAPI, vault st
 }
 
 type VaultInventory struct {
-	ArchiveList []Archive
+	InventoryDate string
+	ArchiveList   []Archive
 }
 
-func GetArchiveIdFromInventory(glacierClient glacieriface.GlacierAPI, vault, jobId string) *Archive {
+func GetVaultInventory(glacierClient glacieriface.GlacierAPI, vault, jobId string) *VaultInventory {
 	params := &glacier.GetJobOutputInput{
 		AccountId: aws.String(AccountId),
 		JobId:     aws.String(jobId),
@@ -252,10 +374,7 @@ func GetArchiveIdFromInventory(glacierClient glacieriface.GlacierAPI, vault, job
 	vaultInventory := VaultInventory{}
 	err = json.Unmarshal(jsonContent, &vaultInventory)
 	utils.ExitIfError(err)
-	if (len(vaultInventory.ArchiveList) != 1) {
-		utils.ExitIfError(errors.New("Mapping vault shoud be have only one archive"))
-	}
-	return &vaultInventory.ArchiveList[0]
+	return &vaultInventory
 }
 
 func DoOnJobPages(glacierClient glacieriface.GlacierAPI, vault string, fn func(*glacier.ListJobsOutput, bool) bool) {
@@ -263,6 +382,10 @@ func DoOnJobPages(glacierClient glacieriface.GlacierAPI, vault string, fn func(*
 		AccountId: aws.String(AccountId),
 		VaultName: aws.String(vault),
 	}
+	doOnJobPages(glacierClient, params, fn)
+}
+
+func doOnJobPages(glacierClient glacieriface.GlacierAPI, params *glacier.ListJobsInput, fn func(*glacier.ListJobsOutput, bool) bool) {
 	outputs.Printfln(outputs.Verbose, "Aws call: glacier.ListJobsPages(%v)", params)
 	err := glacierClient.ListJobsPages(params, fn)
 	outputs.Printfln(outputs.Verbose, "Aws error %v\n", err)
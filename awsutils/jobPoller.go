@@ -0,0 +1,88 @@
+package awsutils
+
+import (
+	"time"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/aws/aws-sdk-go/service/glacier/glacieriface"
+)
+
+// Completion of the retrieval jobs of a vault, checked for all jobs in one sweep of the completed jobs of the
+// vault instead of a DescribeJob by job.
+//
+// A retrieval job takes about 4 hours, so the poller does not sweep before the first expected completion of
+// the waited jobs (but at least every MaxPollInterval), then it sweeps every WaitTime until a job is
+// completed. A completed job may have failed, its output cannot be downloaded then.
+//
+// The completed jobs are those of the last sweep only: jobs expired or deleted since the previous sweep are
+// forgotten, so the poller does not grow during a restore of several days.
+
+var MaxPollInterval = 1 * time.Hour
+
+type CompletedJob struct {
+	CompletionDate time.Time // zero if aws does not give it
+	Failed         bool
+	StatusMessage  string
+}
+
+type JobPoller struct {
+	glacierClient glacieriface.GlacierAPI
+	vault         string
+	completedJobs map[string]CompletedJob // at the last sweep
+	lastSweep     time.Time
+}
+
+func NewJobPoller(glacierClient glacieriface.GlacierAPI, vault string) *JobPoller {
+	return &JobPoller{glacierClient: glacierClient, vault: vault, completedJobs: make(map[string]CompletedJob)}
+}
+
+func (poller *JobPoller) Sweep() {
+	params := &glacier.ListJobsInput{
+		AccountId: aws.String(AccountId),
+		VaultName: aws.String(poller.vault),
+		Completed: aws.String("true"),
+	}
+	completedJobs := make(map[string]CompletedJob)
+	doOnJobPages(poller.glacierClient, params, func(page *glacier.ListJobsOutput, lastPage bool) bool {
+		for _, desc := range page.JobList {
+			if desc.JobId != nil {
+				completedJobs[*desc.JobId] = CompletedJob{CompletionDate: parseJobDate(desc.CompletionDate),
+					Failed: jobHasFailed(desc),
+					StatusMessage: aws.StringValue(desc.StatusMessage)}
+			}
+		}
+		return true
+	})
+	poller.completedJobs = completedJobs
+	poller.lastSweep = time.Now()
+}
+
+// false if the job was not completed at the last sweep
+func (poller *JobPoller) CompletedJob(jobId string) (CompletedJob, bool) {
+	completedJob, completed := poller.completedJobs[jobId]
+	return completedJob, completed
+}
+
+// date of the next sweep, given the creation dates of the waited jobs
+func (poller *JobPoller) NextSweepDate(creationDates []time.Time) time.Time {
+	if poller.lastSweep.IsZero() {
+		return time.Now()
+	}
+	nextSweep := poller.lastSweep.Add(WaitTime)
+	if len(creationDates) == 0 {
+		return nextSweep
+	}
+	firstExpectedCompletion := creationDates[0].Add(JobDuration)
+	for _, creationDate := range creationDates[1:] {
+		if expectedCompletion := creationDate.Add(JobDuration); expectedCompletion.Before(firstExpectedCompletion) {
+			firstExpectedCompletion = expectedCompletion
+		}
+	}
+	if firstExpectedCompletion.After(nextSweep) {
+		nextSweep = firstExpectedCompletion
+		if maxSweep := poller.lastSweep.Add(MaxPollInterval); nextSweep.After(maxSweep) {
+			nextSweep = maxSweep
+		}
+	}
+	return nextSweep
+}
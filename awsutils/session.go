@@ -6,11 +6,14 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 )
 
-func BuildSession(awsId, awsSecret string) *session.Session {
+func BuildSession(awsId, awsSecret, awsProfile string) *session.Session {
 	var sessionValue *session.Session
 	if (awsId != "" && awsSecret != "") {
 		credentialsValue := credentials.NewStaticCredentials(awsId, awsSecret, "")
 		sessionValue = session.New(&aws.Config{Credentials: credentialsValue})
+	} else if awsProfile != "" {
+		credentialsValue := credentials.NewSharedCredentials("", awsProfile)
+		sessionValue = session.New(&aws.Config{Credentials: credentialsValue})
 	} else {
 		sessionValue = session.New()
 	}
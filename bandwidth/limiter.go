@@ -0,0 +1,144 @@
+package bandwidth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"code.cloudfoundry.org/bytefmt"
+	"rsg/schedule"
+)
+
+// Token bucket limiting the bytes read by second. The rate can change with the time of day, a scheduled rate
+// overrides the default rate inside its window. A rate of 0 means unlimited.
+
+type ScheduledRate struct {
+	Window schedule.Window
+	Rate   uint64
+}
+
+type Limiter struct {
+	defaultRate    uint64
+	scheduledRates []ScheduledRate
+	tokens         float64
+	lastRefill     time.Time
+	mutex          sync.Mutex
+}
+
+func NewLimiter(defaultRate uint64, scheduledRates []ScheduledRate) *Limiter {
+	return &Limiter{defaultRate: defaultRate, scheduledRates: scheduledRates, lastRefill: time.Now()}
+}
+
+// parse values like "08:00-18:00=2M"
+func ParseScheduledRates(values []string) ([]ScheduledRate, error) {
+	scheduledRates := []ScheduledRate{}
+	for _, value := range values {
+		parts := strings.Split(value, "=")
+		if len(parts) != 2 {
+			return nil, errors.New(fmt.Sprintf("Invalid bandwidth schedule %s, expected format is 08:00-18:00=2M", value))
+		}
+		window, err := schedule.ParseWindow(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		rate, err := ParseRate(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		scheduledRates = append(scheduledRates, ScheduledRate{Window: window, Rate: rate})
+	}
+	return scheduledRates, nil
+}
+
+// parse values like "20M", "0" or "" means unlimited
+func ParseRate(value string) (uint64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	return bytefmt.ToBytes(value)
+}
+
+func (limiter *Limiter) IsLimited() bool {
+	if limiter == nil {
+		return false
+	}
+	if limiter.defaultRate > 0 {
+		return true
+	}
+	for _, scheduledRate := range limiter.scheduledRates {
+		if scheduledRate.Rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// bytes by second allowed at the given date, 0 if unlimited
+func (limiter *Limiter) Rate(date time.Time) uint64 {
+	if limiter == nil {
+		return 0
+	}
+	for _, scheduledRate := range limiter.scheduledRates {
+		if scheduledRate.Window.Contains(date) {
+			return scheduledRate.Rate
+		}
+	}
+	return limiter.defaultRate
+}
+
+// cap a speed to the rate allowed at the given date
+func (limiter *Limiter) CapSpeed(speed uint64, date time.Time) uint64 {
+	if rate := limiter.Rate(date); rate > 0 && rate < speed {
+		return rate
+	}
+	return speed
+}
+
+// wait until n bytes can be read, n must not be greater than the rate
+func (limiter *Limiter) wait(n int) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	now := time.Now()
+	rate := limiter.Rate(now)
+	if rate == 0 {
+		limiter.lastRefill = now
+		return
+	}
+	limiter.tokens += now.Sub(limiter.lastRefill).Seconds() * float64(rate)
+	if limiter.tokens > float64(rate) {
+		limiter.tokens = float64(rate)
+	}
+	limiter.lastRefill = now
+	if missingTokens := float64(n) - limiter.tokens; missingTokens > 0 {
+		time.Sleep(time.Duration(missingTokens / float64(rate) * float64(time.Second)))
+		limiter.tokens += missingTokens
+		limiter.lastRefill = time.Now()
+	}
+	limiter.tokens -= float64(n)
+}
+
+func (limiter *Limiter) Reader(reader io.Reader) io.Reader {
+	if !limiter.IsLimited() {
+		return reader
+	}
+	return &limitedReader{reader: reader, limiter: limiter}
+}
+
+type limitedReader struct {
+	reader  io.Reader
+	limiter *Limiter
+}
+
+func (limitedReader *limitedReader) Read(p []byte) (int, error) {
+	if rate := limitedReader.limiter.Rate(time.Now()); rate > 0 && uint64(len(p)) > rate {
+		p = p[:rate]
+	}
+	n, err := limitedReader.reader.Read(p)
+	if n > 0 {
+		limitedReader.limiter.wait(n)
+	}
+	return n, err
+}
@@ -0,0 +1,208 @@
+package bandwidth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"rsg/schedule"
+)
+
+func at(hour, minute int) time.Time {
+	return time.Date(2016, 6, 15, hour, minute, 0, 0, time.UTC)
+}
+
+func window(t *testing.T, value string) schedule.Window {
+	window, err := schedule.ParseWindow(value)
+	assert.NoError(t, err)
+	return window
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value string
+		rate  uint64
+		err   bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{" 20M ", 20 * 1024 * 1024, false},
+		{"512K", 512 * 1024, false},
+		{"1G", 1024 * 1024 * 1024, false},
+		{"fast", 0, true},
+	}
+	for _, test := range tests {
+		// When
+		rate, err := ParseRate(test.value)
+
+		// Then
+		assert.Equal(t, test.err, err != nil, test.value)
+		assert.Equal(t, test.rate, rate, test.value)
+	}
+}
+
+func TestParseScheduledRates(t *testing.T) {
+	tests := []struct {
+		values         []string
+		scheduledRates []ScheduledRate
+		err            string
+	}{
+		{[]string{}, []ScheduledRate{}, ""},
+		{[]string{"08:00-18:00=2M", "22:00-07:00=0"},
+			[]ScheduledRate{{Window: window(t, "08:00-18:00"), Rate: 2 * 1024 * 1024}, {Window: window(t, "22:00-07:00"), Rate: 0}}, ""},
+		{[]string{"08:00-18:00"}, nil, "Invalid bandwidth schedule 08:00-18:00, expected format is 08:00-18:00=2M"},
+		{[]string{"08:00=2M"}, nil, "Invalid time window 08:00, expected format is 22:00-07:00"},
+	}
+	for _, test := range tests {
+		// When
+		scheduledRates, err := ParseScheduledRates(test.values)
+
+		// Then
+		if test.err != "" {
+			assert.EqualError(t, err, test.err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.scheduledRates, scheduledRates)
+	}
+}
+
+func TestLimiter_rate_at_time_of_day(t *testing.T) {
+	// Given
+	limiter := NewLimiter(1000, []ScheduledRate{{Window: window(t, "08:00-18:00"), Rate: 200}, {Window: window(t, "22:00-07:00"), Rate: 0}})
+
+	tests := []struct {
+		date time.Time
+		rate uint64
+	}{
+		{at(7, 30), 1000},
+		{at(8, 0), 200},
+		{at(17, 59), 200},
+		{at(18, 0), 1000},
+		{at(23, 0), 0},
+		{at(3, 0), 0},
+	}
+	for _, test := range tests {
+		// When
+		rate := limiter.Rate(test.date)
+
+		// Then
+		assert.Equal(t, test.rate, rate, "rate at %s", test.date)
+	}
+}
+
+func TestLimiter_cap_speed(t *testing.T) {
+	// Given
+	limiter := NewLimiter(1000, []ScheduledRate{{Window: window(t, "22:00-07:00"), Rate: 0}})
+
+	tests := []struct {
+		speed       uint64
+		date        time.Time
+		cappedSpeed uint64
+	}{
+		{500, at(12, 0), 500},
+		{5000, at(12, 0), 1000},
+		{5000, at(23, 0), 5000},
+	}
+	for _, test := range tests {
+		// When
+		cappedSpeed := limiter.CapSpeed(test.speed, test.date)
+
+		// Then
+		assert.Equal(t, test.cappedSpeed, cappedSpeed, "speed %v at %s", test.speed, test.date)
+	}
+}
+
+func TestLimiter_is_limited(t *testing.T) {
+	tests := []struct {
+		limiter *Limiter
+		limited bool
+	}{
+		{nil, false},
+		{NewLimiter(0, nil), false},
+		{NewLimiter(0, []ScheduledRate{{Window: window(t, "08:00-18:00"), Rate: 0}}), false},
+		{NewLimiter(1000, nil), true},
+		{NewLimiter(0, []ScheduledRate{{Window: window(t, "08:00-18:00"), Rate: 1000}}), true},
+	}
+	for i, test := range tests {
+		// When
+		limited := test.limiter.IsLimited()
+
+		// Then
+		assert.Equal(t, test.limited, limited, "limiter %v", i)
+	}
+}
+
+func TestLimiter_burst_is_capped_to_one_second_of_rate(t *testing.T) {
+	// Given
+	limiter := NewLimiter(10000, nil)
+	limiter.lastRefill = time.Now().Add(-10 * time.Second)
+
+	// When
+	start := time.Now()
+	limiter.wait(10000)
+	burstDuration := time.Since(start)
+	limiter.wait(1000)
+	waitDuration := time.Since(start) - burstDuration
+
+	// Then
+	assert.True(t, burstDuration < 50 * time.Millisecond, "burst took %s", burstDuration)
+	assert.True(t, waitDuration >= 90 * time.Millisecond, "wait took %s", waitDuration)
+}
+
+func TestLimiter_wait_follows_rate_changes(t *testing.T) {
+	tests := []struct {
+		rate        uint64
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{10000, 90 * time.Millisecond, 500 * time.Millisecond},
+		{2000, 450 * time.Millisecond, 1500 * time.Millisecond},
+		{0, 0, 50 * time.Millisecond},
+	}
+	limiter := NewLimiter(10000, nil)
+	for _, test := range tests {
+		// Given
+		limiter.defaultRate = test.rate
+		limiter.tokens = 0
+		limiter.lastRefill = time.Now()
+
+		// When
+		start := time.Now()
+		limiter.wait(1000)
+		duration := time.Since(start)
+
+		// Then
+		assert.True(t, duration >= test.minDuration && duration < test.maxDuration, "wait of 1000 bytes at %v B/s took %s", test.rate, duration)
+	}
+}
+
+func TestLimiter_reader_reads_by_chunks_of_rate(t *testing.T) {
+	// Given
+	limiter := NewLimiter(10000, nil)
+	limiter.lastRefill = time.Now().Add(-time.Second)
+	content := bytes.Repeat([]byte("a"), 15000)
+
+	// When
+	start := time.Now()
+	read, err := ioutil.ReadAll(limiter.Reader(bytes.NewReader(content)))
+	duration := time.Since(start)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, content, read)
+	assert.True(t, duration >= 450 * time.Millisecond, "read took %s", duration)
+}
+
+func TestLimiter_reader_is_not_wrapped_when_unlimited(t *testing.T) {
+	// Given
+	limiter := NewLimiter(0, nil)
+	reader := bytes.NewReader([]byte("content"))
+
+	// When
+	limitedReader := limiter.Reader(reader)
+
+	// Then
+	assert.Equal(t, reader, limitedReader)
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"code.cloudfoundry.org/bytefmt"
+	"rsg/awsutils"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Reconcile the mapping file with a full inventory of the data vault, to know if a backup set can be
+// restored before needing it.
+//
+// The inventory job lasts up to 4 hours and aws updates the inventory of a vault about once a day, so the
+// inventory is cached in the working directory and retrieved again only when a refresh is requested.
+// Archives uploaded after the inventory date are not in the inventory. Empty files have no archive.
+
+const inventoryFileName = "inventory.json"
+
+type ArchiveSizeMismatch struct {
+	ArchiveId   string
+	MappingSize uint64
+	VaultSize   uint64
+}
+
+type AuditReport struct {
+	InventoryDate    string
+	MissingArchives  []string // in mapping but not in vault
+	UnmappedArchives []awsutils.Archive // in vault but not in mapping
+	SizeMismatches   []ArchiveSizeMismatch
+}
+
+func (auditReport *AuditReport) HasDiscrepancies() bool {
+	return len(auditReport.MissingArchives) > 0 || len(auditReport.UnmappedArchives) > 0 || len(auditReport.SizeMismatches) > 0
+}
+
+// return false if mapping and inventory differ
+func AuditVault(restorationContext *RestorationContext, refreshInventory bool) bool {
+	vaultInventory := getDataVaultInventory(restorationContext, refreshInventory)
+	auditReport := auditMapping(restorationContext, vaultInventory)
+	displayAuditReport(restorationContext, auditReport)
+	return !auditReport.HasDiscrepancies()
+}
+
+func auditMapping(restorationContext *RestorationContext, vaultInventory *awsutils.VaultInventory) *AuditReport {
+	auditReport := &AuditReport{InventoryDate: vaultInventory.InventoryDate}
+	vaultSizeByArchiveId := make(map[string]uint64)
+	for _, archive := range vaultInventory.ArchiveList {
+		vaultSizeByArchiveId[archive.ArchiveId] = archive.Size
+	}
+
+	db := InitDb(restorationContext.GetMappingFilePath())
+	defer db.Close()
+	rows := GetArchives(db, []string{})
+	defer rows.Close()
+	mappedArchiveIds := make(map[string]bool)
+	for rows.Next() {
+		var archiveId string
+		var fileSize uint64
+		err := rows.Scan(&archiveId, &fileSize)
+		utils.ExitIfError(err)
+		if fileSize == 0 || mappedArchiveIds[archiveId] {
+			continue
+		}
+		mappedArchiveIds[archiveId] = true
+		if vaultSize, ok := vaultSizeByArchiveId[archiveId]; !ok {
+			auditReport.MissingArchives = append(auditReport.MissingArchives, archiveId)
+		} else if vaultSize != fileSize {
+			auditReport.SizeMismatches = append(auditReport.SizeMismatches, ArchiveSizeMismatch{ArchiveId: archiveId, MappingSize: fileSize, VaultSize: vaultSize})
+		}
+	}
+	utils.ExitIfError(rows.Err())
+
+	for _, archive := range vaultInventory.ArchiveList {
+		if !mappedArchiveIds[archive.ArchiveId] {
+			auditReport.UnmappedArchives = append(auditReport.UnmappedArchives, archive)
+		}
+	}
+	return auditReport
+}
+
+func displayAuditReport(restorationContext *RestorationContext, auditReport *AuditReport) {
+	db := InitDb(restorationContext.GetMappingFilePath())
+	defer db.Close()
+	for _, archiveId := range auditReport.MissingArchives {
+		outputs.Printfln(outputs.Warning, "Archive %s is missing in vault: %s", archiveId, strings.Join(getArchivePaths(db, archiveId), ", "))
+	}
+	for _, sizeMismatch := range auditReport.SizeMismatches {
+		outputs.Printfln(outputs.Warning, "Archive %s has size %v in mapping and %v in vault: %s", sizeMismatch.ArchiveId,
+			bytefmt.ByteSize(sizeMismatch.MappingSize), bytefmt.ByteSize(sizeMismatch.VaultSize), strings.Join(getArchivePaths(db, sizeMismatch.ArchiveId), ", "))
+	}
+	for _, archive := range auditReport.UnmappedArchives {
+		outputs.Printfln(outputs.Warning, "Archive %s (%v, created %s) has no file in mapping", archive.ArchiveId, bytefmt.ByteSize(archive.Size), archive.CreationDate)
+	}
+	outputs.Printfln(outputs.Info, "Audit of vault %s with inventory of %s: %v archives missing, %v size mismatches, %v archives not in mapping",
+		restorationContext.Vault, auditReport.InventoryDate, len(auditReport.MissingArchives), len(auditReport.SizeMismatches), len(auditReport.UnmappedArchives))
+}
+
+func getArchivePaths(db *sql.DB, archiveId string) []string {
+	paths := []string{}
+	rows := GetPaths(db, archiveId)
+	defer rows.Close()
+	for rows.Next() {
+		var path string
+		err := rows.Scan(&path)
+		utils.ExitIfError(err)
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func getDataVaultInventory(restorationContext *RestorationContext, refreshInventory bool) *awsutils.VaultInventory {
+	inventoryFilePath := restorationContext.WorkingDirPath + "/" + inventoryFileName
+	if !refreshInventory {
+		if bytes, err := ioutil.ReadFile(inventoryFilePath); err == nil {
+			vaultInventory := awsutils.VaultInventory{}
+			if err = json.Unmarshal(bytes, &vaultInventory); err == nil {
+				outputs.Printfln(outputs.OptionalInfo, "Cached inventory of data vault is used (inventory date %s)", vaultInventory.InventoryDate)
+				return &vaultInventory
+			}
+			outputs.Printfln(outputs.Warning, "Cached inventory of data vault is ignored: %v", err)
+		}
+	}
+	jobId, jobCompleted := checkDataInventoryOrStartNewJob(restorationContext)
+	if !jobCompleted {
+		awsutils.WaitJobIsCompleted(restorationContext.GlacierClient, restorationContext.Vault, jobId)
+		outputs.Printfln(outputs.OptionalInfo, "Job has finished: %s", jobId)
+	}
+	vaultInventory := awsutils.GetVaultInventory(restorationContext.GlacierClient, restorationContext.Vault, jobId)
+	bytes, err := json.Marshal(vaultInventory)
+	utils.ExitIfError(err)
+	err = utils.WriteFileAtomically(inventoryFilePath, bytes, 0600)
+	utils.ExitIfError(err)
+	return vaultInventory
+}
+
+func checkDataInventoryOrStartNewJob(restorationContext *RestorationContext) (string, bool) {
+	jobCompleted := false
+	jobId := awsutils.JobIdsAtStartup.DataInventoryJobId
+	var err error
+	if jobId != "" {
+		outputs.Printfln(outputs.Verbose, "Data vault inventory job id found : %s", jobId)
+		jobCompleted, err = awsutils.JobIsCompleted(restorationContext.GlacierClient, restorationContext.Vault, jobId)
+		if jobCompleted == false {
+			if err == nil {
+				outputs.Printfln(outputs.OptionalInfo, "Job to get inventory of data vault is in progress (can last up to 4 hours): %s", jobId)
+			} else if strings.Contains(err.Error(), "The job ID was not found") {
+				outputs.Println(outputs.Warning, "Inventory job cached for data vault was not found")
+				jobId = inventoryDataVault(restorationContext)
+			} else if _, failed := err.(*awsutils.JobFailedError); failed {
+				outputs.Printfln(outputs.Warning, "%v, inventory of data vault is started again", err)
+				jobId = inventoryDataVault(restorationContext)
+			} else {
+				utils.ExitIfError(err)
+			}
+		}
+	} else {
+		jobId = inventoryDataVault(restorationContext)
+	}
+	return jobId, jobCompleted
+}
+
+func inventoryDataVault(restorationContext *RestorationContext) string {
+	jobId := awsutils.InventoryVault(restorationContext.GlacierClient, restorationContext.Vault)
+	outputs.Printfln(outputs.OptionalInfo, "Job to get inventory of data vault has started (can last up to 4 hours): %s", jobId)
+	return jobId
+}
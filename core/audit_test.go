@@ -0,0 +1,105 @@
+package core
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"testing"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"rsg/awsutils"
+)
+
+func mockStartDataJobInventory(glacierMock *GlacierMock, vault, jobIdToReturn string) *mock.Call {
+	params := &glacier.InitiateJobInput{
+		AccountId: aws.String(awsutils.AccountId),
+		VaultName: aws.String(vault),
+		JobParameters: &glacier.JobParameters{
+			Type:        aws.String("inventory-retrieval"),
+		},
+	}
+
+	out := &glacier.InitiateJobOutput{
+		JobId: aws.String(jobIdToReturn),
+	}
+
+	return glacierMock.On("InitiateJob", params).Return(out, nil)
+}
+
+func createAuditMappingFile(restorationContext *RestorationContext) {
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 10);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file2.txt', 'archiveId2', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file3.txt', 'archiveId3', 7);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/empty.txt', '', 0);")
+	db.Close()
+}
+
+func TestAuditVault_report_discrepancies_with_new_inventory(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	createAuditMappingFile(restorationContext)
+
+	mockStartDataJobInventory(glacierMock, restorationContext.Vault, "inventoryJobId")
+	mockDescribeJob(glacierMock, "inventoryJobId", restorationContext.Vault, true)
+	mockOutputJob(glacierMock, "inventoryJobId", restorationContext.Vault, []byte("{\"InventoryDate\":\"2016-08-02T12:00:00Z\",\"ArchiveList\":[" +
+		"{\"ArchiveId\":\"archiveId1\",\"Size\":10,\"CreationDate\":\"2016-08-01T12:00:00Z\"}," +
+		"{\"ArchiveId\":\"archiveId2\",\"Size\":6,\"CreationDate\":\"2016-08-01T12:00:00Z\"}," +
+		"{\"ArchiveId\":\"archiveId4\",\"Size\":3,\"CreationDate\":\"2016-08-01T12:00:00Z\"}]}"))
+
+	// When
+	consistent := AuditVault(restorationContext, false)
+
+	// Then
+	assert.False(t, consistent)
+	output := string(buffer.Bytes())
+	assert.Contains(t, output, "Job to get inventory of data vault has started (can last up to 4 hours): inventoryJobId")
+	assert.Contains(t, output, "Archive archiveId3 is missing in vault: share/data/file3.txt")
+	assert.Contains(t, output, "Archive archiveId2 has size 5B in mapping and 6B in vault: share/data/file2.txt")
+	assert.Contains(t, output, "Archive archiveId4 (3B, created 2016-08-01T12:00:00Z) has no file in mapping")
+	assert.Contains(t, output, "Audit of vault vault with inventory of 2016-08-02T12:00:00Z: 1 archives missing, 1 size mismatches, 1 archives not in mapping")
+	_, err := ioutil.ReadFile(restorationContext.WorkingDirPath + "/inventory.json")
+	assert.Nil(t, err)
+}
+
+func TestAuditVault_use_cached_inventory(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	createAuditMappingFile(restorationContext)
+	ioutil.WriteFile(restorationContext.WorkingDirPath + "/inventory.json", []byte("{\"InventoryDate\":\"2016-08-02T12:00:00Z\",\"ArchiveList\":[" +
+		"{\"ArchiveId\":\"archiveId1\",\"Size\":10},{\"ArchiveId\":\"archiveId2\",\"Size\":5},{\"ArchiveId\":\"archiveId3\",\"Size\":7}]}"), 0600)
+
+	// When
+	consistent := AuditVault(restorationContext, false)
+
+	// Then
+	assert.True(t, consistent)
+	output := string(buffer.Bytes())
+	assert.Contains(t, output, "Cached inventory of data vault is used (inventory date 2016-08-02T12:00:00Z)")
+	assert.Contains(t, output, "0 archives missing, 0 size mismatches, 0 archives not in mapping")
+}
+
+func TestAuditVault_wait_inventory_job_found_at_startup_when_refresh(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	createAuditMappingFile(restorationContext)
+	ioutil.WriteFile(restorationContext.WorkingDirPath + "/inventory.json", []byte("{\"ArchiveList\":[]}"), 0600)
+	awsutils.JobIdsAtStartup.DataInventoryJobId = "inventoryJobId"
+
+	mockDescribeJob(glacierMock, "inventoryJobId", restorationContext.Vault, false).Once()
+	mockDescribeJob(glacierMock, "inventoryJobId", restorationContext.Vault, true)
+	mockOutputJob(glacierMock, "inventoryJobId", restorationContext.Vault, []byte("{\"ArchiveList\":[" +
+		"{\"ArchiveId\":\"archiveId1\",\"Size\":10},{\"ArchiveId\":\"archiveId2\",\"Size\":5},{\"ArchiveId\":\"archiveId3\",\"Size\":7}]}"))
+
+	// When
+	consistent := AuditVault(restorationContext, true)
+
+	// Then
+	assert.True(t, consistent)
+	glacierMock.AssertNotCalled(t, "InitiateJob", mock.Anything)
+}
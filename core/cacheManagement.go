@@ -0,0 +1,144 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"code.cloudfoundry.org/bytefmt"
+	"rsg/options"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Manage the working directory of each vault: cache, mapping file and inventory.
+//
+// They are kept between runs to avoid aws jobs, "cache clean" removes those of the selected vaults and
+// "cache prune" those which have not been used for a given duration.
+
+type VaultCacheInfo struct {
+	Region  string
+	Vault   string
+	Path    string
+	Size    uint64
+	LastUse time.Time // last modification of one of its files
+	Files   []string
+	Cache   RegionVaultCache
+}
+
+// working directories of all vaults, sorted by region then vault
+func GetVaultCaches() []*VaultCacheInfo {
+	vaultCaches := []*VaultCacheInfo{}
+	regionDirs, _ := ioutil.ReadDir(GetAccountWorkingDirPath())
+	for _, regionDir := range regionDirs {
+		if !regionDir.IsDir() {
+			continue
+		}
+		vaultDirs, _ := ioutil.ReadDir(GetAccountWorkingDirPath() + "/" + regionDir.Name())
+		for _, vaultDir := range vaultDirs {
+			if vaultDir.IsDir() {
+				vaultCaches = append(vaultCaches, getVaultCache(regionDir.Name(), vaultDir.Name(), vaultDir))
+			}
+		}
+	}
+	return vaultCaches
+}
+
+func getVaultCache(region, vault string, vaultDir os.FileInfo) *VaultCacheInfo {
+	vaultCache := &VaultCacheInfo{Region: region, Vault: vault, Path: GetVaultWorkingDirPath(region, vault), LastUse: vaultDir.ModTime(), Files: []string{}}
+	files, _ := ioutil.ReadDir(vaultCache.Path)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		vaultCache.Files = append(vaultCache.Files, file.Name())
+		vaultCache.Size += uint64(file.Size())
+		if file.ModTime().After(vaultCache.LastUse) {
+			vaultCache.LastUse = file.ModTime()
+		}
+	}
+	vaultCache.Cache = ReadCache(vaultCache.Path)
+	return vaultCache
+}
+
+// working directories of vaults given by --vault, or all of them with --all-vaults
+func SelectVaultCaches(optionsValue options.Options) []*VaultCacheInfo {
+	vaultCaches := GetVaultCaches()
+	if optionsValue.AllVaults {
+		return vaultCaches
+	}
+	if len(optionsValue.Vaults) == 0 {
+		utils.ExitIfError(errors.New("Select vaults with --vault or --all-vaults"))
+	}
+	selectedVaultCaches := []*VaultCacheInfo{}
+	for _, regionVault := range optionsValue.Vaults {
+		found := false
+		for _, vaultCache := range vaultCaches {
+			region, vault := parseRegionVault(vaultCache.Region, regionVault)
+			if vaultCache.Region == region && vaultCache.Vault == vault && (optionsValue.Region == "" || optionsValue.Region == region) {
+				selectedVaultCaches = append(selectedVaultCaches, vaultCache)
+				found = true
+			}
+		}
+		if !found {
+			utils.ExitIfError(errors.New(fmt.Sprintf("No cache found for vault %s", regionVault)))
+		}
+	}
+	return selectedVaultCaches
+}
+
+func ListVaultCaches(vaultCaches []*VaultCacheInfo, now time.Time) {
+	if len(vaultCaches) == 0 {
+		outputs.Printfln(outputs.Info, "No cache found in %s", GetAccountWorkingDirPath())
+		return
+	}
+	buffer := new(bytes.Buffer)
+	writer := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VAULT\tSIZE\tLAST USE\tFILES")
+	for _, vaultCache := range vaultCaches {
+		fmt.Fprintf(writer, "%s:%s\t%s\t%s ago\t%s\n", vaultCache.Region, vaultCache.Vault, bytefmt.ByteSize(vaultCache.Size),
+			now.Sub(vaultCache.LastUse).Truncate(time.Minute), strings.Join(vaultCache.Files, ", "))
+	}
+	writer.Flush()
+	outputs.Printfln(outputs.Info, "%s", strings.TrimSuffix(buffer.String(), "\n"))
+}
+
+func ShowVaultCaches(vaultCaches []*VaultCacheInfo) {
+	content, err := json.MarshalIndent(vaultCaches, "", "  ")
+	utils.ExitIfError(err)
+	outputs.Println(outputs.Info, string(content))
+}
+
+func CleanVaultCaches(vaultCaches []*VaultCacheInfo) {
+	for _, vaultCache := range vaultCaches {
+		removeVaultCache(vaultCache)
+	}
+}
+
+// remove working directories not used since olderThan
+func PruneVaultCaches(olderThan time.Duration, now time.Time) {
+	if olderThan <= 0 {
+		utils.ExitIfError(errors.New("Give the duration after which a cache is removed with --older-than (ex 720h)"))
+	}
+	nbRemoved := 0
+	for _, vaultCache := range GetVaultCaches() {
+		if now.Sub(vaultCache.LastUse) > olderThan {
+			removeVaultCache(vaultCache)
+			nbRemoved++
+		}
+	}
+	outputs.Printfln(outputs.Info, "%v caches not used for %v removed", nbRemoved, olderThan)
+}
+
+func removeVaultCache(vaultCache *VaultCacheInfo) {
+	err := os.RemoveAll(vaultCache.Path)
+	utils.ExitIfError(err)
+	os.Remove(filepath.Dir(vaultCache.Path))
+	outputs.Printfln(outputs.Info, "Cache of vault %s:%s removed (%v)", vaultCache.Region, vaultCache.Vault, bytefmt.ByteSize(vaultCache.Size))
+}
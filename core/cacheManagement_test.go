@@ -0,0 +1,114 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"rsg/options"
+)
+
+func createVaultCache(region, vault string, lastUse time.Time) string {
+	vaultWorkingDirPath := GetVaultWorkingDirPath(region, vault)
+	os.MkdirAll(vaultWorkingDirPath, 0700)
+	ioutil.WriteFile(vaultWorkingDirPath + "/" + cacheFileName, []byte("{\"Version\":1,\"DownloadSpeed\":42}"), 0600)
+	ioutil.WriteFile(vaultWorkingDirPath + "/" + mappingFileName, []byte("mapping"), 0600)
+	os.Chtimes(vaultWorkingDirPath + "/" + cacheFileName, lastUse, lastUse)
+	os.Chtimes(vaultWorkingDirPath + "/" + mappingFileName, lastUse, lastUse)
+	os.Chtimes(vaultWorkingDirPath, lastUse, lastUse)
+	return vaultWorkingDirPath
+}
+
+func TestReadCache_discard_corrupted_cache(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	ioutil.WriteFile("../../testtmp/cache/" + cacheFileName, []byte("{\"DownloadSpeed\":"), 0600)
+
+	// When
+	cache := ReadCache("../../testtmp/cache")
+
+	// Then
+	assert.Equal(t, RegionVaultCache{}, cache)
+	assert.Contains(t, string(buffer.Bytes()), "Cache ../../testtmp/cache/cache.json is corrupted, it is discarded")
+	_, err := os.Stat("../../testtmp/cache/" + cacheFileName)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReadCache_migrate_cache_without_version(t *testing.T) {
+	// Given
+	CommonInitTest()
+	ioutil.WriteFile("../../testtmp/cache/" + cacheFileName, []byte("{\"DownloadSpeed\":42}"), 0600)
+
+	// When
+	cache := ReadCache("../../testtmp/cache")
+
+	// Then
+	assert.Equal(t, RegionVaultCache{Version: cacheVersion, DownloadSpeed: 42}, cache)
+}
+
+func TestWriteCache_replace_cache_file(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	ioutil.WriteFile("../../testtmp/cache/" + cacheFileName, []byte("{\"DownloadSpeed\":1}"), 0600)
+	restorationContext.RegionVaultCache.DownloadSpeed = 42
+
+	// When
+	restorationContext.WriteCache()
+
+	// Then
+	assert.Equal(t, RegionVaultCache{Version: cacheVersion, DownloadSpeed: 42}, ReadCache("../../testtmp/cache"))
+	files, _ := ioutil.ReadDir("../../testtmp/cache")
+	assert.Equal(t, 1, len(files))
+}
+
+func TestListVaultCaches(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	now := time.Now()
+	createVaultCache("region1", "vault1", now.Add(-2 * time.Hour))
+
+	// When
+	ListVaultCaches(GetVaultCaches(), now)
+
+	// Then
+	assert.Contains(t, string(buffer.Bytes()), "region1:vault1  39B   2h0m0s ago  cache.json, mapping.sqllite")
+}
+
+func TestSelectVaultCaches(t *testing.T) {
+	// Given
+	CommonInitTest()
+	createVaultCache("region1", "vault1", time.Now())
+	createVaultCache("region2", "vault1", time.Now())
+	createVaultCache("region2", "vault2", time.Now())
+
+	// When
+	vaultCaches := SelectVaultCaches(options.Options{Vaults: []string{"region2:vault1", "vault2"}})
+
+	// Then
+	assert.Equal(t, 2, len(vaultCaches))
+	assert.Equal(t, "region2", vaultCaches[0].Region)
+	assert.Equal(t, "vault1", vaultCaches[0].Vault)
+	assert.Equal(t, uint64(42), vaultCaches[0].Cache.DownloadSpeed)
+	assert.Equal(t, "vault2", vaultCaches[1].Vault)
+}
+
+func TestPruneVaultCaches_remove_caches_not_used(t *testing.T) {
+	// Given
+	CommonInitTest()
+	now := time.Now()
+	oldVaultPath := createVaultCache("region1", "vault1", now.Add(-40 * 24 * time.Hour))
+	recentVaultPath := createVaultCache("region2", "vault2", now.Add(-time.Hour))
+
+	// When
+	PruneVaultCaches(30 * 24 * time.Hour, now)
+
+	// Then
+	_, err := os.Stat(oldVaultPath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(GetAccountWorkingDirPath() + "/region1")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(recentVaultPath)
+	assert.Nil(t, err)
+}
@@ -13,8 +13,9 @@ import (
 
 func CheckDestinationDirectory(restorationContext *RestorationContext) error {
 	for {
-		if restorationContext.DestinationDirPath == "" {
-			restorationContext.DestinationDirPath = inputs.QueryString("What is the destination directory path ?")
+		prompted := restorationContext.DestinationDirPath == ""
+		if prompted {
+			restorationContext.DestinationDirPath = inputs.QueryString("destination", "What is the destination directory path ?")
 		}
 		outputs.Printfln(outputs.OptionalInfo, "Destination directory path is %v", restorationContext.DestinationDirPath)
 		if stat, err := os.Stat(restorationContext.DestinationDirPath); !os.IsNotExist(err) {
@@ -27,6 +28,9 @@ func CheckDestinationDirectory(restorationContext *RestorationContext) error {
 		}
 		if err := os.MkdirAll(restorationContext.DestinationDirPath, 0700); err != nil {
 			outputs.Printfln(outputs.Error, "Cannot create destination directory %s : %v", restorationContext.DestinationDirPath, err)
+			if prompted {
+				inputs.RejectAnswer("destination")
+			}
 			restorationContext.DestinationDirPath = ""
 		} else {
 			return nil
@@ -36,10 +40,12 @@ func CheckDestinationDirectory(restorationContext *RestorationContext) error {
 
 func queryAndUpdateKeepFiles(restorationContext *RestorationContext) bool {
 	for restorationContext.Options.KeepFiles == nil {
-		if !inputs.QueryYesOrNo("Destination directory already exists, do you want to keep existing files ?", true) {
-			if inputs.QueryYesOrNo("Are you sure, all existing files restored will be deleted ?", false) {
+		if !inputs.QueryYesOrNo("keep-files", "Destination directory already exists, do you want to keep existing files ?", true) {
+			if inputs.QueryYesOrNo("delete-files", "Are you sure, all existing files restored will be deleted ?", false) {
 				tmp := false
 				restorationContext.Options.KeepFiles = &tmp
+			} else {
+				inputs.RejectAnswer("keep-files")
 			}
 		} else {
 			tmp := true
@@ -102,3 +102,62 @@ func TestCheckDestination_answer_yes_when_dest_already_exist(t *testing.T) {
 	assert.Equal(t, "Destination directory path is ../../testtmp/dest" + consts.LINE_BREAK + "Destination directory already exists, do you want to keep existing files ?[Y/n] ", string(buffer.Bytes()))
 }
 
+
+func TestCheckDestination_dest_is_answered(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	restorationContext := DefaultRestorationContext(nil)
+	restorationContext.DestinationDirPath = ""
+	inputs.CurrentPrompter = inputs.NewAnswersPrompter(map[string]interface{}{"destination": "../../testtmp/dest"}, inputs.TerminalPrompter{})
+
+	// When
+	CheckDestinationDirectory(restorationContext)
+
+	// Then
+	assert.True(t, utils.Exists("../../testtmp/dest"), "../../testtmp/dest directory should exist")
+	assert.Equal(t, "What is the destination directory path ? ../../testtmp/dest" + consts.LINE_BREAK + "Destination directory path is ../../testtmp/dest" + consts.LINE_BREAK, string(buffer.Bytes()))
+}
+
+func TestCheckDestination_answers_no_and_confirm_when_dest_already_exist(t *testing.T) {
+	// Given
+	CommonInitTest()
+	restorationContext := DefaultRestorationContext(nil)
+	os.MkdirAll("../../testtmp/dest/data", 0700)
+	inputs.CurrentPrompter = inputs.NewAnswersPrompter(map[string]interface{}{"keep-files": false, "delete-files": "y"}, inputs.FailPrompter{})
+
+	// When
+	CheckDestinationDirectory(restorationContext)
+
+	// Then
+	assert.False(t, utils.Exists("../../testtmp/dest/data"), "../../testtmp/dest/data directory should not exist")
+}
+
+func TestCheckDestination_answers_are_used_in_order_when_not_confirmed(t *testing.T) {
+	// Given
+	CommonInitTest()
+	restorationContext := DefaultRestorationContext(nil)
+	os.MkdirAll("../../testtmp/dest/data", 0700)
+	inputs.CurrentPrompter = inputs.NewAnswersPrompter(map[string]interface{}{"keep-files": []interface{}{"n", "y"}, "delete-files": "n"}, inputs.FailPrompter{})
+
+	// When
+	CheckDestinationDirectory(restorationContext)
+
+	// Then
+	assert.True(t, utils.Exists("../../testtmp/dest/data"), "../../testtmp/dest/data directory should exist")
+}
+
+func TestCheckDestination_missing_answer_is_asked_on_terminal(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	restorationContext := DefaultRestorationContext(nil)
+	os.MkdirAll("../../testtmp/dest/data", 0700)
+	inputs.CurrentPrompter = inputs.NewAnswersPrompter(map[string]interface{}{"delete-files": "y"}, inputs.TerminalPrompter{})
+	inputs.StdinReader = bufio.NewReader(bytes.NewReader([]byte("n" + consts.LINE_BREAK)))
+
+	// When
+	CheckDestinationDirectory(restorationContext)
+
+	// Then
+	assert.False(t, utils.Exists("../../testtmp/dest/data"), "../../testtmp/dest/data directory should not exist")
+	assert.Equal(t, "Destination directory path is ../../testtmp/dest" + consts.LINE_BREAK + "Destination directory already exists, do you want to keep existing files ?[Y/n] Are you sure, all existing files restored will be deleted ? y" + consts.LINE_BREAK, string(buffer.Bytes()))
+}
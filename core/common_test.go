@@ -6,6 +6,8 @@ import (
 	"time"
 	"rsg/outputs"
 	"rsg/awsutils"
+	"rsg/inputs"
+	"rsg/hooks"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/stretchr/testify/mock"
 	"github.com/aws/aws-sdk-go/service/glacier"
@@ -13,6 +15,7 @@ import (
 	"io"
 	"path/filepath"
 	"rsg/utils"
+	"github.com/aws/aws-sdk-go/aws"
 )
 
 func CommonInitTest() *bytes.Buffer {
@@ -23,9 +26,17 @@ func CommonInitTest() *bytes.Buffer {
 	os.MkdirAll("../../testtmp/cache", 0700)
 	outputs.InitOutputs(os.Stdout, buffer, buffer, buffer, os.Stderr)
 	awsutils.WaitTime = 1 * time.Nanosecond
+	awsutils.MaxPollInterval = 1 * time.Nanosecond
+	RetryMinWaitTime = 1 * time.Nanosecond
+	HomeWorkingDirPath = "../../testtmp/home"
+	LegacyWorkingDirPath = "../../testtmp/legacy"
+	legacyWorkingDirChecked = false
+	legacyWorkingDirAccountId = ""
 	awsutils.AccountId = "accountId"
-	awsutils.JobIdsAtStartup.MappingInventoryJobId = ""
-	awsutils.JobIdsAtStartup.MappingRetrievalJobId = ""
+	awsutils.ResetJobIdsAtStartup()
+	inputs.CurrentPrompter = inputs.TerminalPrompter{}
+	hooks.Wait()
+	hooks.Configure([]string{}, []string{}, 0, []string{})
 	return buffer
 }
 
@@ -105,6 +116,39 @@ func (m *GlacierMock) GetDataRetrievalPolicy(input *glacier.GetDataRetrievalPoli
 	return nil, args.Error(1)
 }
 
+func (m *GlacierMock) ListJobsPages(input *glacier.ListJobsInput, fn func(*glacier.ListJobsOutput, bool) bool) error {
+	args := m.Called(input)
+	if args.Get(0) != nil {
+		fn(args.Get(0).(*glacier.ListJobsOutput), true)
+	}
+	return args.Error(1)
+}
+
+func mockListJobs(glacierMock *GlacierMock, vault string, jobs ...*glacier.JobDescription) *mock.Call {
+	input := &glacier.ListJobsInput{
+		AccountId: aws.String(awsutils.AccountId),
+		VaultName: aws.String(vault),
+	}
+	return glacierMock.On("ListJobsPages", input).Return(&glacier.ListJobsOutput{JobList: jobs}, nil)
+}
+
+func mockListCompletedJobs(glacierMock *GlacierMock, vault string, jobs ...*glacier.JobDescription) *mock.Call {
+	input := &glacier.ListJobsInput{
+		AccountId: aws.String(awsutils.AccountId),
+		VaultName: aws.String(vault),
+		Completed: aws.String("true"),
+	}
+	return glacierMock.On("ListJobsPages", input).Return(&glacier.ListJobsOutput{JobList: jobs}, nil)
+}
+
+func mockCompletedJobs(glacierMock *GlacierMock, vault string, jobIds ...string) *mock.Call {
+	jobs := []*glacier.JobDescription{}
+	for _, jobId := range jobIds {
+		jobs = append(jobs, &glacier.JobDescription{JobId: aws.String(jobId), Completed: aws.Bool(true), StatusCode: aws.String("Succeeded")})
+	}
+	return mockListCompletedJobs(glacierMock, vault, jobs...)
+}
+
 func newReaderClosable(reader io.Reader) ReaderClosable {
 	return ReaderClosable{reader}
 }
@@ -121,3 +165,15 @@ func mockGetDataRetrievalPolicy(glacierMock *GlacierMock, accountId, strategy st
 }
 
 
+
+func mockGetDataRetrievalPolicyWithBytesPerHour(glacierMock *GlacierMock, accountId string, bytesPerHour int64) *mock.Call {
+	input := &glacier.GetDataRetrievalPolicyInput{
+		AccountId:  &accountId,
+	}
+	strategy := BYTES_PER_HOUR_STRATEGY
+	out := &glacier.GetDataRetrievalPolicyOutput{
+		Policy: &glacier.DataRetrievalPolicy{Rules: []*glacier.DataRetrievalRule{&glacier.DataRetrievalRule{Strategy: &strategy, BytesPerHour: &bytesPerHour}}},
+	}
+
+	return glacierMock.On("GetDataRetrievalPolicy", input).Return(out, nil)
+}
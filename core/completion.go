@@ -0,0 +1,241 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"rsg/awsutils"
+	"rsg/options"
+	"rsg/utils"
+)
+
+// Shell completion of commands, flags and their values.
+//
+// Completion scripts call "rsg __complete" with the words of the command line, the last one being the word to
+// complete. It works only on local files: vaults come from the cache of discovered vaults and from the
+// working directories, filters come from the downloaded mapping files.
+
+func Complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words) - 1]
+	previous := words[:len(words) - 1]
+	configureWorkingDirForCompletion(previous)
+
+	commandName := options.COMMAND_RESTORE
+	if len(previous) > 0 && utils.Contains(options.CommandNames(), previous[0]) {
+		commandName = previous[0]
+	} else if len(previous) == 0 && !strings.HasPrefix(current, "-") {
+		return filterByPrefix(options.CommandNames(), current)
+	}
+	if commandName == options.COMMAND_HELP {
+		if len(previous) == 1 {
+			return filterByPrefix(options.CommandNames(), current)
+		}
+		return []string{}
+	}
+
+	if len(previous) > 0 {
+		if flagName := options.FlagExpectingValue(commandName, previous[len(previous) - 1]); flagName != "" {
+			return completeFlagValue(flagName, current, previous)
+		}
+	}
+	if strings.HasPrefix(current, "-") {
+		if index := strings.Index(current, "="); index >= 0 {
+			flagName := options.FlagExpectingValue(commandName, current[:index])
+			if flagName == "" {
+				return []string{}
+			}
+			return prefixAll(current[:index + 1], completeFlagValue(flagName, current[index + 1:], previous))
+		}
+		return filterByPrefix(options.CommandFlags(commandName), current)
+	}
+	if arguments := options.CommandArguments(commandName); len(arguments) > 0 {
+		for _, word := range previous[1:] {
+			if utils.Contains(arguments, word) {
+				return []string{}
+			}
+		}
+		return filterByPrefix(arguments, current)
+	}
+	return []string{}
+}
+
+// --work-dir and --account-id of the command line are used to find local files
+func configureWorkingDirForCompletion(words []string) {
+	for i := 0; i < len(words) - 1; i++ {
+		if words[i] == "--work-dir" {
+			HomeWorkingDirPath = words[i + 1]
+		}
+		if words[i] == "--account-id" {
+			awsutils.AccountId = words[i + 1]
+		}
+	}
+}
+
+func completeFlagValue(flagName, current string, previous []string) []string {
+	switch flagName {
+	case "vault":
+		return completeVaults(current)
+	case "region", "regions":
+		return filterByPrefix(Regions, current)
+	case "filter":
+		return completeFilters(current, previous)
+	}
+	return filterByPrefix(options.FlagValues(flagName), current)
+}
+
+// vault names, or region:vault when the region is being typed
+func completeVaults(current string) []string {
+	vaults := []string{}
+	for _, localVault := range findCompletionVaults() {
+		if strings.Contains(current, ":") {
+			vaults = append(vaults, localVault.Region + ":" + localVault.Name)
+		} else if !utils.Contains(vaults, localVault.Name) {
+			vaults = append(vaults, localVault.Name)
+		}
+	}
+	return filterByPrefix(vaults, current)
+}
+
+// vaults of the cache of discovered vaults and vaults with a working directory, for the selected account or all of them
+func findCompletionVaults() []*SynologyCoupleVault {
+	vaults := []*SynologyCoupleVault{}
+	addVault := func(region, name string) {
+		for _, vault := range vaults {
+			if vault.Region == region && vault.Name == name {
+				return
+			}
+		}
+		vaults = append(vaults, &SynologyCoupleVault{Region: region, Name: name})
+	}
+	for _, accountDirPath := range getCompletionAccountDirPaths() {
+		if bytes, err := ioutil.ReadFile(accountDirPath + "/vaults.json"); err == nil {
+			cache := &vaultsCache{}
+			if json.Unmarshal(bytes, cache) == nil {
+				for region, regionCache := range cache.Regions {
+					for _, vault := range regionCache.Vaults {
+						addVault(region, vault.Name)
+					}
+				}
+			}
+		}
+		vaultDirPaths, _ := filepath.Glob(accountDirPath + "/*/*")
+		for _, vaultDirPath := range vaultDirPaths {
+			addVault(filepath.Base(filepath.Dir(vaultDirPath)), filepath.Base(vaultDirPath))
+		}
+	}
+	sort.SliceStable(vaults, func(i, j int) bool {
+		return vaults[i].Region + ":" + vaults[i].Name < vaults[j].Region + ":" + vaults[j].Name
+	})
+	return vaults
+}
+
+func getCompletionAccountDirPaths() []string {
+	// without GetAccountWorkingDirPath, completion never moves the working directory of previous versions
+	if awsutils.AccountId != "" {
+		return []string{GetHomeWorkingDirPath() + "/" + awsutils.AccountId}
+	}
+	accountDirPaths := []string{}
+	for _, accountId := range getAccountIds() {
+		accountDirPaths = append(accountDirPaths, GetHomeWorkingDirPath() + "/" + accountId)
+	}
+	return accountDirPaths
+}
+
+// next directory level, or file, of the paths of the mapping files of the vaults given on the command line
+func completeFilters(current string, previous []string) []string {
+	region, selectedVaults := "", []string{}
+	for i := 0; i < len(previous) - 1; i++ {
+		switch previous[i] {
+		case "--vault", "-v":
+			selectedVaults = append(selectedVaults, strings.Split(previous[i + 1], ",")...)
+		case "--region", "-r":
+			region = previous[i + 1]
+		}
+	}
+	filters := []string{}
+	for _, vault := range findCompletionVaults() {
+		if len(selectedVaults) > 0 && !isSelectedVault(vault, region, selectedVaults) {
+			continue
+		}
+		for _, accountDirPath := range getCompletionAccountDirPaths() {
+			mappingFilePath := accountDirPath + "/" + vault.Region + "/" + vault.Name + "/" + mappingFileName
+			if utils.Exists(mappingFilePath) {
+				filters = append(filters, completeMappingPaths(mappingFilePath, current)...)
+			}
+		}
+	}
+	sort.Strings(filters)
+	return removeDuplicates(filters)
+}
+
+func isSelectedVault(vault *SynologyCoupleVault, defaultRegion string, selectedVaults []string) bool {
+	for _, selectedVault := range selectedVaults {
+		region, name := parseRegionVault(defaultRegion, selectedVault)
+		if name == vault.Name && (region == "" || region == vault.Region) {
+			return true
+		}
+	}
+	return false
+}
+
+func completeMappingPaths(mappingFilePath, current string) []string {
+	paths := []string{}
+	db, err := sql.Open("sqlite3", mappingFilePath)
+	if err != nil {
+		return paths
+	}
+	defer db.Close()
+	escapedPrefix := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(current)
+	rows, err := db.Query("SELECT DISTINCT basePath FROM file_info_tb WHERE basePath LIKE ? ESCAPE '\\'", escapedPrefix + "%")
+	if err != nil {
+		return paths
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var basePath string
+		if rows.Scan(&basePath) != nil || !strings.HasPrefix(basePath, current) {
+			continue
+		}
+		if index := strings.Index(basePath[len(current):], "/"); index >= 0 {
+			paths = append(paths, basePath[:len(current) + index + 1])
+		} else {
+			paths = append(paths, basePath)
+		}
+	}
+	return paths
+}
+
+func filterByPrefix(values []string, prefix string) []string {
+	filteredValues := []string{}
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			filteredValues = append(filteredValues, value)
+		}
+	}
+	return filteredValues
+}
+
+func prefixAll(prefix string, values []string) []string {
+	prefixedValues := []string{}
+	for _, value := range values {
+		prefixedValues = append(prefixedValues, prefix + value)
+	}
+	return prefixedValues
+}
+
+// of a sorted slice
+func removeDuplicates(values []string) []string {
+	uniqueValues := []string{}
+	for i, value := range values {
+		if i == 0 || value != values[i - 1] {
+			uniqueValues = append(uniqueValues, value)
+		}
+	}
+	return uniqueValues
+}
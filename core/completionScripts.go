@@ -0,0 +1,57 @@
+package core
+
+import (
+	"errors"
+	"rsg/utils"
+)
+
+// Completion scripts of the shells, generated by "rsg completion <shell>"
+
+const bashCompletionScript = `# bash completion of rsg, load it with: source <(rsg completion bash)
+_rsg() {
+    local line="${COMP_LINE:0:COMP_POINT}" words
+    read -ra words <<< "$line"
+    [[ $line == *" " ]] && words+=("")
+    local cur="${words[${#words[@]}-1]}" IFS=$'\n'
+    COMPREPLY=($(rsg __complete "${words[@]:1}" 2>/dev/null))
+    # bash replaces only the part of the word after the last : or =
+    local prefix="${cur%"${cur##*[:=]}"}"
+    [[ -n $prefix ]] && COMPREPLY=("${COMPREPLY[@]#"$prefix"}")
+    [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]] && compopt -o nospace
+}
+complete -o default -F _rsg rsg`
+
+const zshCompletionScript = `#compdef rsg
+# zsh completion of rsg, load it with: source <(rsg completion zsh)
+_rsg() {
+    local -a completions directories others
+    completions=("${(@f)$(rsg __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    completions=(${completions:#})
+    directories=(${(M)completions:#*/})
+    others=(${completions:#*/})
+    (( ${#directories} )) && compadd -Q -S '' -- $directories
+    (( ${#others} )) && compadd -Q -- $others
+    (( ${#completions} )) || _files
+}
+compdef _rsg rsg`
+
+const fishCompletionScript = `# fish completion of rsg, load it with: rsg completion fish | source
+function __rsg_complete
+    rsg __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c rsg -f -a '(__rsg_complete)'
+complete -c rsg -s d -l destination -r -F
+complete -c rsg -l work-dir -r -F`
+
+func CompletionScript(shell string) string {
+	switch shell {
+	case "bash":
+		return bashCompletionScript
+	case "zsh":
+		return zshCompletionScript
+	case "fish":
+		return fishCompletionScript
+	}
+	utils.ExitIfError(errors.New("No completion script for shell " + shell))
+	return ""
+}
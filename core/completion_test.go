@@ -0,0 +1,107 @@
+package core
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"rsg/awsutils"
+	"rsg/options"
+)
+
+func createCompletionFiles() {
+	os.MkdirAll(GetVaultWorkingDirPath("region1", "vault1"), 0700)
+	os.MkdirAll(GetVaultWorkingDirPath("region2", "vault1"), 0700)
+	ioutil.WriteFile(GetAccountWorkingDirPath() + "/vaults.json", []byte("{\"AccountId\":\"accountId\",\"Regions\":{" +
+		"\"region2\":{\"Vaults\":[{\"Name\":\"vault2\"}]}}}"), 0600)
+	db, _ := sql.Open("sqlite3", GetVaultWorkingDirPath("region1", "vault1") + "/" + mappingFileName)
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/photos/2016/file1.jpg', 'archiveId1', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/photos/file2.jpg', 'archiveId2', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/documents/file3.txt', 'archiveId3', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data_old/file4.txt', 'archiveId4', 5);")
+	db.Close()
+}
+
+func TestComplete_commands_flags_and_arguments(t *testing.T) {
+	// Given
+	CommonInitTest()
+
+	// When
+	commands := Complete([]string{"ve"})
+	flags := Complete([]string{"jobs", "--st"})
+	arguments := Complete([]string{"cache", "p"})
+	argumentAlreadyGiven := Complete([]string{"cache", "prune", ""})
+	flagValues := Complete([]string{"jobs", "--output", ""})
+	flagValuesWithEqual := Complete([]string{"jobs", "--status=S"})
+
+	// Then
+	assert.Equal(t, []string{"verify"}, commands)
+	assert.Equal(t, []string{"--status"}, flags)
+	assert.Equal(t, []string{"prune"}, arguments)
+	assert.Equal(t, []string{}, argumentAlreadyGiven)
+	assert.Equal(t, []string{"table", "json"}, flagValues)
+	assert.Equal(t, []string{"--status=Succeeded"}, flagValuesWithEqual)
+}
+
+func TestComplete_vaults_from_cache_and_working_directories(t *testing.T) {
+	// Given
+	CommonInitTest()
+	createCompletionFiles()
+
+	// When
+	vaults := Complete([]string{"ls", "--vault", "v"})
+	regionVaults := Complete([]string{"ls", "-v", "region2:"})
+
+	// Then
+	assert.Equal(t, []string{"vault1", "vault2"}, vaults)
+	assert.Equal(t, []string{"region2:vault1", "region2:vault2"}, regionVaults)
+}
+
+func TestComplete_vaults_of_all_accounts_without_daemon_directory(t *testing.T) {
+	// Given
+	CommonInitTest()
+	createCompletionFiles()
+	os.MkdirAll(getDaemonDirPath() + "/logs", 0700)
+	awsutils.AccountId = ""
+
+	// When
+	vaults := Complete([]string{"ls", "--vault", ""})
+
+	// Then
+	assert.Equal(t, []string{"vault1", "vault2"}, vaults)
+}
+
+func TestComplete_never_moves_working_directory_of_previous_versions(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	os.MkdirAll(LegacyWorkingDirPath + "/region/vault", 0700)
+	ConfigureWorkingDir(options.Options{AccountId: "accountId"})
+
+	// When
+	vaults := Complete([]string{"ls", "--account-id", "accountId", "--vault", ""})
+
+	// Then
+	assert.Equal(t, []string{}, vaults)
+	assert.Equal(t, []string{"region"}, getSubdirectories(LegacyWorkingDirPath))
+	assert.Empty(t, buffer.String())
+}
+
+func TestComplete_filters_from_mapping_file(t *testing.T) {
+	// Given
+	CommonInitTest()
+	createCompletionFiles()
+
+	// When
+	firstLevel := Complete([]string{"restore", "--filter", "da"})
+	secondLevel := Complete([]string{"restore", "-v", "region1:vault1", "--filter", "data/p"})
+	files := Complete([]string{"restore", "--filter", "data/photos/"})
+	otherVault := Complete([]string{"restore", "-v", "vault2", "--filter", "da"})
+
+	// Then
+	assert.Equal(t, []string{"data/", "data_old/"}, firstLevel)
+	assert.Equal(t, []string{"data/photos/"}, secondLevel)
+	assert.Equal(t, []string{"data/photos/2016/", "data/photos/file2.jpg"}, files)
+	assert.Equal(t, []string{}, otherVault)
+}
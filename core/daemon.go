@@ -0,0 +1,408 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"rsg/options"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Daemon running restores submitted by "rsg ctl" on a unix socket of the working directory.
+//
+// Restores run one after the other, each one in its own "rsg restore" process without prompt, with the global
+// options of the daemon. The queue is saved in the working directory: a restore running when the daemon
+// stops is started again by the next daemon, and resumes with the jobs and the files already downloaded. A
+// paused restore is stopped the same way, and is resumed once it is queued again, as a failed restore.
+//
+// The socket is in the daemon directory, only readable by its user. Secret options of the daemon (aws
+// credentials, webhooks, smtp password) are given to the restores by environment variables, never on their
+// command line.
+
+// next to the directories of the accounts, skipped when they are listed
+const daemonDirName = "daemon"
+
+const (
+	RESTORE_QUEUED = "queued"
+	RESTORE_RUNNING = "running"
+	RESTORE_PAUSED = "paused"
+	RESTORE_FINISHED = "finished"
+	RESTORE_FAILED = "failed"
+	RESTORE_CANCELLED = "cancelled"
+)
+
+const (
+	CTL_SUBMIT = "submit"
+	CTL_LIST = "list"
+	CTL_PAUSE = "pause"
+	CTL_RESUME = "resume"
+	CTL_CANCEL = "cancel"
+)
+
+type RestoreRequest struct {
+	Region      string   `json:"region,omitempty"`
+	Vaults      []string `json:"vaults,omitempty"`
+	Filters     []string `json:"filters,omitempty"`
+	Destination string   `json:"destination"`
+}
+
+type QueuedRestore struct {
+	Id int `json:"id"`
+	RestoreRequest
+	Status    string    `json:"status"`
+	Submitted time.Time `json:"submitted"`
+	Started   time.Time `json:"started"`
+	Ended     time.Time `json:"ended"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type restoreQueue struct {
+	NextId   int              `json:"nextId"`
+	Restores []*QueuedRestore `json:"restores"`
+	filePath string
+	mutex    sync.Mutex
+	process  *os.Process // of the running restore
+	done     chan bool   // closed when the process of the running restore has exited
+	stopping bool
+	wakeUp   chan bool
+}
+
+// run the process of a restore, with its output in the log file
+var startRestoreProcess = func(queuedRestore *QueuedRestore, daemonArgs []string, logFile *os.File) (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	daemonArgs, environment := options.SplitSecretArguments(daemonArgs)
+	args := append([]string{options.COMMAND_RESTORE}, daemonArgs...)
+	args = append(args, "--no-prompt", "--info-messages=false", "--keep-files", "--refresh-mapping-file=false", "--destination", queuedRestore.Destination)
+	if queuedRestore.Region != "" {
+		args = append(args, "--region", queuedRestore.Region)
+	}
+	for _, vault := range queuedRestore.Vaults {
+		args = append(args, "--vault", vault)
+	}
+	for _, filter := range queuedRestore.Filters {
+		args = append(args, "--filter", filter)
+	}
+	command := exec.Command(executable, args...)
+	command.Env = append(os.Environ(), environment...)
+	command.Stdout = logFile
+	command.Stderr = logFile
+	return command, command.Start()
+}
+
+func GetDaemonSocketPath() string {
+	return getDaemonDirPath() + "/rsg.sock"
+}
+
+func getDaemonDirPath() string {
+	return GetHomeWorkingDirPath() + "/" + daemonDirName
+}
+
+func getRestoreLogPath(id int) string {
+	return getDaemonDirPath() + "/logs/" + strconv.Itoa(id) + ".log"
+}
+
+// daemonArgs are the global options of the daemon, given to each restore
+func RunDaemon(optionsValue options.Options, daemonArgs []string) {
+	if len(optionsValue.Vaults) > 0 || optionsValue.AllVaults {
+		utils.ExitIfError(errors.New("Vaults are given by \"rsg ctl submit\", not by the daemon"))
+	}
+	socketPath := GetDaemonSocketPath()
+	if connection, err := net.Dial("unix", socketPath); err == nil {
+		connection.Close()
+		utils.ExitIfError(errors.New("A daemon is already running on " + socketPath))
+	}
+	err := os.MkdirAll(getDaemonDirPath() + "/logs", 0700)
+	utils.ExitIfError(err)
+	// the directory may have been created with other permissions, nobody else can connect to the socket
+	err = os.Chmod(getDaemonDirPath(), 0700)
+	utils.ExitIfError(err)
+	queue := loadRestoreQueue(getDaemonDirPath() + "/queue.json")
+
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	utils.ExitIfError(err)
+	stopSignals := make(chan os.Signal, 1)
+	signal.Notify(stopSignals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		stopSignal := <-stopSignals
+		outputs.Printfln(outputs.Info, "Daemon stopped by %v", stopSignal)
+		listener.Close()
+		queue.stopRunningRestore()
+		os.Exit(0)
+	}()
+	go http.Serve(listener, queue.handler())
+	outputs.Printfln(outputs.Info, "Daemon listening on %s", socketPath)
+	queue.runRestores(daemonArgs)
+}
+
+// restores running when the previous daemon stopped are queued again
+func loadRestoreQueue(filePath string) *restoreQueue {
+	queue := &restoreQueue{NextId: 1, Restores: []*QueuedRestore{}, filePath: filePath, wakeUp: make(chan bool, 1)}
+	if content, err := ioutil.ReadFile(filePath); err == nil {
+		if err = json.Unmarshal(content, queue); err != nil {
+			utils.ExitIfError(errors.New(fmt.Sprintf("Cannot read restore queue %s: %v", filePath, err)))
+		}
+	}
+	for _, queuedRestore := range queue.Restores {
+		if queuedRestore.Status == RESTORE_RUNNING {
+			outputs.Printfln(outputs.Info, "Restore %d was running, it is queued again", queuedRestore.Id)
+			queuedRestore.Status = RESTORE_QUEUED
+		}
+	}
+	queue.save()
+	return queue
+}
+
+// the caller holds the lock
+func (queue *restoreQueue) save() {
+	content, err := json.MarshalIndent(queue, "", "  ")
+	if err == nil {
+		err = utils.WriteFileAtomically(queue.filePath, content, 0600)
+	}
+	if err != nil {
+		outputs.Printfln(outputs.Error, "Cannot save restore queue %s: %v", queue.filePath, err)
+	}
+}
+
+func (queue *restoreQueue) notify() {
+	select {
+	case queue.wakeUp <- true:
+	default:
+	}
+}
+
+func (queue *restoreQueue) submit(request RestoreRequest, now time.Time) (*QueuedRestore, error) {
+	if !filepath.IsAbs(request.Destination) {
+		return nil, errors.New("Destination must be an absolute path: " + request.Destination)
+	}
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queuedRestore := &QueuedRestore{Id: queue.NextId, RestoreRequest: request, Status: RESTORE_QUEUED, Submitted: now}
+	queue.NextId++
+	queue.Restores = append(queue.Restores, queuedRestore)
+	queue.save()
+	queue.notify()
+	restore := *queuedRestore
+	return &restore, nil
+}
+
+func (queue *restoreQueue) list() []QueuedRestore {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	restores := []QueuedRestore{}
+	for _, queuedRestore := range queue.Restores {
+		restores = append(restores, *queuedRestore)
+	}
+	return restores
+}
+
+// change the status of a restore, the running process is stopped when the restore is paused or cancelled
+func (queue *restoreQueue) changeStatus(id int, action string, now time.Time) (*QueuedRestore, error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	var queuedRestore *QueuedRestore
+	for _, restore := range queue.Restores {
+		if restore.Id == id {
+			queuedRestore = restore
+		}
+	}
+	if queuedRestore == nil {
+		return nil, errors.New(fmt.Sprintf("Restore %d not found", id))
+	}
+	previousStatus := queuedRestore.Status
+	switch {
+	case action == CTL_PAUSE && (previousStatus == RESTORE_QUEUED || previousStatus == RESTORE_RUNNING):
+		queuedRestore.Status = RESTORE_PAUSED
+	case action == CTL_RESUME && (previousStatus == RESTORE_PAUSED || previousStatus == RESTORE_FAILED):
+		queuedRestore.Status = RESTORE_QUEUED
+	case action == CTL_CANCEL && (previousStatus == RESTORE_QUEUED || previousStatus == RESTORE_RUNNING || previousStatus == RESTORE_PAUSED):
+		queuedRestore.Status = RESTORE_CANCELLED
+		queuedRestore.Ended = now
+	default:
+		return nil, errors.New(fmt.Sprintf("Restore %d is %s, it cannot be %s", id, previousStatus, describeCtlAction(action)))
+	}
+	if previousStatus == RESTORE_RUNNING && queue.process != nil {
+		queue.process.Signal(syscall.SIGTERM)
+	}
+	queue.save()
+	queue.notify()
+	restore := *queuedRestore
+	return &restore, nil
+}
+
+func describeCtlAction(action string) string {
+	switch action {
+	case CTL_PAUSE:
+		return "paused"
+	case CTL_RESUME:
+		return "resumed"
+	}
+	return "cancelled"
+}
+
+func (queue *restoreQueue) nextQueuedRestore() *QueuedRestore {
+	for _, queuedRestore := range queue.Restores {
+		if queuedRestore.Status == RESTORE_QUEUED {
+			return queuedRestore
+		}
+	}
+	return nil
+}
+
+// the restore stays running in the queue, to be started again by the next daemon. runRestore waits for the
+// process, this waits until runRestore has seen it exit
+func (queue *restoreQueue) stopRunningRestore() {
+	queue.mutex.Lock()
+	queue.stopping = true
+	done := queue.done
+	if queue.process != nil {
+		queue.process.Signal(syscall.SIGTERM)
+	}
+	queue.mutex.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (queue *restoreQueue) runRestores(daemonArgs []string) {
+	for {
+		queue.mutex.Lock()
+		queuedRestore := queue.nextQueuedRestore()
+		queue.mutex.Unlock()
+		if queuedRestore == nil {
+			<-queue.wakeUp
+			continue
+		}
+		queue.runRestore(queuedRestore, daemonArgs)
+	}
+}
+
+func (queue *restoreQueue) runRestore(queuedRestore *QueuedRestore, daemonArgs []string) {
+	queue.mutex.Lock()
+	outputs.Printfln(outputs.Info, "Start restore %d of %s to %s", queuedRestore.Id, strings.Join(queuedRestore.Vaults, ", "), queuedRestore.Destination)
+	queuedRestore.Status = RESTORE_RUNNING
+	queuedRestore.Started = time.Now()
+	queuedRestore.Error = ""
+	queue.save()
+	logFile, err := os.OpenFile(getRestoreLogPath(queuedRestore.Id), os.O_CREATE | os.O_WRONLY | os.O_APPEND, 0600)
+	var command *exec.Cmd
+	if err == nil {
+		command, err = startRestoreProcess(queuedRestore, daemonArgs, logFile)
+	}
+	done := make(chan bool)
+	if err == nil {
+		queue.process = command.Process
+		queue.done = done
+	}
+	queue.mutex.Unlock()
+
+	if err == nil {
+		err = command.Wait()
+	}
+	if logFile != nil {
+		logFile.Close()
+	}
+
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	defer close(done)
+	queue.process = nil
+	queue.done = nil
+	if queue.stopping {
+		return
+	}
+	// paused or cancelled while running
+	if queuedRestore.Status != RESTORE_RUNNING {
+		outputs.Printfln(outputs.Info, "Restore %d is %s", queuedRestore.Id, queuedRestore.Status)
+		queuedRestore.Ended = time.Now()
+		queue.save()
+		return
+	}
+	queuedRestore.Ended = time.Now()
+	if err != nil {
+		queuedRestore.Status = RESTORE_FAILED
+		queuedRestore.Error = lastErrorOfLog(getRestoreLogPath(queuedRestore.Id), err)
+		outputs.Printfln(outputs.Warning, "Restore %d failed: %s", queuedRestore.Id, queuedRestore.Error)
+	} else {
+		queuedRestore.Status = RESTORE_FINISHED
+		outputs.Printfln(outputs.Info, "Restore %d is finished", queuedRestore.Id)
+	}
+	queue.save()
+}
+
+// last error displayed by the restore, else the error of its process
+func lastErrorOfLog(logPath string, err error) string {
+	lastError := err.Error()
+	if logFile, openErr := os.Open(logPath); openErr == nil {
+		defer logFile.Close()
+		scanner := bufio.NewScanner(logFile)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "ERROR: ") {
+				lastError = strings.TrimPrefix(scanner.Text(), "ERROR: ")
+			}
+		}
+	}
+	return lastError
+}
+
+// GET /restores, POST /restores, POST /restores/<id>/<pause|resume|cancel>
+func (queue *restoreQueue) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/restores", func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			writeJson(writer, queue.list(), nil)
+		case http.MethodPost:
+			restoreRequest := RestoreRequest{}
+			if err := json.NewDecoder(request.Body).Decode(&restoreRequest); err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			queuedRestore, err := queue.submit(restoreRequest, time.Now())
+			writeJson(writer, queuedRestore, err)
+		default:
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/restores/", func(writer http.ResponseWriter, request *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(request.URL.Path, "/restores/"), "/")
+		if request.Method != http.MethodPost || len(parts) != 2 {
+			http.NotFound(writer, request)
+			return
+		}
+		id, err := strconv.Atoi(parts[0])
+		if err != nil || !utils.Contains([]string{CTL_PAUSE, CTL_RESUME, CTL_CANCEL}, parts[1]) {
+			http.NotFound(writer, request)
+			return
+		}
+		queuedRestore, err := queue.changeStatus(id, parts[1], time.Now())
+		writeJson(writer, queuedRestore, err)
+	})
+	return mux
+}
+
+func writeJson(writer http.ResponseWriter, value interface{}, err error) {
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(value)
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"rsg/options"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Client of the daemon, "rsg ctl" submits, lists, pauses, resumes and cancels restores on its unix socket
+
+func RunCtl(optionsValue options.Options) {
+	client := newDaemonClient(GetDaemonSocketPath())
+	switch action := optionsValue.CommandArgs[0]; action {
+	case CTL_SUBMIT:
+		destination := optionsValue.Dest
+		if destination == "" {
+			utils.ExitIfError(errors.New("--destination is needed to submit a restore"))
+		}
+		destination, err := filepath.Abs(destination)
+		utils.ExitIfError(err)
+		request := RestoreRequest{Region: optionsValue.Region, Vaults: optionsValue.Vaults, Filters: optionsValue.Filters, Destination: destination}
+		queuedRestore := &QueuedRestore{}
+		callDaemon(client, http.MethodPost, "/restores", request, queuedRestore)
+		outputs.Printfln(outputs.Info, "Restore %d submitted, log: %s", queuedRestore.Id, getRestoreLogPath(queuedRestore.Id))
+	case CTL_LIST:
+		restores := []QueuedRestore{}
+		callDaemon(client, http.MethodGet, "/restores", nil, &restores)
+		DisplayQueuedRestores(restores, optionsValue.Output, time.Now())
+	default:
+		id, err := strconv.Atoi(optionsValue.CommandArgs[1])
+		if err != nil {
+			utils.ExitIfError(errors.New("Invalid restore id: " + optionsValue.CommandArgs[1]))
+		}
+		queuedRestore := &QueuedRestore{}
+		callDaemon(client, http.MethodPost, fmt.Sprintf("/restores/%d/%s", id, action), nil, queuedRestore)
+		outputs.Printfln(outputs.Info, "Restore %d is %s", queuedRestore.Id, queuedRestore.Status)
+	}
+}
+
+func newDaemonClient(socketPath string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", socketPath)
+		},
+	}}
+}
+
+func callDaemon(client *http.Client, method, path string, body interface{}, result interface{}) {
+	var requestBody []byte
+	if body != nil {
+		var err error
+		requestBody, err = json.Marshal(body)
+		utils.ExitIfError(err)
+	}
+	request, err := http.NewRequest(method, "http://rsg" + path, bytes.NewReader(requestBody))
+	utils.ExitIfError(err)
+	response, err := client.Do(request)
+	if err != nil {
+		utils.ExitIfError(errors.New(fmt.Sprintf("Daemon is not running on %s, start it with \"rsg daemon\"", GetDaemonSocketPath())))
+	}
+	defer response.Body.Close()
+	content, err := ioutil.ReadAll(response.Body)
+	utils.ExitIfError(err)
+	if response.StatusCode != http.StatusOK {
+		utils.ExitIfError(errors.New(strings.TrimSpace(string(content))))
+	}
+	utils.ExitIfError(json.Unmarshal(content, result))
+}
+
+func DisplayQueuedRestores(restores []QueuedRestore, output string, now time.Time) {
+	if output == options.OUTPUT_JSON {
+		content, err := json.MarshalIndent(restores, "", "  ")
+		utils.ExitIfError(err)
+		outputs.Println(outputs.Info, string(content))
+		return
+	}
+	buffer := new(bytes.Buffer)
+	writer := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tSTATUS\tVAULTS\tFILTERS\tDESTINATION\tSUBMITTED\tDURATION\tERROR")
+	for _, restore := range restores {
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", restore.Id, restore.Status, describeRestoreVaults(restore),
+			strings.Join(restore.Filters, ","), restore.Destination, restore.Submitted.Local().Format("2006-01-02 15:04"),
+			describeRestoreDuration(restore, now), restore.Error)
+	}
+	writer.Flush()
+	outputs.Printfln(outputs.Info, "%s", strings.TrimSuffix(buffer.String(), "\n"))
+}
+
+func describeRestoreVaults(restore QueuedRestore) string {
+	vaults := strings.Join(restore.Vaults, ",")
+	if vaults == "" {
+		vaults = "-"
+	}
+	if restore.Region != "" {
+		return restore.Region + ":" + vaults
+	}
+	return vaults
+}
+
+// duration of the last run
+func describeRestoreDuration(restore QueuedRestore, now time.Time) string {
+	if restore.Started.IsZero() {
+		return "-"
+	}
+	if restore.Status == RESTORE_RUNNING {
+		return now.Sub(restore.Started).Truncate(time.Minute).String()
+	}
+	if restore.Ended.Before(restore.Started) {
+		return "-"
+	}
+	return restore.Ended.Sub(restore.Started).Truncate(time.Minute).String()
+}
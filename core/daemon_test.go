@@ -0,0 +1,162 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+)
+
+func initTestDaemon(script string) *restoreQueue {
+	os.MkdirAll(getDaemonDirPath() + "/logs", 0700)
+	startRestoreProcess = func(queuedRestore *QueuedRestore, daemonArgs []string, logFile *os.File) (*exec.Cmd, error) {
+		command := exec.Command("sh", "-c", script)
+		command.Stdout = logFile
+		command.Stderr = logFile
+		return command, command.Start()
+	}
+	return loadRestoreQueue(getDaemonDirPath() + "/queue.json")
+}
+
+func TestDaemon_run_submitted_restore(t *testing.T) {
+	// Given
+	CommonInitTest()
+	queue := initTestDaemon("echo restored")
+	queuedRestore, err := queue.submit(RestoreRequest{Vaults: []string{"vault"}, Destination: "/tmp/dest"}, time.Now())
+	assert.Nil(t, err)
+
+	// When
+	queue.runRestore(queue.nextQueuedRestore(), []string{})
+
+	// Then
+	restores := queue.list()
+	assert.Equal(t, 1, len(restores))
+	assert.Equal(t, queuedRestore.Id, restores[0].Id)
+	assert.Equal(t, RESTORE_FINISHED, restores[0].Status)
+	assert.Nil(t, queue.nextQueuedRestore())
+	content, _ := ioutil.ReadFile(getRestoreLogPath(queuedRestore.Id))
+	assert.Equal(t, "restored\n", string(content))
+}
+
+func TestDaemon_failed_restore_has_last_error_of_its_log(t *testing.T) {
+	// Given
+	CommonInitTest()
+	queue := initTestDaemon("echo 'ERROR: first'; echo 'ERROR: no credentials'; exit 1")
+	queue.submit(RestoreRequest{Vaults: []string{"vault"}, Destination: "/tmp/dest"}, time.Now())
+
+	// When
+	queue.runRestore(queue.nextQueuedRestore(), []string{})
+
+	// Then
+	restores := queue.list()
+	assert.Equal(t, RESTORE_FAILED, restores[0].Status)
+	assert.Equal(t, "no credentials", restores[0].Error)
+}
+
+func TestDaemon_running_restore_is_queued_again_after_restart(t *testing.T) {
+	// Given
+	CommonInitTest()
+	queue := initTestDaemon("exit 0")
+	queue.submit(RestoreRequest{Vaults: []string{"vault1"}, Destination: "/tmp/dest1"}, time.Now())
+	queue.submit(RestoreRequest{Vaults: []string{"vault2"}, Destination: "/tmp/dest2"}, time.Now())
+	queue.Restores[0].Status = RESTORE_RUNNING
+	queue.save()
+
+	// When
+	queue = loadRestoreQueue(getDaemonDirPath() + "/queue.json")
+
+	// Then
+	restores := queue.list()
+	assert.Equal(t, 2, len(restores))
+	assert.Equal(t, RESTORE_QUEUED, restores[0].Status)
+	assert.Equal(t, []string{"vault1"}, restores[0].Vaults)
+	assert.Equal(t, RESTORE_QUEUED, restores[1].Status)
+	assert.Equal(t, 3, queue.NextId)
+}
+
+func TestDaemon_pause_resume_and_cancel_restores(t *testing.T) {
+	// Given
+	CommonInitTest()
+	queue := initTestDaemon("exit 0")
+	queue.submit(RestoreRequest{Destination: "/tmp/dest1"}, time.Now())
+	queue.submit(RestoreRequest{Destination: "/tmp/dest2"}, time.Now())
+
+	// When
+	_, pauseErr := queue.changeStatus(1, CTL_PAUSE, time.Now())
+	nextRestoreWhenPaused := queue.nextQueuedRestore()
+	_, resumeErr := queue.changeStatus(1, CTL_RESUME, time.Now())
+	_, cancelErr := queue.changeStatus(2, CTL_CANCEL, time.Now())
+	_, resumeCancelledErr := queue.changeStatus(2, CTL_RESUME, time.Now())
+	_, notFoundErr := queue.changeStatus(3, CTL_CANCEL, time.Now())
+
+	// Then
+	assert.Nil(t, pauseErr)
+	assert.Equal(t, 2, nextRestoreWhenPaused.Id)
+	assert.Nil(t, resumeErr)
+	assert.Nil(t, cancelErr)
+	assert.EqualError(t, resumeCancelledErr, "Restore 2 is cancelled, it cannot be resumed")
+	assert.EqualError(t, notFoundErr, "Restore 3 not found")
+	restores := queue.list()
+	assert.Equal(t, RESTORE_QUEUED, restores[0].Status)
+	assert.Equal(t, RESTORE_CANCELLED, restores[1].Status)
+}
+
+func TestDaemon_submit_and_list_restores_by_api(t *testing.T) {
+	// Given
+	CommonInitTest()
+	queue := initTestDaemon("exit 0")
+	server := httptest.NewServer(queue.handler())
+	defer server.Close()
+
+	// When
+	submitResponse, _ := http.Post(server.URL + "/restores", "application/json", bytes.NewReader([]byte(`{"vaults":["vault"],"filters":["photos/*"],"destination":"/tmp/dest"}`)))
+	relativeResponse, _ := http.Post(server.URL + "/restores", "application/json", bytes.NewReader([]byte(`{"destination":"dest"}`)))
+	listResponse, _ := http.Get(server.URL + "/restores")
+
+	// Then
+	assert.Equal(t, http.StatusOK, submitResponse.StatusCode)
+	assert.Equal(t, http.StatusBadRequest, relativeResponse.StatusCode)
+	restores := []QueuedRestore{}
+	json.NewDecoder(listResponse.Body).Decode(&restores)
+	assert.Equal(t, 1, len(restores))
+	assert.Equal(t, RestoreRequest{Vaults: []string{"vault"}, Filters: []string{"photos/*"}, Destination: "/tmp/dest"}, restores[0].RestoreRequest)
+	assert.Equal(t, RESTORE_QUEUED, restores[0].Status)
+}
+
+func TestDaemon_stop_running_restore_waits_for_its_process(t *testing.T) {
+	// Given
+	CommonInitTest()
+	queue := initTestDaemon("trap 'exit 1' TERM; sleep 10 & wait")
+	queue.submit(RestoreRequest{Vaults: []string{"vault"}, Destination: "/tmp/dest"}, time.Now())
+	restoreEnded := make(chan bool)
+	go func() {
+		queue.runRestore(queue.nextQueuedRestore(), []string{})
+		close(restoreEnded)
+	}()
+	for started := false; !started; time.Sleep(10 * time.Millisecond) {
+		queue.mutex.Lock()
+		started = queue.process != nil
+		queue.mutex.Unlock()
+	}
+
+	// When
+	start := time.Now()
+	queue.stopRunningRestore()
+	stopDuration := time.Since(start)
+
+	// Then
+	assert.True(t, stopDuration < 5 * time.Second, "stopped in %s", stopDuration)
+	select {
+	case <-restoreEnded:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "restore is not ended")
+	}
+	restores := loadRestoreQueue(getDaemonDirPath() + "/queue.json").list()
+	assert.Equal(t, RESTORE_QUEUED, restores[0].Status)
+}
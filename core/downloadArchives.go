@@ -6,14 +6,16 @@ import (
 	"rsg/utils"
 	"rsg/awsutils"
 	"rsg/outputs"
-	"container/list"
 	"path/filepath"
 	"errors"
+	"fmt"
 	"time"
 	"code.cloudfoundry.org/bytefmt"
 	"strings"
 	"rsg/inputs"
 	"rsg/speedtest"
+	"rsg/options"
+	"rsg/hooks"
 )
 
 // Test connection speed then computes how many bytes to retrieve with aws jobs for a duration of 4 hours.
@@ -22,7 +24,17 @@ import (
 // hours of bytes to download.
 // Finally, we wait next completed jobs, and over and over...
 //
-// If rate limit is reached, and nothing to download we wait 5 minutes before to retry 
+// The buffer and the bytes requested by hours are capped by the data retrieval policy of the account (see
+// retrievalBudget), so PolicyEnforcedException should only happen with a FreeTier or None strategy.
+//
+// If rate limit is reached, and nothing to download we wait until the retrieval budget estimates that
+// enough capacity has been freed (see retrievalBudget.nextAttempt)
+//
+// Retrieval jobs and downloads can be restricted to time of day windows (see downloadWindows.go)
+//
+// Completed jobs are found by sweeping the completed jobs of the vault (see awsutils.JobPoller), and the
+// first part whose job is completed is downloaded first, the parts of a same archive keep their order. The
+// parts waiting for their job or their download are kept on disk (see partQueue.go).
 
 type archiveRetrieve struct {
 	archiveId               string
@@ -39,15 +51,21 @@ func (archiveRetrieve *archiveRetrieve) retrieveIsComplete() bool {
 }
 
 type archivePartRetrieve struct {
+	key                  int64 // in the part queue
 	jobId                string
 	archiveId            string
+	retrievalByteIndex   uint64 // first byte of the retrieved range
 	retrievedSize        uint64
 	archiveSize          uint64
 	nextByteIndexToWrite uint64
+	creationDate         time.Time // of the job, zero if unknown
+	completionDate       time.Time
+	failedJobIds         []string // previous jobs of the range
+	failureMessage       string // of the last failed job
 }
 
-// + 10 is safety margin
-const archiveRetrieveStructSize = 92 + 138 + 8 + 8 + 8 + 10
+// the part queue is on disk, it only bounds the size of the state file
+const partQueueMaxSize = 10 * 1000 * 1000
 const _4hoursInSeconds = 60 * 60 * 4
 const _5minInSeconds = 60 * 5
 
@@ -68,40 +86,63 @@ type DownloadContext struct {
 	nbBytesDownloaded               uint64
 	archivesRetrievalMaxSize        uint64 // max number of bytes to retrieve
 	archivesRetrievalSize           uint64
-	archivePartRetrievalListMaxSize int // max number of elements in the list
-	archivePartRetrieveList         *list.List
+	partQueueMaxSize                int // max number of parts in the queue
+	partQueue                       *partQueue
 	hasArchiveRows                  bool
 	db                              *sql.DB
 	archiveRows                     *sql.Rows
 	uncompletedRetrieve             *archiveRetrieve
 	uncompletedDownload             *archivePartRetrieve
 	nextByteIndexToDownload         uint64
+	retrievalBudget                 *retrievalBudget
+	jobPoller                       *awsutils.JobPoller
+	failedArchives                  []FailedArchive
 }
 
 func (downloadContext *DownloadContext) archivesRetrievingSizeLeft() uint64 {
-	return downloadContext.archivesRetrievalMaxSize - downloadContext.archivesRetrievalSize
+	sizeLeft := downloadContext.archivesRetrievalMaxSize - downloadContext.archivesRetrievalSize
+	if downloadableSize := downloadContext.downloadableSizeBeforeExpiry(time.Now()); downloadableSize < downloadContext.archivesRetrievalMaxSize {
+		if downloadableSize <= downloadContext.archivesRetrievalSize {
+			return 0
+		}
+		sizeLeft = downloadableSize - downloadContext.archivesRetrievalSize
+	}
+	if budgetSizeLeft := downloadContext.retrievalBudget.sizeLeft(time.Now()); budgetSizeLeft < sizeLeft {
+		return budgetSizeLeft
+	}
+	return sizeLeft
 }
 
-func DownloadArchives(restorationContext *RestorationContext) {
+// return false if some archives cannot be restored (see failedJobs.go)
+func DownloadArchives(restorationContext *RestorationContext) bool {
 	downloadContext := new(DownloadContext)
 	downloadContext.restorationContext = restorationContext
 	downloadContext.speedAutoUpdate = true
-	downloadContext.archivePartRetrievalListMaxSize = utils.S_1GB / archiveRetrieveStructSize
+	downloadContext.partQueueMaxSize = partQueueMaxSize
 	if downloadContext.speedInBytesBySec == 0 {
-		downloadContext.speedInBytesBySec = detectOrSelectDownloadSpeed()
+		downloadContext.speedInBytesBySec = detectOrSelectDownloadSpeed(restorationContext)
+	}
+	if awsutils.DownloadLimiter.IsLimited() {
+		downloadContext.speedInBytesBySec = awsutils.DownloadLimiter.CapSpeed(downloadContext.speedInBytesBySec, time.Now())
+		outputs.Printfln(outputs.OptionalInfo, "Download speed capped to : %v", bytefmt.ByteSize(downloadContext.speedInBytesBySec))
 	}
 	downloadContext.archivesRetrievalMaxSize = downloadContext.speedInBytesBySec * uint64(_4hoursInSeconds)
-	downloadContext.downloadArchives()
+	return downloadContext.downloadArchives()
 }
 
-func detectOrSelectDownloadSpeed() uint64 {
-	downloadSpeed, err := speedtest.SpeedTest()
+func detectOrSelectDownloadSpeed(restorationContext *RestorationContext) uint64 {
+	if downloadSpeed := getGivenOrMeasuredDownloadSpeed(restorationContext); downloadSpeed != 0 {
+		outputs.Printfln(outputs.OptionalInfo, "Download speed used : %v", bytefmt.ByteSize(downloadSpeed))
+		return downloadSpeed
+	}
+	downloadSpeed, err := speedtest.SpeedTest(restorationContext.Options.SpeedTestUrl)
 	if err != nil {
 		outputs.Printfln(outputs.Error, "Cannot test download speed : %v", err)
 		for downloadSpeed == 0 || err != nil {
-			downloadSpeed, err = bytefmt.ToBytes(inputs.QueryString("Select your download speed by second (ex 10K, 256K, 1M, 10M):"))
+			downloadSpeed, err = bytefmt.ToBytes(inputs.QueryString("download-speed", "Select your download speed by second (ex 10K, 256K, 1M, 10M):"))
 			if err != nil {
 				outputs.Printfln(outputs.Error, "%v", err)
+				inputs.RejectAnswer("download-speed")
 			}
 		}
 	}
@@ -109,8 +150,27 @@ func detectOrSelectDownloadSpeed() uint64 {
 	return downloadSpeed
 }
 
-func (downloadContext *DownloadContext) downloadArchives() {
+func getGivenOrMeasuredDownloadSpeed(restorationContext *RestorationContext) uint64 {
+	if restorationContext.Options.Speed != 0 {
+		return restorationContext.Options.Speed
+	}
+	if restorationContext.Options.SpeedTestMode == options.SPEED_TEST_GLACIER {
+		if restorationContext.BytesBySecond != 0 {
+			outputs.Println(outputs.Verbose, "Use download speed measured on mapping archive")
+			return restorationContext.BytesBySecond
+		}
+		if restorationContext.RegionVaultCache.DownloadSpeed != 0 {
+			outputs.Println(outputs.Verbose, "Use download speed measured on a previous run")
+			return restorationContext.RegionVaultCache.DownloadSpeed
+		}
+		outputs.Println(outputs.OptionalInfo, "No download speed measured on glacier yet, test it on the web")
+	}
+	return 0
+}
+
+func (downloadContext *DownloadContext) downloadArchives() bool {
 	DisplayWarnIfNotFreeTier(downloadContext.restorationContext)
+	downloadContext.loadRetrievalBudget()
 	if (downloadContext.archivesRetrievalMaxSize < utils.S_1MB) {
 		utils.ExitIfError(errors.New("Max archives retrieving size cannot be less than 1MB"))
 	}
@@ -126,25 +186,70 @@ func (downloadContext *DownloadContext) downloadArchives() {
 	downloadContext.nbBytesToDownload = GetTotalSize(db, downloadContext.restorationContext.Options.Filters)
 	outputs.Printfln(outputs.OptionalInfo, "%v to restore", bytefmt.ByteSize(downloadContext.nbBytesToDownload))
 
-	downloadContext.archivePartRetrieveList = list.New()
+	partQueue := openPartQueue(downloadContext.restorationContext.GetStateFilePath())
+	downloadContext.partQueue = partQueue
+	defer partQueue.close()
 	downloadContext.archivesRetrievalSize = 0
 	downloadContext.hasArchiveRows = true
 
 	lastArchiveRetrieveResult := STARTED
+	downloadWindowIsOpen := false
 
 	for !downloadContext.allFilesHasBeenProcessed() {
-		if (lastArchiveRetrieveResult == RETRY && downloadContext.uncompletedDownload == nil) {
-			downloadContext.displayStatus("rate limit reached, waiting")
-			time.Sleep(5 * time.Minute)
+		downloadContext.waitUntilRetrievalOrDownloadIsPossible(lastArchiveRetrieveResult)
+		options := downloadContext.restorationContext.Options
+		if isInWindow(options.RetrievalWindow, time.Now()) {
+			lastArchiveRetrieveResult = downloadContext.startArchiveRetrievingJobs()
+		}
+		if isInWindow(options.DownloadWindow, time.Now()) {
+			if !downloadWindowIsOpen && options.DownloadWindow != nil {
+				downloadContext.prioritizeExpiringParts()
+			}
+			downloadWindowIsOpen = true
+			downloadContext.downloadArchivesPartWhenReady()
+		} else {
+			downloadWindowIsOpen = false
 		}
-		lastArchiveRetrieveResult = downloadContext.startArchiveRetrievingJobs()
-		downloadContext.downloadArchivesPartWhenReady()
+	}
+	downloadContext.writeFailureReport()
+	finishedEvent := hooks.Event{Event: hooks.EVENT_RESTORE_FINISHED, Size: downloadContext.nbBytesToDownload}
+	if len(downloadContext.failedArchives) > 0 {
+		finishedEvent.Error = fmt.Sprintf("%v archives cannot be restored", len(downloadContext.failedArchives))
+	}
+	downloadContext.fireEvent(finishedEvent)
+	return len(downloadContext.failedArchives) == 0
+}
+
+func (downloadContext *DownloadContext) fireEvent(event hooks.Event) {
+	event.Region = downloadContext.restorationContext.Region
+	event.Vault = downloadContext.restorationContext.Vault
+	event.Destination = downloadContext.restorationContext.DestinationDirPath
+	hooks.Fire(event)
+}
+
+func (downloadContext *DownloadContext) loadRetrievalBudget() {
+	restorationContext := downloadContext.restorationContext
+	if downloadContext.retrievalBudget == nil {
+		downloadContext.retrievalBudget = restorationContext.sharedRetrievalBudgets[restorationContext.Region]
+	}
+	if downloadContext.retrievalBudget == nil {
+		policy := awsutils.GetDataRetrievalPolicy(restorationContext.GlacierClient)
+		downloadContext.retrievalBudget = newRetrievalBudget(policy)
+		if restorationContext.sharedRetrievalBudgets != nil {
+			restorationContext.sharedRetrievalBudgets[restorationContext.Region] = downloadContext.retrievalBudget
+		}
+	}
+	if downloadContext.retrievalBudget.hasLimit() {
+		downloadContext.archivesRetrievalMaxSize = downloadContext.retrievalBudget.capRetrievalMaxSize(downloadContext.archivesRetrievalMaxSize)
+		outputs.Printfln(outputs.OptionalInfo, "Retrieval limited by data retrieval policy to %v/h, retrieval buffer: %v",
+			bytefmt.ByteSize(downloadContext.retrievalBudget.policy.BytesPerHour),
+			bytefmt.ByteSize(downloadContext.archivesRetrievalMaxSize))
 	}
 }
 
 func (downloadContext *DownloadContext) allFilesHasBeenProcessed() bool {
 	return !downloadContext.hasArchiveRows &&
-		downloadContext.archivePartRetrieveList.Len() == 0 &&
+		downloadContext.partQueue.len() == 0 &&
 		downloadContext.uncompletedRetrieve == nil &&
 		downloadContext.uncompletedDownload == nil
 }
@@ -152,7 +257,7 @@ func (downloadContext *DownloadContext) allFilesHasBeenProcessed() bool {
 func (downloadContext *DownloadContext) startArchiveRetrievingJobs() ArchiveRetrieveResult {
 	lastArchiveRetrieveResult := STARTED
 	for downloadContext.archivesRetrievalSize < downloadContext.archivesRetrievalMaxSize &&
-		downloadContext.archivePartRetrieveList.Len() < downloadContext.archivePartRetrievalListMaxSize &&
+		downloadContext.partQueue.len() < downloadContext.partQueueMaxSize &&
 		(downloadContext.hasArchiveRows || downloadContext.uncompletedRetrieve != nil) {
 		downloadContext.displayStatus("start retrieve jobs")
 		if downloadContext.uncompletedRetrieve == nil {
@@ -245,7 +350,8 @@ func (downloadContext *DownloadContext) computeSizeToRetrieve(archiveToRetrieve
 func (downloadContext *DownloadContext) startArchivePartRetrieveJob(archiveToRetrieve *archiveRetrieve) ArchiveRetrieveResult {
 	sizeToRetrieve, isEndOfFile := downloadContext.computeSizeToRetrieve(downloadContext.uncompletedRetrieve)
 	if (isEndOfFile || sizeToRetrieve / utils.S_1MB > 0) {
-		startStatus, jobId, sizeRetrieved := downloadContext.retryArchivePartRetrieveJob(archiveToRetrieve, sizeToRetrieve)
+		startStatus, jobStartStatus := downloadContext.retryArchivePartRetrieveJob(archiveToRetrieve, sizeToRetrieve)
+		jobId, sizeRetrieved := jobStartStatus.JobId, jobStartStatus.SizeRetrieved
 		if startStatus == STARTED || startStatus == IN_PROGRESS {
 			statusStr := ""
 			if startStatus == STARTED {
@@ -260,12 +366,19 @@ func (downloadContext *DownloadContext) startArchivePartRetrieveJob(archiveToRet
 				archiveToRetrieve.nextByteIndexToRetrieve)
 			archivePartRetrieve := &archivePartRetrieve{jobId: jobId,
 				archiveId: archiveToRetrieve.archiveId,
+				retrievalByteIndex: archiveToRetrieve.nextByteIndexToRetrieve,
 				retrievedSize: sizeRetrieved,
 				archiveSize: archiveToRetrieve.size,
-				nextByteIndexToWrite: archiveToRetrieve.nextByteIndexToRetrieve}
+				nextByteIndexToWrite: archiveToRetrieve.nextByteIndexToRetrieve,
+				creationDate: jobStartStatus.CreationDate,
+				completionDate: jobStartStatus.CompletionDate}
+			if startStatus == STARTED {
+				downloadContext.retrievalBudget.record(time.Now(), sizeRetrieved)
+				downloadContext.fireEvent(hooks.Event{Event: hooks.EVENT_JOB_STARTED, JobId: jobId, ArchiveId: archiveToRetrieve.archiveId, Size: sizeRetrieved})
+			}
 			archiveToRetrieve.nextByteIndexToRetrieve += sizeRetrieved
 			downloadContext.archivesRetrievalSize += sizeRetrieved
-			downloadContext.archivePartRetrieveList.PushFront(archivePartRetrieve)
+			downloadContext.partQueue.push(archivePartRetrieve)
 			downloadContext.handleArchiveRetrieveCompletion(archiveToRetrieve)
 		}
 		return startStatus
@@ -273,26 +386,28 @@ func (downloadContext *DownloadContext) startArchivePartRetrieveJob(archiveToRet
 	return RETRY
 }
 
-func (downloadContext *DownloadContext) retryArchivePartRetrieveJob(archiveToRetrieve *archiveRetrieve, sizeToRetrieve uint64) (ArchiveRetrieveResult, string, uint64) {
+func (downloadContext *DownloadContext) retryArchivePartRetrieveJob(archiveToRetrieve *archiveRetrieve, sizeToRetrieve uint64) (ArchiveRetrieveResult, awsutils.JobStartStatus) {
 
 	for {
 		jobStartStatus := awsutils.StartRetrievePartialArchiveJob(downloadContext.restorationContext.GlacierClient,
 			downloadContext.restorationContext.Vault,
-			awsutils.Archive{archiveToRetrieve.archiveId, archiveToRetrieve.size},
+			awsutils.Archive{ArchiveId: archiveToRetrieve.archiveId, Size: archiveToRetrieve.size},
 			archiveToRetrieve.nextByteIndexToRetrieve,
 			sizeToRetrieve)
 		if jobStartStatus.Err == nil {
 			if jobStartStatus.IsResumed {
-				return IN_PROGRESS, jobStartStatus.JobId, jobStartStatus.SizeRetrieved
+				return IN_PROGRESS, jobStartStatus
 			}
-			return STARTED, jobStartStatus.JobId, jobStartStatus.SizeRetrieved
+			return STARTED, jobStartStatus
 		}
 		if strings.Contains(jobStartStatus.Err.Error(), "PolicyEnforcedException") {
-				return RETRY, "", 0
+			downloadContext.retrievalBudget.recordPolicyEnforced(time.Now())
+			return RETRY, awsutils.JobStartStatus{}
 		} else if strings.Contains(jobStartStatus.Err.Error(), "ResourceNotFoundException") {
 			outputs.Printfln(outputs.Warning, "Archive not found %s, skipped...", archiveToRetrieve.archiveId)
+			downloadContext.fireEvent(hooks.Event{Event: hooks.EVENT_ARCHIVE_SKIPPED, ArchiveId: archiveToRetrieve.archiveId, Size: archiveToRetrieve.size, Error: "archive not found"})
 			downloadContext.uncompletedRetrieve = nil
-			return SKIPPED, "", 0
+			return SKIPPED, awsutils.JobStartStatus{}
 		} else {
 			utils.ExitIfError(jobStartStatus.Err)
 		}
@@ -311,10 +426,18 @@ func (downloadContext *DownloadContext) downloadArchivesPartWhenReady() {
 	var archivesDownloadingSize uint64 = 0
 	totalDuration := time.Duration(0)
 
-	for archivesDownloadingSize < maxArchivesDownloadingSize && (downloadContext.archivePartRetrieveList.Len() > 0 || downloadContext.uncompletedDownload != nil) {
-		if (downloadContext.uncompletedDownload == nil && downloadContext.archivePartRetrieveList.Len() > 0) {
+	for archivesDownloadingSize < maxArchivesDownloadingSize && (downloadContext.partQueue.len() > 0 || downloadContext.uncompletedDownload != nil) {
+		if (downloadContext.uncompletedDownload == nil && downloadContext.partQueue.len() > 0) {
 			downloadContext.displayStatus("wait archive retrieve job")
 			downloadContext.uncompletedDownload = downloadContext.waitNextArchivePartIsRetrieved()
+			if downloadContext.uncompletedDownload == nil {
+				// the archives of the waited parts have been given up
+				continue
+			}
+		}
+		if downloadContext.outputExpiresBeforeDownload(downloadContext.uncompletedDownload, time.Now()) {
+			downloadContext.retrieveExpiringPartAgain()
+			continue
 		}
 		downloadContext.displayStatus("downloading")
 		archivesDownloadingSizeLeft := maxArchivesDownloadingSize - archivesDownloadingSize
@@ -343,8 +466,17 @@ func (downloadContext *DownloadContext) displayStatus(phase string) {
 }
 
 func (downloadContext *DownloadContext) updateDownloadSpeed(downloadedSize uint64, duration time.Duration) {
+	// nothing downloaded when all the waited parts are given up or retrieved again, the speed is unknown
+	if downloadedSize == 0 || duration == 0 {
+		return
+	}
 	if (downloadContext.speedAutoUpdate) {
 		downloadContext.speedInBytesBySec = uint64(float64(downloadedSize) / duration.Seconds())
+		if downloadContext.restorationContext.Options.SpeedTestMode == options.SPEED_TEST_GLACIER && downloadContext.speedInBytesBySec > 0 {
+			downloadContext.restorationContext.RegionVaultCache.DownloadSpeed = downloadContext.speedInBytesBySec
+			downloadContext.restorationContext.WriteCache()
+		}
+		downloadContext.speedInBytesBySec = awsutils.DownloadLimiter.CapSpeed(downloadContext.speedInBytesBySec, time.Now())
 		if (downloadContext.speedInBytesBySec == 0) {
 			downloadContext.speedInBytesBySec = 1
 		}
@@ -354,6 +486,7 @@ func (downloadContext *DownloadContext) updateDownloadSpeed(downloadedSize uint6
 
 func (downloadContext *DownloadContext) handleArchivePartDownloadCompletion(restorationContext *RestorationContext) {
 	if (downloadContext.nextByteIndexToDownload >= downloadContext.uncompletedDownload.retrievedSize) {
+		downloadContext.partQueue.remove(downloadContext.uncompletedDownload)
 		downloadContext.handleArchiveFileDownloadCompletion(downloadContext.uncompletedDownload.archiveId, downloadContext.uncompletedDownload.archiveSize)
 		downloadContext.uncompletedDownload = nil
 		downloadContext.nextByteIndexToDownload = 0
@@ -374,12 +507,15 @@ func (downloadContext *DownloadContext) handleArchiveFileDownloadCompletion(arch
 		pathRows := GetPaths(downloadContext.db, archiveId)
 		defer pathRows.Close()
 		var previousPath string
+		nbFiles := 0
 		if pathRows.Next() {
 			pathRows.Scan(&previousPath)
+			nbFiles++
 		}
 		for pathRows.Next() {
 			var path string
 			pathRows.Scan(&path)
+			nbFiles++
 			if !utils.Exists(destinationDirPath + "/" + previousPath) {
 				err = os.MkdirAll(filepath.Dir(destinationDirPath + "/" + previousPath), 0700)
 				utils.ExitIfError(err)
@@ -394,17 +530,42 @@ func (downloadContext *DownloadContext) handleArchiveFileDownloadCompletion(arch
 			os.Rename(destinationDirPath + "/" + archiveId, destinationDirPath + "/" + previousPath)
 			outputs.Printfln(outputs.Verbose, "File %v restored (rename from %v)", destinationDirPath + "/" + previousPath, archiveId)
 		}
+		downloadContext.fireEvent(hooks.Event{Event: hooks.EVENT_ARCHIVE_RESTORED, ArchiveId: archiveId, Size: size, Files: nbFiles})
 		return true
 	}
 	return false
 }
 
+func (downloadContext *DownloadContext) getJobPoller() *awsutils.JobPoller {
+	if downloadContext.jobPoller == nil {
+		downloadContext.jobPoller = awsutils.NewJobPoller(downloadContext.restorationContext.GlacierClient, downloadContext.restorationContext.Vault)
+	}
+	return downloadContext.jobPoller
+}
+
+// nil if the archives of all the parts have been given up
 func (downloadContext *DownloadContext) waitNextArchivePartIsRetrieved() *archivePartRetrieve {
-	element := downloadContext.archivePartRetrieveList.Back()
-	archivePartRetrieve := element.Value.(*archivePartRetrieve)
-	awsutils.WaitJobIsCompleted(downloadContext.restorationContext.GlacierClient, downloadContext.restorationContext.Vault, archivePartRetrieve.jobId)
-	downloadContext.archivePartRetrieveList.Remove(element)
-	return archivePartRetrieve
+	jobPoller := downloadContext.getJobPoller()
+	for {
+		downloadContext.handleFailedJobs()
+		if downloadContext.partQueue.len() == 0 {
+			return nil
+		}
+		if archivePartRetrieve := downloadContext.partQueue.takeNextReadyPart(); archivePartRetrieve != nil {
+			downloadContext.fireEvent(hooks.Event{Event: hooks.EVENT_JOB_READY, JobId: archivePartRetrieve.jobId, ArchiveId: archivePartRetrieve.archiveId, Size: archivePartRetrieve.retrievedSize})
+			return archivePartRetrieve
+		}
+		creationDates := []time.Time{}
+		if creationDate, waited := downloadContext.partQueue.firstPendingCreationDate(); waited {
+			creationDates = append(creationDates, creationDate)
+		}
+		if nextSweepDate := jobPoller.NextSweepDate(creationDates); nextSweepDate.After(time.Now()) {
+			downloadContext.displayStatus("wait archive retrieve job, next check at " + nextSweepDate.Format("15:04"))
+			time.Sleep(nextSweepDate.Sub(time.Now()))
+		}
+		jobPoller.Sweep()
+		downloadContext.partQueue.updateCompletedParts(jobPoller)
+	}
 }
 
 func downloadArchivePart(restorationContext *RestorationContext, archivePartRetrieve *archivePartRetrieve, fromByteIndex, nbBytesCanDownload uint64) (uint64, time.Duration) {
@@ -14,6 +14,13 @@ import (
 	"os"
 	"errors"
 	"rsg/awsutils"
+	"time"
+	"rsg/bandwidth"
+	"rsg/options"
+	"rsg/hooks"
+	"encoding/json"
+	"net"
+	"net/textproto"
 )
 
 func mockStartPartialRetrieveJob(glacierMock *GlacierMock, vault, archiveId, bytesRange, jobIdToReturn string) *mock.Call {
@@ -85,14 +92,6 @@ func mockPartialOutputJobForAny(glacierMock *GlacierMock, content []byte) *mock.
 	return glacierMock.On("GetJobOutput", mock.AnythingOfType("*glacier.GetJobOutputInput")).Return(out, nil)
 }
 
-func mockDescribeJobForAny(glacierMock *GlacierMock, completed bool) *mock.Call {
-	out := &glacier.JobDescription{
-		Completed: aws.Bool(completed),
-	}
-
-	return glacierMock.On("DescribeJob", mock.AnythingOfType("*glacier.DescribeJobInput")).Return(out, nil)
-}
-
 func TestDownloadArchives_retrieve_and_download_file_in_one_part(t *testing.T) {
 	// Given
 	CommonInitTest()
@@ -103,20 +102,20 @@ func TestDownloadArchives_retrieve_and_download_file_in_one_part(t *testing.T) {
 		archivesRetrievalMaxSize: utils.S_1MB,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 1,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 1,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
 	db.Close()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-4", "jobId1")
-	mockDescribeJob(glacierMock, "jobId1", restorationContext.Vault, true)
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1")
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-4", []byte("hello"))
 
 	// When
@@ -126,6 +125,126 @@ func TestDownloadArchives_retrieve_and_download_file_in_one_part(t *testing.T) {
 	assertFileContent(t, "../../testtmp/dest/share/data/file1.txt", "hello")
 }
 
+func TestDownloadArchives_fire_hooks_on_restore_events(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	downloadContext := DownloadContext{
+		restorationContext: restorationContext,
+		speedInBytesBySec: 1,
+		archivesRetrievalMaxSize: utils.S_1MB,
+		speedAutoUpdate: false,
+		partQueueMaxSize: 1,
+	}
+
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
+	db.Close()
+
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-4", "jobId1")
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1")
+	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-4", []byte("hello"))
+	hooks.Configure([]string{"cat >> ../../testtmp/events && echo >> ../../testtmp/events"}, []string{}, 0, hooks.EventNames)
+
+	// When
+	downloadContext.downloadArchives()
+	hooks.Wait()
+
+	// Then
+	content, err := ioutil.ReadFile("../../testtmp/events")
+	assert.Nil(t, err)
+	events := []hooks.Event{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		event := hooks.Event{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, hooks.Event{Event: hooks.EVENT_JOB_STARTED, Region: "region", Vault: "vault", JobId: "jobId1", ArchiveId: "archiveId1", Size: 5, Destination: "../../testtmp/dest"},
+		hooks.Event{Event: events[0].Event, Region: events[0].Region, Vault: events[0].Vault, JobId: events[0].JobId, ArchiveId: events[0].ArchiveId, Size: events[0].Size, Destination: events[0].Destination})
+	assert.Equal(t, hooks.EVENT_JOB_READY, events[1].Event)
+	assert.Equal(t, hooks.EVENT_ARCHIVE_RESTORED, events[2].Event)
+	assert.Equal(t, hooks.EVENT_RESTORE_FINISHED, events[3].Event)
+	assert.Equal(t, uint64(5), events[3].Size)
+}
+
+// SMTP server receiving one mail by connection, without TLS, lines of mails end with \n
+func startSmtpSink(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := textproto.NewConn(connection)
+			reader.PrintfLine("220 localhost")
+			for {
+				line, err := reader.ReadLine()
+				if err != nil {
+					break
+				}
+				command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+				if command == "DATA" {
+					reader.PrintfLine("354 go ahead")
+					message, _ := reader.ReadDotBytes()
+					messages <- string(message)
+				} else if command == "QUIT" {
+					reader.PrintfLine("221 bye")
+					break
+				}
+				reader.PrintfLine("250 ok")
+			}
+			reader.Close()
+		}
+	}()
+	return listener.Addr().String(), messages
+}
+
+func TestDownloadArchives_send_mail_when_restore_is_finished(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	downloadContext := DownloadContext{
+		restorationContext: restorationContext,
+		speedInBytesBySec: 1,
+		archivesRetrievalMaxSize: utils.S_1MB,
+		speedAutoUpdate: false,
+		partQueueMaxSize: 1,
+	}
+
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file2.txt', 'archiveId1', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file3.txt', 'archiveId2', 3);")
+	db.Close()
+
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-4", "jobId1")
+	mockStartPartialRetrieveJobWithError(glacierMock, restorationContext.Vault, "archiveId2", "0-2", errors.New("ResourceNotFoundException"))
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1")
+	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-4", []byte("hello"))
+	smtpServer, messages := startSmtpSink(t)
+	hooks.ConfigureMail(hooks.MailConfig{Server: smtpServer, Security: hooks.SMTP_NONE, From: "rsg@localhost", To: []string{"user@localhost"}})
+
+	// When
+	downloadContext.downloadArchives()
+
+	// Then
+	select {
+	case message := <-messages:
+		assert.Contains(t, message, "To: user@localhost\n")
+		assert.Contains(t, message, "Subject: [rsg] Restore of vault region:vault is finished\n")
+		assert.Contains(t, message, "Restored: 5B\nFiles: 2\nSkipped archives: 1\n")
+		assert.Contains(t, message, "Last error: archive archiveId2 skipped: archive not found\n")
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "no mail received")
+	}
+}
+
 func TestDownloadArchives_retrieve_and_download_file_with_multipart(t *testing.T) {
 	// Given
 	CommonInitTest()
@@ -136,30 +255,28 @@ func TestDownloadArchives_retrieve_and_download_file_with_multipart(t *testing.T
 		archivesRetrievalMaxSize: utils.S_1MB * 2,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 10,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 10,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 4194304);")
 	db.Close()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-2097151", "jobId1").Once()
-	mockDescribeJob(glacierMock, "jobId1", restorationContext.Vault, true).Once()
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1", "jobId2", "jobId3")
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-1048799", []byte(strings.Repeat("_", 1048800))).Once()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "2097152-3145727", "jobId2").Once()
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "1048800-2097151", []byte(strings.Repeat("_", 1048352))).Once()
-	mockDescribeJob(glacierMock, "jobId2", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId2", restorationContext.Vault, "0-447", []byte(strings.Repeat("_", 448))).Once()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "3145728-4194303", "jobId3").Once()
 	mockPartialOutputJob(glacierMock, "jobId2", restorationContext.Vault, "448-1048575", []byte(strings.Repeat("_", 1048128))).Once()
-	mockDescribeJob(glacierMock, "jobId3", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId3", restorationContext.Vault, "0-671", []byte(strings.Repeat("_", 672)))
 
 	mockPartialOutputJob(glacierMock, "jobId3", restorationContext.Vault, "672-1048575", append([]byte(strings.Repeat("_", 1047899)), []byte("hello")...))
@@ -181,41 +298,37 @@ func TestDownloadArchives_retrieve_and_download_2_files_with_multipart(t *testin
 		archivesRetrievalMaxSize: utils.S_1MB * 2,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 10,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 10,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 4194304);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file2.txt', 'archiveId2', 2097152);")
 	db.Close()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-2097151", "jobId1").Once()
-	mockDescribeJob(glacierMock, "jobId1", restorationContext.Vault, true).Once()
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1", "jobId2", "jobId3", "jobId4", "jobId5")
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-1048799", []byte(strings.Repeat("_", 1048800))).Once()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "2097152-3145727", "jobId2").Once()
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "1048800-2097151", []byte(strings.Repeat("_", 1048352))).Once()
-	mockDescribeJob(glacierMock, "jobId2", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId2", restorationContext.Vault, "0-447", []byte(strings.Repeat("_", 448))).Once()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "3145728-4194303", "jobId3").Once()
 	mockPartialOutputJob(glacierMock, "jobId2", restorationContext.Vault, "448-1048575", []byte(strings.Repeat("_", 1048128))).Once()
-	mockDescribeJob(glacierMock, "jobId3", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId3", restorationContext.Vault, "0-671", []byte(strings.Repeat("_", 672)))
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId2", "0-1048575", "jobId4").Once()
 	mockPartialOutputJob(glacierMock, "jobId3", restorationContext.Vault, "672-1048575", append([]byte(strings.Repeat("_", 1047899)), []byte("hello")...))
-	mockDescribeJob(glacierMock, "jobId4", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId4", restorationContext.Vault, "0-895", []byte(strings.Repeat("_", 896)))
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId2", "1048576-2097151", "jobId5").Once()
 	mockPartialOutputJob(glacierMock, "jobId4", restorationContext.Vault, "896-1048575", []byte(strings.Repeat("_", 1047680)))
-	mockDescribeJob(glacierMock, "jobId5", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId5", restorationContext.Vault, "0-1119", []byte(strings.Repeat("_", 1120)))
 
 	mockPartialOutputJob(glacierMock, "jobId5", restorationContext.Vault, "1120-1048575", append([]byte(strings.Repeat("_", 1047451)), []byte("olleh")...))
@@ -238,42 +351,38 @@ func TestDownloadArchives_retrieve_and_download_3_files_with_2_identical(t *test
 		archivesRetrievalMaxSize: utils.S_1MB * 2,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 10,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 10,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 4194304);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file2.txt', 'archiveId2', 2097152);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file3.txt', 'archiveId1', 4194304);")
 	db.Close()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-2097151", "jobId1").Once()
-	mockDescribeJob(glacierMock, "jobId1", restorationContext.Vault, true).Once()
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1", "jobId2", "jobId3", "jobId4", "jobId5")
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-1048799", []byte(strings.Repeat("_", 1048800))).Once()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "2097152-3145727", "jobId2").Once()
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "1048800-2097151", []byte(strings.Repeat("_", 1048352))).Once()
-	mockDescribeJob(glacierMock, "jobId2", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId2", restorationContext.Vault, "0-447", []byte(strings.Repeat("_", 448))).Once()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "3145728-4194303", "jobId3").Once()
 	mockPartialOutputJob(glacierMock, "jobId2", restorationContext.Vault, "448-1048575", []byte(strings.Repeat("_", 1048128))).Once()
-	mockDescribeJob(glacierMock, "jobId3", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId3", restorationContext.Vault, "0-671", []byte(strings.Repeat("_", 672)))
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId2", "0-1048575", "jobId4").Once()
 	mockPartialOutputJob(glacierMock, "jobId3", restorationContext.Vault, "672-1048575", append([]byte(strings.Repeat("_", 1047899)), []byte("hello")...))
-	mockDescribeJob(glacierMock, "jobId4", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId4", restorationContext.Vault, "0-895", []byte(strings.Repeat("_", 896)))
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId2", "1048576-2097151", "jobId5").Once()
 	mockPartialOutputJob(glacierMock, "jobId4", restorationContext.Vault, "896-1048575", []byte(strings.Repeat("_", 1047680)))
-	mockDescribeJob(glacierMock, "jobId5", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId5", restorationContext.Vault, "0-1119", []byte(strings.Repeat("_", 1120)))
 
 	mockPartialOutputJob(glacierMock, "jobId5", restorationContext.Vault, "1120-1048575", append([]byte(strings.Repeat("_", 1047451)), []byte("olleh")...))
@@ -298,15 +407,15 @@ func TestDownloadArchives_retrieve_and_download_only_filtered_files(t *testing.T
 		archivesRetrievalMaxSize: utils.S_1MB * 2,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 10,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 10,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file1.txt', 'archiveId1', 2);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file2.bin', 'archiveId2', 2);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folderno/no.bin', 'archiveId3', 2);")
@@ -322,7 +431,7 @@ func TestDownloadArchives_retrieve_and_download_only_filtered_files(t *testing.T
 	db.Close()
 
 	mockStartPartialRetrieveJobForAny(glacierMock, "jobId")
-	mockDescribeJobForAny(glacierMock, true)
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId")
 	mockPartialOutputJobForAny(glacierMock, []byte("ok"))
 
 	// When
@@ -354,15 +463,15 @@ func TestDownloadArchives_compute_total_size(t *testing.T) {
 		archivesRetrievalMaxSize: utils.S_1MB * 2,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 10,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 10,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file1.txt', 'archiveId1', 2);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file2.bin', 'archiveId2', 2);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file3.txt', 'archiveId1', 2);")
@@ -371,7 +480,7 @@ func TestDownloadArchives_compute_total_size(t *testing.T) {
 	db.Close()
 
 	mockStartPartialRetrieveJobForAny(glacierMock, "jobId")
-	mockDescribeJobForAny(glacierMock, true)
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId")
 	mockPartialOutputJobForAny(glacierMock, []byte("ok"))
 
 	// When
@@ -392,22 +501,22 @@ func TestDownloadArchives_retrieve_and_download_an_archive_already_started(t *te
 		archivesRetrievalMaxSize: utils.S_1MB * 2,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 10,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 10,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file1.txt', 'archiveId1', 1048581);")
 	db.Close()
 
 	ioutil.WriteFile("../../testtmp/dest/archiveId1", append([]byte(strings.Repeat("_", 1048576)), []byte("hel")...), 0700)
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "1048576-1048580", "jobId1").Once()
-	mockDescribeJob(glacierMock, "jobId1", restorationContext.Vault, true).Once()
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1")
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-4", []byte("hello")).Once()
 
 	// When
@@ -427,15 +536,15 @@ func TestDownloadArchives_retrieve_and_download_an_archive_already_started_and_c
 		archivesRetrievalMaxSize: utils.S_1MB * 2,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 10,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 10,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file1.txt', 'archiveId1', 1048581);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file2.txt', 'archiveId1', 1048581);")
 	db.Close()
@@ -460,27 +569,26 @@ func TestDownloadArchives_retrieve_when_archive_is_not_found(t *testing.T) {
 		archivesRetrievalMaxSize: utils.S_1MB * 2,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 10,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 10,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file1.txt', 'archiveId1', 1);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file2.txt', 'archiveId2', 1);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file3.txt', 'archiveId3', 1);")
 	db.Close()
 
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-0", "jobId1").Once()
-	mockDescribeJob(glacierMock, "jobId1", restorationContext.Vault, true).Once()
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1", "jobId2")
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-0", []byte("1")).Once()
 
 	mockStartPartialRetrieveJobWithError(glacierMock, restorationContext.Vault, "archiveId2", "0-0", errors.New("ResourceNotFoundException")).Once()
 	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId3", "0-0", "jobId2").Once()
-	mockDescribeJob(glacierMock, "jobId2", restorationContext.Vault, true).Once()
 	mockPartialOutputJob(glacierMock, "jobId2", restorationContext.Vault, "0-0", []byte("3")).Once()
 
 
@@ -503,15 +611,15 @@ func TestDownloadArchives_retrieve_empty_file(t *testing.T) {
 		archivesRetrievalMaxSize: utils.S_1MB * 2,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 10,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 10,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file1.txt', 'GlacierZeroSizeFile', 0);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/folder/file2.txt', 'GlacierZeroSizeFile', 0);")
 	db.Close()
@@ -534,20 +642,20 @@ func TestDownloadArchives_retrieve_and_download_when_retrieval_job_exists(t *tes
 		archivesRetrievalMaxSize: utils.S_1MB,
 		speedAutoUpdate: false,
 		archivesRetrievalSize: 0,
-		archivePartRetrievalListMaxSize: 1,
-		archivePartRetrieveList: nil,
+		partQueueMaxSize: 1,
+		partQueue: nil,
 		hasArchiveRows: false,
 		db: nil,
 		archiveRows:nil,
 	}
 
 	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
-	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
 	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
 	db.Close()
 
 	awsutils.AddRetrievalJobAtStartup("archiveId1", "0-4", "jobId1")
-	mockDescribeJob(glacierMock, "jobId1", restorationContext.Vault, true)
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1")
 	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-4", []byte("hello"))
 
 	// When
@@ -557,6 +665,405 @@ func TestDownloadArchives_retrieve_and_download_when_retrieval_job_exists(t *tes
 	assertFileContent(t, "../../testtmp/dest/share/data/file1.txt", "hello")
 }
 
+func initTestPartQueue(restorationContext *RestorationContext, parts ...*archivePartRetrieve) *partQueue {
+	queue := openPartQueue(restorationContext.GetStateFilePath())
+	for _, part := range parts {
+		queue.push(part)
+	}
+	return queue
+}
+
+// job ids of the parts in their download order
+func takeReadyJobIds(queue *partQueue) []string {
+	jobIds := []string{}
+	for part := queue.takeNextReadyPart(); part != nil; part = queue.takeNextReadyPart() {
+		jobIds = append(jobIds, part.jobId)
+		queue.remove(part)
+	}
+	return jobIds
+}
+
+func TestDownloadArchives_download_first_the_part_retrieved_first(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	queue := initTestPartQueue(restorationContext,
+		&archivePartRetrieve{jobId: "jobId1", archiveId: "archiveId1", retrievalByteIndex: 0},
+		&archivePartRetrieve{jobId: "jobId2", archiveId: "archiveId1", retrievalByteIndex: utils.S_1MB},
+		&archivePartRetrieve{jobId: "jobId3", archiveId: "archiveId2"})
+	defer queue.close()
+	downloadContext := DownloadContext{restorationContext: restorationContext, partQueue: queue}
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId2", "jobId3")
+
+	// When
+	part := downloadContext.waitNextArchivePartIsRetrieved()
+
+	// Then
+	assert.Equal(t, "jobId3", part.jobId)
+	assert.Equal(t, 2, queue.len())
+	glacierMock.AssertNumberOfCalls(t, "ListJobsPages", 1)
+}
+
+func TestDownloadArchives_part_queue_is_kept_in_the_state_file(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	queue := initTestPartQueue(restorationContext,
+		&archivePartRetrieve{jobId: "jobId1", archiveId: "archiveId1"},
+		&archivePartRetrieve{jobId: "jobId2", archiveId: "archiveId2"},
+		&archivePartRetrieve{jobId: "jobId3", archiveId: "archiveId3"})
+	defer queue.close()
+	mockListCompletedJobs(glacierMock, restorationContext.Vault, completedJob("jobId1", time.Now().UTC().Format(time.RFC3339)), failedJob("jobId2", "Archive cannot be read"))
+	jobPoller := awsutils.NewJobPoller(glacierMock, restorationContext.Vault)
+	jobPoller.Sweep()
+
+	// When
+	queue.updateCompletedParts(jobPoller)
+
+	// Then
+	db, _ := sql.Open("sqlite3", restorationContext.GetStateFilePath())
+	defer db.Close()
+	rows, _ := db.Query("SELECT jobId, state FROM part_tb ORDER BY jobId")
+	defer rows.Close()
+	states := map[string]string{}
+	for rows.Next() {
+		var jobId, state string
+		rows.Scan(&jobId, &state)
+		states[jobId] = state
+	}
+	assert.Equal(t, map[string]string{"jobId1": PART_READY, "jobId2": PART_FAILED, "jobId3": PART_PENDING}, states)
+}
+
+func TestDownloadArchives_job_poller_forgets_jobs_not_listed_at_last_sweep(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1", "jobId2").Once()
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId2", "jobId3").Once()
+	jobPoller := awsutils.NewJobPoller(glacierMock, restorationContext.Vault)
+	jobPoller.Sweep()
+
+	// When
+	jobPoller.Sweep()
+
+	// Then
+	_, expiredJobCompleted := jobPoller.CompletedJob("jobId1")
+	_, jobCompleted := jobPoller.CompletedJob("jobId2")
+	_, newJobCompleted := jobPoller.CompletedJob("jobId3")
+	assert.False(t, expiredJobCompleted)
+	assert.True(t, jobCompleted)
+	assert.True(t, newJobCompleted)
+}
+
+func TestDownloadArchives_wait_expected_completion_of_jobs_before_next_sweep(t *testing.T) {
+	// Given
+	CommonInitTest()
+	awsutils.MaxPollInterval = 1 * time.Hour
+	defer func() { awsutils.MaxPollInterval = 1 * time.Nanosecond }()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	mockCompletedJobs(glacierMock, restorationContext.Vault)
+	jobPoller := awsutils.NewJobPoller(glacierMock, restorationContext.Vault)
+	jobPoller.Sweep()
+	now := time.Now()
+
+	// When
+	nextSweepWithoutJob := jobPoller.NextSweepDate([]time.Time{})
+	nextSweepOfNewJob := jobPoller.NextSweepDate([]time.Time{now})
+	nextSweepOfOldJob := jobPoller.NextSweepDate([]time.Time{now, now.Add(-3 * time.Hour - 50 * time.Minute)})
+
+	// Then
+	assert.True(t, nextSweepWithoutJob.Before(now.Add(time.Minute)))
+	assert.WithinDuration(t, now.Add(1 * time.Hour), nextSweepOfNewJob, time.Minute)
+	assert.WithinDuration(t, now.Add(10 * time.Minute), nextSweepOfOldJob, time.Minute)
+}
+
+func failedJob(jobId, statusMessage string) *glacier.JobDescription {
+	return &glacier.JobDescription{
+		JobId: aws.String(jobId),
+		Completed: aws.Bool(true),
+		StatusCode: aws.String("Failed"),
+		StatusMessage: aws.String(statusMessage),
+	}
+}
+
+func TestDownloadArchives_retrieve_again_range_of_failed_job(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	restorationContext.Options.JobRetries = 1
+	downloadContext := DownloadContext{
+		restorationContext: restorationContext,
+		speedInBytesBySec: 1,
+		archivesRetrievalMaxSize: utils.S_1MB,
+		speedAutoUpdate: false,
+		partQueueMaxSize: 1,
+	}
+
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
+	db.Close()
+
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-4", "jobId1").Once()
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-4", "jobId2").Once()
+	mockListCompletedJobs(glacierMock, restorationContext.Vault, failedJob("jobId1", "Archive cannot be read"), completedJob("jobId2", time.Now().UTC().Format(time.RFC3339)))
+	mockPartialOutputJob(glacierMock, "jobId2", restorationContext.Vault, "0-4", []byte("hello"))
+
+	// When
+	restored := downloadContext.downloadArchives()
+
+	// Then
+	assert.True(t, restored)
+	assertFileContent(t, "../../testtmp/dest/share/data/file1.txt", "hello")
+	assert.Contains(t, string(buffer.Bytes()), "Retrieval job jobId1 of range 0-4 of archive archiveId1 has failed: Archive cannot be read")
+	assertFileDoestntExist(t, restorationContext.GetFailureReportPath())
+}
+
+func TestDownloadArchives_give_up_archive_when_its_jobs_keep_failing(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	restorationContext.Options.JobRetries = 1
+	downloadContext := DownloadContext{
+		restorationContext: restorationContext,
+		speedInBytesBySec: 1,
+		archivesRetrievalMaxSize: utils.S_1MB,
+		speedAutoUpdate: false,
+		partQueueMaxSize: 1,
+	}
+
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file2.txt', 'archiveId2', 3);")
+	db.Close()
+
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-4", "jobId1").Once()
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-4", "jobId2").Once()
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId2", "0-2", "jobId3").Once()
+	mockListCompletedJobs(glacierMock, restorationContext.Vault,
+		failedJob("jobId1", "Archive cannot be read"),
+		failedJob("jobId2", "Archive cannot be read"),
+		completedJob("jobId3", time.Now().UTC().Format(time.RFC3339)))
+	mockPartialOutputJob(glacierMock, "jobId3", restorationContext.Vault, "0-2", []byte("bye"))
+
+	// When
+	restored := downloadContext.downloadArchives()
+
+	// Then
+	assert.False(t, restored)
+	assertFileContent(t, "../../testtmp/dest/share/data/file2.txt", "bye")
+	assertFileDoestntExist(t, "../../testtmp/dest/share/data/file1.txt")
+	failedArchives := []FailedArchive{}
+	bytes, _ := ioutil.ReadFile(restorationContext.GetFailureReportPath())
+	json.Unmarshal(bytes, &failedArchives)
+	assert.Equal(t, []FailedArchive{{ArchiveId: "archiveId1", Size: 5, Paths: []string{"share/data/file1.txt"},
+		JobIds: []string{"jobId1", "jobId2"}, StatusMessage: "Archive cannot be read"}}, failedArchives)
+}
+
+func TestGiveUpArchive_remove_part_of_archive_already_downloaded(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 10);")
+	failedPart := &archivePartRetrieve{jobId: "jobId2", archiveId: "archiveId1", retrievalByteIndex: 5, retrievedSize: 5, archiveSize: 10,
+		failedJobIds: []string{"jobId2"}, failureMessage: "Archive cannot be read"}
+	queue := initTestPartQueue(restorationContext, failedPart)
+	defer queue.close()
+	downloadContext := DownloadContext{restorationContext: restorationContext, db: db, partQueue: queue}
+	ioutil.WriteFile(restorationContext.DestinationDirPath + "/archiveId1", []byte("hello"), 0600)
+
+	// When
+	downloadContext.giveUpArchive(failedPart)
+	db.Close()
+
+	// Then
+	assertFileDoestntExist(t, restorationContext.DestinationDirPath + "/archiveId1")
+	assert.Equal(t, 0, queue.len())
+	assert.Equal(t, []string{"share/data/file1.txt"}, downloadContext.failedArchives[0].Paths)
+}
+
+func TestDownloadArchives_send_mail_with_errors_when_archives_are_given_up(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	restorationContext.Options.JobRetries = 0
+	downloadContext := DownloadContext{
+		restorationContext: restorationContext,
+		speedInBytesBySec: 1,
+		archivesRetrievalMaxSize: utils.S_1MB,
+		speedAutoUpdate: false,
+		partQueueMaxSize: 1,
+	}
+
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file2.txt', 'archiveId2', 3);")
+	db.Close()
+
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-4", "jobId1")
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId2", "0-2", "jobId2")
+	mockListCompletedJobs(glacierMock, restorationContext.Vault,
+		failedJob("jobId1", "Archive cannot be read"),
+		completedJob("jobId2", time.Now().UTC().Format(time.RFC3339)))
+	mockPartialOutputJob(glacierMock, "jobId2", restorationContext.Vault, "0-2", []byte("bye"))
+	smtpServer, messages := startSmtpSink(t)
+	hooks.ConfigureMail(hooks.MailConfig{Server: smtpServer, Security: hooks.SMTP_NONE, From: "rsg@localhost", To: []string{"user@localhost"}})
+
+	// When
+	restored := downloadContext.downloadArchives()
+
+	// Then
+	assert.False(t, restored)
+	select {
+	case message := <-messages:
+		assert.Contains(t, message, "Subject: [rsg] Restore of vault region:vault is finished with errors\n")
+		assert.Contains(t, message, "is finished on ")
+		assert.Contains(t, message, ", but 1 archives cannot be restored.\n")
+		assert.Contains(t, message, "Restored: 3B\nFiles: 1\nSkipped archives: 1\n")
+		assert.Contains(t, message, "Skipped archives:\n  archiveId1 (5B): retrieval job failed: Archive cannot be read\n")
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "no mail received")
+	}
+}
+
+func TestDownloadArchives_retry_when_policy_is_enforced(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	downloadContext := DownloadContext{
+		restorationContext: restorationContext,
+		speedInBytesBySec: 1,
+		archivesRetrievalMaxSize: utils.S_1MB,
+		speedAutoUpdate: false,
+		archivesRetrievalSize: 0,
+		partQueueMaxSize: 1,
+		partQueue: nil,
+		hasArchiveRows: false,
+		db: nil,
+		archiveRows:nil,
+	}
+
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
+	db.Close()
+
+	mockStartPartialRetrieveJobWithError(glacierMock, restorationContext.Vault, "archiveId1", "0-4", errors.New("PolicyEnforcedException")).Once()
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-4", "jobId1").Once()
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1")
+	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-4", []byte("hello"))
+
+	// When
+	downloadContext.downloadArchives()
+
+	// Then
+	assert.Contains(t, string(buffer.Bytes()), "(rate limit reached, next attempt at")
+	assertFileContent(t, "../../testtmp/dest/share/data/file1.txt", "hello")
+}
+
+func TestDownloadArchives_retrieval_is_capped_by_bytes_per_hour_policy(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	glacierMock.ExpectedCalls = nil
+	mockGetDataRetrievalPolicyWithBytesPerHour(glacierMock, "accountId", 262144) // 1MB on 4 hours
+	downloadContext := DownloadContext{
+		restorationContext: restorationContext,
+		speedInBytesBySec: 3496, // 1048800 on 5 min
+		archivesRetrievalMaxSize: utils.S_1MB * 2,
+		speedAutoUpdate: false,
+		archivesRetrievalSize: 0,
+		partQueueMaxSize: 10,
+		partQueue: nil,
+		hasArchiveRows: false,
+		db: nil,
+		archiveRows:nil,
+	}
+
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 1048576);")
+	db.Close()
+
+	mockStartPartialRetrieveJob(glacierMock, restorationContext.Vault, "archiveId1", "0-1048575", "jobId1").Once()
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1")
+	mockPartialOutputJob(glacierMock, "jobId1", restorationContext.Vault, "0-1048575", append([]byte(strings.Repeat("_", 1048571)), []byte("hello")...)).Once()
+
+	// When
+	downloadContext.downloadArchives()
+
+	// Then
+	assert.Equal(t, uint64(utils.S_1MB), downloadContext.archivesRetrievalMaxSize)
+	assert.Equal(t, uint64(0), downloadContext.retrievalBudget.sizeLeft(time.Now()))
+	assertFileContent(t, "../../testtmp/dest/share/data/file1.txt", strings.Repeat("_", 1048571) + "hello")
+}
+
+func TestDownloadArchives_update_download_speed_capped_by_max_bandwidth(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	awsutils.DownloadLimiter = bandwidth.NewLimiter(utils.S_1MB, nil)
+	defer func() { awsutils.DownloadLimiter = nil }()
+	downloadContext := DownloadContext{restorationContext: restorationContext, speedAutoUpdate: true}
+
+	// When
+	downloadContext.updateDownloadSpeed(10 * utils.S_1MB, 1 * time.Second)
+
+	// Then
+	assert.Equal(t, uint64(utils.S_1MB), downloadContext.speedInBytesBySec)
+}
+
+func TestDownloadArchives_persist_download_speed_measured_on_glacier(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	restorationContext.Options.SpeedTestMode = options.SPEED_TEST_GLACIER
+	downloadContext := DownloadContext{restorationContext: restorationContext, speedAutoUpdate: true}
+
+	// When
+	downloadContext.updateDownloadSpeed(10 * utils.S_1MB, 2 * time.Second)
+
+	// Then
+	assert.Equal(t, uint64(5 * utils.S_1MB), ReadCache(restorationContext.WorkingDirPath).DownloadSpeed)
+	assert.Equal(t, uint64(5 * utils.S_1MB), getGivenOrMeasuredDownloadSpeed(restorationContext))
+}
+
+func TestDownloadArchives_keep_download_speed_when_nothing_downloaded(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	restorationContext.Options.SpeedTestMode = options.SPEED_TEST_GLACIER
+	restorationContext.RegionVaultCache.DownloadSpeed = 1000
+	downloadContext := DownloadContext{restorationContext: restorationContext, speedInBytesBySec: 1000, speedAutoUpdate: true}
+
+	// When
+	downloadContext.updateDownloadSpeed(0, 0)
+
+	// Then
+	assert.Equal(t, uint64(1000), downloadContext.speedInBytesBySec)
+	assert.Equal(t, uint64(1000), restorationContext.RegionVaultCache.DownloadSpeed)
+	assert.Equal(t, RegionVaultCache{}, ReadCache(restorationContext.WorkingDirPath))
+}
+
+func TestDownloadArchives_given_download_speed_is_used_first(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	restorationContext.Options.Speed = utils.S_1MB
+	restorationContext.Options.SpeedTestMode = options.SPEED_TEST_GLACIER
+	restorationContext.RegionVaultCache.DownloadSpeed = 5 * utils.S_1MB
+
+	// When
+	downloadSpeed := getGivenOrMeasuredDownloadSpeed(restorationContext)
+
+	// Then
+	assert.Equal(t, uint64(utils.S_1MB), downloadSpeed)
+}
+
 func assertFileContent(t *testing.T, filePath, expected string) {
 	data, _ := ioutil.ReadFile(filePath)
 	assert.Equal(t, expected, string(data))
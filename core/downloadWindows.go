@@ -0,0 +1,129 @@
+package core
+
+import (
+	"time"
+	"code.cloudfoundry.org/bytefmt"
+	"rsg/awsutils"
+	"rsg/schedule"
+	"rsg/utils"
+)
+
+// Restrict retrieval jobs and downloads to time of day windows.
+//
+// Outside the download window, the jobs already started are kept and downloaded when the window opens, the
+// parts whose output expires first are downloaded first. As the output of a job is available 24 hours after
+// its completion, the size of new jobs is limited to what can be downloaded inside the download window
+// during this period.
+
+const jobDuration = awsutils.JobDuration
+const jobOutputAvailability = awsutils.JobOutputAvailability
+
+func isInWindow(window *schedule.Window, date time.Time) bool {
+	return window == nil || window.Contains(date)
+}
+
+func nextWindowStart(window *schedule.Window, date time.Time) time.Time {
+	if window == nil {
+		return date
+	}
+	return window.NextStart(date)
+}
+
+// max number of bytes which can be downloaded before the expiry of a job started at the given date
+func (downloadContext *DownloadContext) downloadableSizeBeforeExpiry(now time.Time) uint64 {
+	downloadWindow := downloadContext.restorationContext.Options.DownloadWindow
+	if downloadWindow == nil {
+		return ^uint64(0)
+	}
+	completionDate := now.Add(jobDuration)
+	openDuration := downloadWindow.OpenDuration(completionDate, completionDate.Add(jobOutputAvailability))
+	return downloadContext.speedInBytesBySec * uint64(openDuration.Seconds())
+}
+
+func (downloadContext *DownloadContext) hasPartsToDownload() bool {
+	return downloadContext.uncompletedDownload != nil || downloadContext.partQueue.len() > 0
+}
+
+func (downloadContext *DownloadContext) hasArchivesToRetrieve() bool {
+	return (downloadContext.hasArchiveRows || downloadContext.uncompletedRetrieve != nil) &&
+		downloadContext.archivesRetrievalSize < downloadContext.archivesRetrievalMaxSize &&
+		downloadContext.partQueue.len() < downloadContext.partQueueMaxSize
+}
+
+// sleep while nothing can be retrieved or downloaded, because of the rate limit or the time windows
+func (downloadContext *DownloadContext) waitUntilRetrievalOrDownloadIsPossible(lastArchiveRetrieveResult ArchiveRetrieveResult) {
+	now := time.Now()
+	options := downloadContext.restorationContext.Options
+	if downloadContext.hasPartsToDownload() && isInWindow(options.DownloadWindow, now) {
+		return
+	}
+	if downloadContext.hasArchivesToRetrieve() && lastArchiveRetrieveResult != RETRY && isInWindow(options.RetrievalWindow, now) {
+		return
+	}
+	var nextDate time.Time
+	reason := ""
+	nextSizeDetail := ""
+	if downloadContext.hasArchivesToRetrieve() {
+		nextDate = now
+		if lastArchiveRetrieveResult == RETRY {
+			nextDate, reason, nextSizeDetail = downloadContext.nextRetrievalAttempt(now)
+		}
+		if !isInWindow(options.RetrievalWindow, nextDate) {
+			nextDate = nextWindowStart(options.RetrievalWindow, nextDate)
+			reason = "outside retrieval window"
+		}
+	}
+	if downloadContext.hasPartsToDownload() {
+		if downloadDate := nextWindowStart(options.DownloadWindow, now); nextDate.IsZero() || downloadDate.Before(nextDate) {
+			nextDate = downloadDate
+			reason = "outside download window"
+			nextSizeDetail = ""
+		}
+	}
+	if nextDate.After(now) {
+		downloadContext.displayStatus(reason + ", next attempt at " + nextDate.Format("15:04") + nextSizeDetail)
+		time.Sleep(nextDate.Sub(now))
+	}
+}
+
+// a retrieval is retried once the parts already retrieved fit in the download window before their expiry, or once
+// the retrieval policy allows it, the latest of both when both are reached
+func (downloadContext *DownloadContext) nextRetrievalAttempt(now time.Time) (time.Time, string, string) {
+	nextDate, reason, nextSizeDetail := now, "", ""
+	if downloadContext.isDownloadWindowFull(now) {
+		nextDate = nextWindowStart(downloadContext.restorationContext.Options.DownloadWindow, now)
+		reason = "download window full until retrieved parts are downloaded"
+	}
+	budgetReached := downloadContext.retrievalBudget.sizeLeft(now) < utils.S_1MB
+	if budgetReached || reason == "" {
+		budgetDate, nextSize := downloadContext.retrievalBudget.nextAttempt(now, utils.S_1MB)
+		if reason == "" || budgetDate.After(nextDate) {
+			nextDate = budgetDate
+			reason = "rate limit reached"
+			nextSizeDetail = " for " + bytefmt.ByteSize(nextSize)
+		}
+	}
+	if !nextDate.After(now) {
+		nextDate = now.Add(RetryMinWaitTime)
+	}
+	return nextDate, reason, nextSizeDetail
+}
+
+// the parts retrieved and not downloaded yet take all the size that can be downloaded in the download window
+func (downloadContext *DownloadContext) isDownloadWindowFull(now time.Time) bool {
+	if downloadContext.restorationContext.Options.DownloadWindow == nil {
+		return false
+	}
+	return downloadContext.downloadableSizeBeforeExpiry(now) < downloadContext.archivesRetrievalSize + utils.S_1MB
+}
+
+// the completion dates of the parts are updated when the window opens, the parts whose output expires first
+// are downloaded first (see partQueue.takeNextReadyPart)
+func (downloadContext *DownloadContext) prioritizeExpiringParts() {
+	if downloadContext.partQueue.len() == 0 {
+		return
+	}
+	jobPoller := downloadContext.getJobPoller()
+	jobPoller.Sweep()
+	downloadContext.partQueue.updateCompletedParts(jobPoller)
+}
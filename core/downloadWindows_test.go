@@ -0,0 +1,115 @@
+package core
+
+import (
+	"testing"
+	"time"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/stretchr/testify/assert"
+	"rsg/awsutils"
+	"rsg/schedule"
+	"rsg/utils"
+	"code.cloudfoundry.org/bytefmt"
+)
+
+func completedJob(jobId, completionDate string) *glacier.JobDescription {
+	return &glacier.JobDescription{
+		JobId: aws.String(jobId),
+		Completed: aws.Bool(true),
+		StatusCode: aws.String("Succeeded"),
+		CompletionDate: aws.String(completionDate),
+	}
+}
+
+func TestDownloadWindows_prioritize_parts_expiring_first(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	queue := initTestPartQueue(restorationContext,
+		&archivePartRetrieve{jobId: "jobId1", archiveId: "archiveId1", retrievalByteIndex: 0},
+		&archivePartRetrieve{jobId: "jobId2", archiveId: "archiveId2"},
+		&archivePartRetrieve{jobId: "jobId3", archiveId: "archiveId1", retrievalByteIndex: utils.S_1MB},
+		&archivePartRetrieve{jobId: "jobId4", archiveId: "archiveId3"})
+	defer queue.close()
+	downloadContext := DownloadContext{restorationContext: restorationContext, partQueue: queue}
+	mockListCompletedJobs(glacierMock, restorationContext.Vault,
+		completedJob("jobId1", "2016-08-01T12:00:00.000Z"),
+		completedJob("jobId2", "2016-08-01T13:00:00.000Z"),
+		completedJob("jobId3", "2016-08-01T10:00:00.000Z"),
+		completedJob("jobId4", "2016-08-01T11:00:00.000Z"))
+
+	// When
+	downloadContext.prioritizeExpiringParts()
+
+	// Then
+	assert.Equal(t, []string{"jobId4", "jobId1", "jobId3", "jobId2"}, takeReadyJobIds(queue))
+}
+
+func TestDownloadWindows_downloadable_size_before_expiry(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	window, _ := schedule.ParseWindow("22:00-02:00")
+	restorationContext.Options.DownloadWindow = &window
+	downloadContext := DownloadContext{restorationContext: restorationContext, speedInBytesBySec: utils.S_1MB}
+	now := time.Date(2016, 8, 1, 12, 0, 0, 0, time.Local)
+
+	// When
+	downloadableSize := downloadContext.downloadableSizeBeforeExpiry(now)
+
+	// Then
+	assert.Equal(t, uint64(4 * 60 * 60 * utils.S_1MB), downloadableSize)
+}
+
+func TestDownloadWindows_no_limit_without_download_window(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	downloadContext := DownloadContext{restorationContext: restorationContext, speedInBytesBySec: utils.S_1MB}
+
+	// When
+	downloadableSize := downloadContext.downloadableSizeBeforeExpiry(time.Now())
+
+	// Then
+	assert.Equal(t, ^uint64(0), downloadableSize)
+}
+
+func TestDownloadWindows_retry_when_download_window_is_full(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	window, _ := schedule.ParseWindow("22:00-02:00")
+	restorationContext.Options.DownloadWindow = &window
+	downloadContext := DownloadContext{restorationContext: restorationContext, speedInBytesBySec: utils.S_1MB,
+		archivesRetrievalSize: 4 * 60 * 60 * utils.S_1MB, retrievalBudget: newRetrievalBudget(awsutils.DataRetrievalPolicy{})}
+	now := time.Date(2016, 8, 1, 12, 0, 0, 0, time.Local)
+
+	// When
+	nextDate, reason, nextSizeDetail := downloadContext.nextRetrievalAttempt(now)
+
+	// Then
+	assert.Equal(t, time.Date(2016, 8, 1, 22, 0, 0, 0, time.Local), nextDate)
+	assert.Equal(t, "download window full until retrieved parts are downloaded", reason)
+	assert.Equal(t, "", nextSizeDetail)
+}
+
+func TestDownloadWindows_retry_when_rate_limit_is_reached(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	window, _ := schedule.ParseWindow("22:00-02:00")
+	restorationContext.Options.DownloadWindow = &window
+	budget := newRetrievalBudget(awsutils.DataRetrievalPolicy{Strategy: BYTES_PER_HOUR_STRATEGY, BytesPerHour: utils.S_1MB})
+	now := time.Date(2016, 8, 1, 12, 0, 0, 0, time.Local)
+	budget.record(now.Add(-time.Hour), budget.windowMaxSize())
+	downloadContext := DownloadContext{restorationContext: restorationContext, speedInBytesBySec: utils.S_1MB,
+		archivesRetrievalSize: utils.S_1MB, retrievalBudget: budget}
+
+	// When
+	nextDate, reason, nextSizeDetail := downloadContext.nextRetrievalAttempt(now)
+
+	// Then
+	assert.Equal(t, now.Add(-time.Hour).Add(retrievalPolicyWindow), nextDate)
+	assert.Equal(t, "rate limit reached", reason)
+	assert.Equal(t, " for " + bytefmt.ByteSize(budget.windowMaxSize()), nextSizeDetail)
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"time"
+	"code.cloudfoundry.org/bytefmt"
+	"rsg/awsutils"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Estimate what a restore of the filtered files would retrieve, and how long it would last.
+//
+// The retrieval duration is only known with the BytesPerHour strategy of the data retrieval policy, the
+// download duration needs a speed given by --speed or measured on previous glacier downloads. A retrieval
+// job lasts about 4 hours, so a restore never lasts less.
+
+const retrievalJobDuration = 4 * time.Hour
+
+type RestorationEstimate struct {
+	Region            string
+	Vault             string
+	NbFiles           int
+	NbArchives        int
+	Size              uint64
+	RetrievalPolicy   awsutils.DataRetrievalPolicy
+	RetrievalDuration time.Duration // 0 if the policy has no known limit
+	DownloadSpeed     uint64        // bytes by second, 0 if unknown
+	DownloadDuration  time.Duration // 0 if the download speed is unknown
+}
+
+func EstimateRestoration(restorationContext *RestorationContext) *RestorationEstimate {
+	estimate := &RestorationEstimate{Region: restorationContext.Region, Vault: restorationContext.Vault}
+	db := InitDb(restorationContext.GetMappingFilePath())
+	defer db.Close()
+
+	fileRows := GetFiles(db, restorationContext.Options.Filters)
+	for fileRows.Next() {
+		estimate.NbFiles++
+	}
+	utils.ExitIfError(fileRows.Err())
+	fileRows.Close()
+	archiveRows := GetArchives(db, restorationContext.Options.Filters)
+	for archiveRows.Next() {
+		estimate.NbArchives++
+	}
+	utils.ExitIfError(archiveRows.Err())
+	archiveRows.Close()
+	estimate.Size = GetTotalSize(db, restorationContext.Options.Filters)
+
+	estimate.RetrievalPolicy = awsutils.GetDataRetrievalPolicy(restorationContext.GlacierClient)
+	if budget := newRetrievalBudget(estimate.RetrievalPolicy); budget.hasLimit() {
+		estimate.RetrievalDuration = durationFor(estimate.Size, budget.policy.BytesPerHour, time.Hour)
+	}
+	estimate.DownloadSpeed = restorationContext.Options.Speed
+	if estimate.DownloadSpeed == 0 {
+		estimate.DownloadSpeed = restorationContext.RegionVaultCache.DownloadSpeed
+	}
+	if estimate.DownloadSpeed > 0 {
+		estimate.DownloadDuration = durationFor(estimate.Size, estimate.DownloadSpeed, time.Second)
+	}
+	return estimate
+}
+
+// time to process size at rate bytes by unit, rounded up to the minute
+func durationFor(size, rate uint64, unit time.Duration) time.Duration {
+	duration := time.Duration(float64(size) / float64(rate) * float64(unit))
+	if rounded := duration.Truncate(time.Minute); rounded < duration {
+		return rounded + time.Minute
+	}
+	return duration
+}
+
+// minimal duration of the restore, 0 if it cannot be estimated
+func (estimate *RestorationEstimate) MinDuration() time.Duration {
+	if estimate.Size == 0 || estimate.DownloadDuration == 0 {
+		return 0
+	}
+	duration := estimate.DownloadDuration
+	if estimate.RetrievalDuration > duration {
+		duration = estimate.RetrievalDuration
+	}
+	return duration + retrievalJobDuration
+}
+
+func DisplayRestorationEstimate(estimate *RestorationEstimate) {
+	outputs.Printfln(outputs.Info, "%v files in %v archives, %v to retrieve", estimate.NbFiles, estimate.NbArchives, bytefmt.ByteSize(estimate.Size))
+	if estimate.RetrievalDuration > 0 {
+		outputs.Printfln(outputs.Info, "Retrieval at %v by hour (data retrieval policy): %v", bytefmt.ByteSize(estimate.RetrievalPolicy.BytesPerHour), estimate.RetrievalDuration)
+	} else {
+		outputs.Printfln(outputs.Info, "Retrieval: no known limit with data retrieval policy %s", estimate.RetrievalPolicy.Strategy)
+	}
+	if estimate.DownloadDuration > 0 {
+		outputs.Printfln(outputs.Info, "Download at %v by second: %v", bytefmt.ByteSize(estimate.DownloadSpeed), estimate.DownloadDuration)
+	} else {
+		outputs.Printfln(outputs.Info, "Download: unknown speed, give it with --speed")
+	}
+	if minDuration := estimate.MinDuration(); minDuration > 0 {
+		outputs.Printfln(outputs.Info, "Restore lasts at least %v", minDuration)
+	}
+}
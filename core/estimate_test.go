@@ -0,0 +1,64 @@
+package core
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"rsg/utils"
+)
+
+func createEstimateMappingFile(mappingFilePath string) {
+	db, _ := sql.Open("sqlite3", mappingFilePath)
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 3145728);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file2.txt', 'archiveId2', 1048576);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'other/file3.txt', 'archiveId3', 1048576);")
+	db.Close()
+}
+
+func TestEstimateRestoration_with_bytes_per_hour_policy_and_measured_speed(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	glacierMock.ExpectedCalls = nil
+	mockGetDataRetrievalPolicyWithBytesPerHour(glacierMock, "accountId", utils.S_1MB)
+	createEstimateMappingFile(restorationContext.GetMappingFilePath())
+	restorationContext.Options.Filters = []string{"data/*"}
+	restorationContext.RegionVaultCache.DownloadSpeed = 1024
+
+	// When
+	estimate := EstimateRestoration(restorationContext)
+	DisplayRestorationEstimate(estimate)
+
+	// Then
+	assert.Equal(t, 2, estimate.NbFiles)
+	assert.Equal(t, 2, estimate.NbArchives)
+	assert.Equal(t, uint64(4 * utils.S_1MB), estimate.Size)
+	assert.Equal(t, 4 * time.Hour, estimate.RetrievalDuration)
+	assert.Equal(t, 69 * time.Minute, estimate.DownloadDuration)
+	assert.Equal(t, 8 * time.Hour, estimate.MinDuration())
+	output := string(buffer.Bytes())
+	assert.Contains(t, output, "2 files in 2 archives, 4M to retrieve")
+	assert.Contains(t, output, "Retrieval at 1M by hour (data retrieval policy): 4h0m0s")
+	assert.Contains(t, output, "Download at 1K by second: 1h9m0s")
+	assert.Contains(t, output, "Restore lasts at least 8h0m0s")
+}
+
+func TestEstimateRestoration_without_known_limit_nor_speed(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	createEstimateMappingFile(restorationContext.GetMappingFilePath())
+
+	// When
+	estimate := EstimateRestoration(restorationContext)
+	DisplayRestorationEstimate(estimate)
+
+	// Then
+	assert.Equal(t, 3, estimate.NbFiles)
+	assert.Equal(t, time.Duration(0), estimate.MinDuration())
+	output := string(buffer.Bytes())
+	assert.Contains(t, output, "Retrieval: no known limit with data retrieval policy FreeTier")
+	assert.Contains(t, output, "Download: unknown speed, give it with --speed")
+}
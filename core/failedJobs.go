@@ -0,0 +1,105 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"code.cloudfoundry.org/bytefmt"
+	"rsg/hooks"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// A retrieval job can complete with the Failed status, its output cannot be downloaded.
+//
+// The range of the failed job is retrieved again with a new job, at most JobRetries times (--job-retries).
+// Then the archive is given up: its other parts are dropped, the part of the archive already downloaded is
+// removed from the destination, it is recorded in the failure report of the working directory, and the restore
+// goes on with the other archives.
+
+const failureReportFileName = "failures.json"
+
+type FailedArchive struct {
+	ArchiveId     string
+	Size          uint64
+	Paths         []string
+	JobIds        []string // failed jobs of the range given up
+	StatusMessage string   // of the last failed job
+}
+
+func (restorationContext *RestorationContext) GetFailureReportPath() string {
+	return restorationContext.WorkingDirPath + "/" + failureReportFileName
+}
+
+// start new jobs for the failed jobs of the parts, or give up their archives
+func (downloadContext *DownloadContext) handleFailedJobs() {
+	givenUpArchiveIds := make(map[string]bool)
+	for _, part := range downloadContext.partQueue.failedParts() {
+		if givenUpArchiveIds[part.archiveId] {
+			continue
+		}
+		outputs.Printfln(outputs.Warning, "Retrieval job %s of range %s of archive %s has failed: %s",
+			part.jobId, part.byteRange(), part.archiveId, part.failureMessage)
+		part.failedJobIds = append(part.failedJobIds, part.jobId)
+		if len(part.failedJobIds) > downloadContext.restorationContext.Options.JobRetries {
+			downloadContext.giveUpArchive(part)
+			givenUpArchiveIds[part.archiveId] = true
+			continue
+		}
+		downloadContext.startPartRetrieveJobAgain(part)
+		downloadContext.partQueue.update(part, PART_PENDING)
+		outputs.Printfln(outputs.Warning, "Range %s of archive %s is retrieved again with job %s (retry %v/%v)",
+			part.byteRange(), part.archiveId, part.jobId, len(part.failedJobIds), downloadContext.restorationContext.Options.JobRetries)
+	}
+}
+
+func (downloadContext *DownloadContext) giveUpArchive(failedPart *archivePartRetrieve) {
+	outputs.Printfln(outputs.Error, "Archive %s (%v) is given up after %v failed jobs",
+		failedPart.archiveId, bytefmt.ByteSize(failedPart.archiveSize), len(failedPart.failedJobIds))
+	downloadContext.archivesRetrievalSize -= downloadContext.partQueue.removeArchive(failedPart.archiveId)
+	if downloadContext.uncompletedRetrieve != nil && downloadContext.uncompletedRetrieve.archiveId == failedPart.archiveId {
+		downloadContext.uncompletedRetrieve = nil
+	}
+	// a next restore would resume the archive from it, without the range given up
+	archiveFilePath := downloadContext.restorationContext.DestinationDirPath + "/" + failedPart.archiveId
+	if err := os.Remove(archiveFilePath); err != nil && !os.IsNotExist(err) {
+		outputs.Printfln(outputs.Warning, "Cannot remove the part of archive %s already downloaded: %v", failedPart.archiveId, err)
+	}
+	paths := []string{}
+	pathRows := GetPaths(downloadContext.db, failedPart.archiveId)
+	for pathRows.Next() {
+		var path string
+		pathRows.Scan(&path)
+		paths = append(paths, path)
+	}
+	pathRows.Close()
+	downloadContext.failedArchives = append(downloadContext.failedArchives, FailedArchive{ArchiveId: failedPart.archiveId,
+		Size: failedPart.archiveSize,
+		Paths: paths,
+		JobIds: failedPart.failedJobIds,
+		StatusMessage: failedPart.failureMessage})
+	downloadContext.fireEvent(hooks.Event{Event: hooks.EVENT_ARCHIVE_SKIPPED, JobId: failedPart.jobId, ArchiveId: failedPart.archiveId,
+		Size: failedPart.archiveSize, Error: "retrieval job failed: " + failedPart.failureMessage})
+}
+
+// the report of a previous restore is removed when no archive has failed
+func (downloadContext *DownloadContext) writeFailureReport() {
+	reportPath := downloadContext.restorationContext.GetFailureReportPath()
+	if len(downloadContext.failedArchives) == 0 {
+		os.Remove(reportPath)
+		return
+	}
+	bytes, err := json.MarshalIndent(downloadContext.failedArchives, "", "  ")
+	utils.ExitIfError(err)
+	err = utils.WriteFileAtomically(reportPath, bytes, 0600)
+	utils.ExitIfError(err)
+	nbFiles := 0
+	for _, failedArchive := range downloadContext.failedArchives {
+		nbFiles += len(failedArchive.Paths)
+	}
+	outputs.Printfln(outputs.Error, "%v archives (%v files) cannot be restored, see %s", len(downloadContext.failedArchives), nbFiles, reportPath)
+}
+
+func (part *archivePartRetrieve) byteRange() string {
+	return strconv.FormatUint(part.retrievalByteIndex, 10) + "-" + strconv.FormatUint(part.retrievalByteIndex + part.retrievedSize - 1, 10)
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"strings"
+	"time"
+	"code.cloudfoundry.org/bytefmt"
+	"rsg/awsutils"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Output of a retrieval job can be downloaded only during 24 hours after its completion.
+//
+// Parts whose output expires first are downloaded first. When the output of a part expires, or would expire
+// before the end of its download, the range is retrieved again with a new job: it is billed again and counts
+// in the retrieval budget, but the restoration does not fail on GetJobOutput.
+
+// time kept between the estimated end of a download and the expiry of the job output
+var JobExpiryMargin = 10 * time.Minute
+
+func (part *archivePartRetrieve) expiryDate() time.Time {
+	return part.completionDate.Add(jobOutputAvailability)
+}
+
+func (downloadContext *DownloadContext) outputExpiresBeforeDownload(part *archivePartRetrieve, now time.Time) bool {
+	if part.completionDate.IsZero() {
+		return false
+	}
+	sizeToDownload := part.retrievedSize - downloadContext.nextByteIndexToDownload
+	downloadDuration := time.Duration(0)
+	if downloadContext.speedInBytesBySec > 0 {
+		downloadDuration = time.Duration(sizeToDownload / downloadContext.speedInBytesBySec) * time.Second
+	}
+	return now.Add(downloadDuration + JobExpiryMargin).After(part.expiryDate())
+}
+
+// start a new job for the part being downloaded and put it back in the queue of parts to download
+func (downloadContext *DownloadContext) retrieveExpiringPartAgain() {
+	part := downloadContext.uncompletedDownload
+	outputs.Printfln(outputs.Warning, "Output of job %s expires at %s before the end of its download, range %s of archive %s (%v) is retrieved again with a new job",
+		part.jobId, part.expiryDate().Local().Format("15:04"), part.byteRange(), part.archiveId, bytefmt.ByteSize(part.retrievedSize))
+	downloadContext.startPartRetrieveJobAgain(part)
+	// bytes already downloaded from the expired output are downloaded again
+	downloadContext.archivesRetrievalSize += downloadContext.nextByteIndexToDownload
+	downloadContext.nbBytesDownloaded -= downloadContext.nextByteIndexToDownload
+	downloadContext.nextByteIndexToDownload = 0
+	part.nextByteIndexToWrite = part.retrievalByteIndex
+	downloadContext.uncompletedDownload = nil
+	downloadContext.partQueue.requeue(part)
+}
+
+// the job found at startup for the range is not resumed, the new job is billed and counts in the retrieval budget
+func (downloadContext *DownloadContext) startPartRetrieveJobAgain(part *archivePartRetrieve) {
+	restorationContext := downloadContext.restorationContext
+	awsutils.JobIdsAtStartup.ForgetFileRetrievalJob(part.archiveId, part.byteRange())
+	for {
+		jobStartStatus := awsutils.StartRetrievePartialArchiveJob(restorationContext.GlacierClient, restorationContext.Vault,
+			awsutils.Archive{ArchiveId: part.archiveId, Size: part.archiveSize}, part.retrievalByteIndex, part.retrievedSize)
+		if jobStartStatus.Err == nil {
+			downloadContext.retrievalBudget.record(time.Now(), jobStartStatus.SizeRetrieved)
+			part.jobId = jobStartStatus.JobId
+			part.creationDate = time.Now()
+			break
+		}
+		if !strings.Contains(jobStartStatus.Err.Error(), "PolicyEnforcedException") {
+			utils.ExitIfError(jobStartStatus.Err)
+		}
+		downloadContext.retrievalBudget.recordPolicyEnforced(time.Now())
+		nextDate, _ := downloadContext.retrievalBudget.nextAttempt(time.Now(), part.retrievedSize)
+		if !nextDate.After(time.Now()) {
+			nextDate = time.Now().Add(RetryMinWaitTime)
+		}
+		downloadContext.displayStatus("rate limit reached, next attempt at " + nextDate.Format("15:04"))
+		time.Sleep(nextDate.Sub(time.Now()))
+	}
+	part.completionDate = time.Time{}
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"rsg/awsutils"
+	"rsg/utils"
+)
+
+func initJobExpiryTest() (*GlacierMock, *DownloadContext) {
+	glacierMock, restorationContext := InitTestWithGlacier()
+	downloadContext := &DownloadContext{
+		restorationContext: restorationContext,
+		speedInBytesBySec: 1,
+		archivesRetrievalMaxSize: utils.S_1MB,
+		speedAutoUpdate: false,
+		partQueueMaxSize: 1,
+	}
+
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
+	db.Close()
+	return glacierMock, downloadContext
+}
+
+func TestJobExpiry_expired_job_found_at_startup_is_started_again(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, downloadContext := initJobExpiryTest()
+	awsutils.AddRetrievalJobAtStartup("archiveId1", "0-4", "expiredJobId")
+	awsutils.AddRetrievalJobCompletionAtStartup("expiredJobId", time.Now().Add(-25 * time.Hour))
+
+	mockStartPartialRetrieveJob(glacierMock, "vault", "archiveId1", "0-4", "jobId1")
+	mockCompletedJobs(glacierMock, "vault", "jobId1")
+	mockPartialOutputJob(glacierMock, "jobId1", "vault", "0-4", []byte("hello"))
+
+	// When
+	downloadContext.downloadArchives()
+
+	// Then
+	assertFileContent(t, "../../testtmp/dest/share/data/file1.txt", "hello")
+	assert.Contains(t, string(buffer.Bytes()), "WARNING: Output of job expiredJobId found at startup has expired, range 0-4 of archive archiveId1 is retrieved again with a new job")
+}
+
+func TestJobExpiry_part_expiring_before_its_download_is_retrieved_again(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, downloadContext := initJobExpiryTest()
+	awsutils.AddRetrievalJobAtStartup("archiveId1", "0-4", "expiringJobId")
+	awsutils.AddRetrievalJobCompletionAtStartup("expiringJobId", time.Now().Add(-awsutils.JobOutputAvailability + 5 * time.Minute))
+
+	mockCompletedJobs(glacierMock, "vault", "expiringJobId", "jobId1")
+	mockStartPartialRetrieveJob(glacierMock, "vault", "archiveId1", "0-4", "jobId1")
+	mockPartialOutputJob(glacierMock, "jobId1", "vault", "0-4", []byte("hello"))
+
+	// When
+	downloadContext.downloadArchives()
+
+	// Then
+	assertFileContent(t, "../../testtmp/dest/share/data/file1.txt", "hello")
+	assert.Contains(t, string(buffer.Bytes()), "before the end of its download, range 0-4 of archive archiveId1 (5B) is retrieved again with a new job")
+	glacierMock.AssertNumberOfCalls(t, "GetJobOutput", 1)
+}
+
+func TestJobExpiry_parts_completed_before_the_run_are_downloaded_first(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	queue := initTestPartQueue(restorationContext,
+		&archivePartRetrieve{jobId: "jobId1", archiveId: "archiveId1", retrievalByteIndex: 0},
+		&archivePartRetrieve{jobId: "jobId2", archiveId: "archiveId2"},
+		&archivePartRetrieve{jobId: "jobId3", archiveId: "archiveId3", completionDate: time.Now().Add(-20 * time.Hour)},
+		&archivePartRetrieve{jobId: "jobId4", archiveId: "archiveId1", retrievalByteIndex: utils.S_1MB, completionDate: time.Now().Add(-21 * time.Hour)})
+	defer queue.close()
+	downloadContext := DownloadContext{restorationContext: restorationContext, partQueue: queue}
+	mockCompletedJobs(glacierMock, restorationContext.Vault, "jobId1", "jobId2")
+
+	// When
+	downloadContext.prioritizeExpiringParts()
+
+	// Then
+	assert.Equal(t, []string{"jobId3", "jobId1", "jobId4", "jobId2"}, takeReadyJobIds(queue))
+}
@@ -1,20 +1,198 @@
 package core
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/aws/aws-sdk-go/service/glacier"
 	"rsg/awsutils"
+	"rsg/options"
 	"rsg/outputs"
-	"github.com/aws/aws-sdk-go/service/glacier"
+	"rsg/utils"
 )
 
-// List aws jobs
+// List aws jobs of the mapping and data vaults.
+//
+// Jobs can be filtered by status, action and age, and are displayed as a table or as json. The output of a
+// completed job is available 24 hours, the time left before its expiry is displayed. The files covered by an
+// archive retrieval job are found in the mapping file when it has been downloaded.
+
+type JobsFilter struct {
+	Statuses []string      // InProgress, Succeeded or Failed, all if empty
+	Actions  []string      // ArchiveRetrieval or InventoryRetrieval, all if empty
+	MaxAge   time.Duration // no limit if 0
+}
+
+type JobInfo struct {
+	Region             string
+	Vault              string
+	JobId              string
+	Action             string
+	Status             string
+	StatusMessage      string
+	CreationDate       string
+	CompletionDate     string
+	ExpiryDate         string
+	ArchiveId          string
+	Size               uint64
+	RetrievalByteRange string
+	Paths              []string
+}
 
+// list jobs of the vaults without filter, as a table
 func ListJobs(restorationContext *RestorationContext) {
-	displayJobsFn := func(page *glacier.ListJobsOutput, lastPage bool) bool {
-		for _, desc := range page.JobList {
-			outputs.Printfln(outputs.Info, "%s", desc.String())
+	DisplayJobs(GetJobs(restorationContext, JobsFilter{}, time.Now()), options.OUTPUT_TABLE, time.Now())
+}
+
+func GetJobs(restorationContext *RestorationContext, jobsFilter JobsFilter, now time.Time) []*JobInfo {
+	var db *sql.DB
+	if utils.Exists(restorationContext.GetMappingFilePath()) {
+		db = InitDb(restorationContext.GetMappingFilePath())
+		defer db.Close()
+	}
+	jobs := []*JobInfo{}
+	for _, vault := range []string{restorationContext.MappingVault, restorationContext.Vault} {
+		awsutils.DoOnJobPages(restorationContext.GlacierClient, vault, func(page *glacier.ListJobsOutput, lastPage bool) bool {
+			for _, desc := range page.JobList {
+				if jobsFilter.accept(desc, now) {
+					job := newJobInfo(restorationContext.Region, vault, desc)
+					if vault == restorationContext.MappingVault {
+						job.Paths = []string{"mapping file"}
+					} else if db != nil && job.ArchiveId != "" {
+						job.Paths = getArchivePaths(db, job.ArchiveId)
+					}
+					jobs = append(jobs, job)
+				}
+			}
+			return true
+		})
+	}
+	return jobs
+}
+
+func (jobsFilter JobsFilter) accept(desc *glacier.JobDescription, now time.Time) bool {
+	if len(jobsFilter.Statuses) > 0 && !containsIgnoreCase(jobsFilter.Statuses, stringValue(desc.StatusCode)) {
+		return false
+	}
+	if len(jobsFilter.Actions) > 0 && !containsIgnoreCase(jobsFilter.Actions, stringValue(desc.Action)) {
+		return false
+	}
+	if jobsFilter.MaxAge > 0 {
+		if creationDate, err := time.Parse(time.RFC3339, stringValue(desc.CreationDate)); err == nil && now.Sub(creationDate) > jobsFilter.MaxAge {
+			return false
 		}
-		return true
 	}
-	awsutils.DoOnJobPages(restorationContext.GlacierClient, restorationContext.MappingVault, displayJobsFn)
-	awsutils.DoOnJobPages(restorationContext.GlacierClient, restorationContext.Vault, displayJobsFn)
+	return true
+}
+
+func newJobInfo(region, vault string, desc *glacier.JobDescription) *JobInfo {
+	job := &JobInfo{Region: region,
+		Vault: vault,
+		JobId: stringValue(desc.JobId),
+		Action: stringValue(desc.Action),
+		Status: stringValue(desc.StatusCode),
+		StatusMessage: stringValue(desc.StatusMessage),
+		CreationDate: stringValue(desc.CreationDate),
+		CompletionDate: stringValue(desc.CompletionDate),
+		ArchiveId: stringValue(desc.ArchiveId),
+		RetrievalByteRange: stringValue(desc.RetrievalByteRange),
+	}
+	if desc.ArchiveSizeInBytes != nil && *desc.ArchiveSizeInBytes > 0 {
+		job.Size = uint64(*desc.ArchiveSizeInBytes)
+	}
+	if desc.InventorySizeInBytes != nil && *desc.InventorySizeInBytes > 0 {
+		job.Size = uint64(*desc.InventorySizeInBytes)
+	}
+	if start, end, ok := parseByteRange(job.RetrievalByteRange); ok {
+		job.Size = end - start + 1
+	}
+	if completionDate, err := time.Parse(time.RFC3339, job.CompletionDate); err == nil && job.Status == "Succeeded" {
+		job.ExpiryDate = completionDate.Add(jobOutputAvailability).UTC().Format(time.RFC3339)
+	}
+	return job
+}
+
+func DisplayJobs(jobs []*JobInfo, output string, now time.Time) {
+	if output == options.OUTPUT_JSON {
+		content, err := json.MarshalIndent(jobs, "", "  ")
+		utils.ExitIfError(err)
+		outputs.Println(outputs.Info, string(content))
+		return
+	}
+	buffer := new(bytes.Buffer)
+	writer := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VAULT\tJOB ID\tACTION\tSTATUS\tAGE\tSIZE\tRANGE\tEXPIRES IN\tFILES")
+	for _, job := range jobs {
+		fmt.Fprintf(writer, "%s:%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", job.Region, job.Vault, job.JobId, job.Action, job.Status,
+			describeJobAge(job, now), bytefmt.ByteSize(job.Size), describeByteRange(job.RetrievalByteRange),
+			describeExpiry(job, now), strings.Join(job.Paths, ", "))
+	}
+	writer.Flush()
+	outputs.Printfln(outputs.Info, "%s", strings.TrimSuffix(buffer.String(), "\n"))
+}
+
+func describeJobAge(job *JobInfo, now time.Time) string {
+	creationDate, err := time.Parse(time.RFC3339, job.CreationDate)
+	if err != nil {
+		return "-"
+	}
+	return now.Sub(creationDate).Truncate(time.Minute).String()
+}
+
+func describeExpiry(job *JobInfo, now time.Time) string {
+	expiryDate, err := time.Parse(time.RFC3339, job.ExpiryDate)
+	if err != nil {
+		return "-"
+	}
+	if !expiryDate.After(now) {
+		return "expired"
+	}
+	return expiryDate.Sub(now).Truncate(time.Minute).String()
+}
+
+// "0-4194303" is displayed "0-4M"
+func describeByteRange(byteRange string) string {
+	start, end, ok := parseByteRange(byteRange)
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%s-%s", bytefmt.ByteSize(start), bytefmt.ByteSize(end + 1))
+}
+
+func parseByteRange(byteRange string) (uint64, uint64, bool) {
+	bounds := strings.Split(byteRange, "-")
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseUint(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err := strconv.ParseUint(bounds[1], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func containsIgnoreCase(values []string, toFind string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, toFind) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
 }
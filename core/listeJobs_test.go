@@ -0,0 +1,89 @@
+package core
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/stretchr/testify/assert"
+	"rsg/options"
+)
+
+func mockJobsOfVaults(glacierMock *GlacierMock) {
+	mockListJobs(glacierMock, "vault_mapping",
+		&glacier.JobDescription{JobId: aws.String("mappingJobId"), Action: aws.String("ArchiveRetrieval"), StatusCode: aws.String("Succeeded"),
+			CreationDate: aws.String("2016-08-02T08:00:00.000Z"), CompletionDate: aws.String("2016-08-02T12:00:00.000Z"), ArchiveSizeInBytes: aws.Int64(42)})
+	mockListJobs(glacierMock, "vault",
+		&glacier.JobDescription{JobId: aws.String("jobId1"), Action: aws.String("ArchiveRetrieval"), StatusCode: aws.String("InProgress"),
+			CreationDate: aws.String("2016-08-02T13:00:00.000Z"), ArchiveId: aws.String("archiveId1"), RetrievalByteRange: aws.String("0-4194303")},
+		&glacier.JobDescription{JobId: aws.String("jobId2"), Action: aws.String("InventoryRetrieval"), StatusCode: aws.String("Failed"),
+			CreationDate: aws.String("2016-07-01T13:00:00.000Z")})
+}
+
+func TestGetJobs_map_jobs_to_files(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5000000);")
+	db.Close()
+	mockJobsOfVaults(glacierMock)
+	now, _ := time.Parse(time.RFC3339, "2016-08-02T14:00:00Z")
+
+	// When
+	jobs := GetJobs(restorationContext, JobsFilter{}, now)
+
+	// Then
+	assert.Equal(t, 3, len(jobs))
+	assert.Equal(t, "2016-08-03T12:00:00Z", jobs[0].ExpiryDate)
+	assert.Equal(t, []string{"mapping file"}, jobs[0].Paths)
+	assert.Equal(t, uint64(4194304), jobs[1].Size)
+	assert.Equal(t, []string{"share/data/file1.txt"}, jobs[1].Paths)
+	assert.Equal(t, "", jobs[2].ExpiryDate)
+}
+
+func TestGetJobs_filter_by_status_action_and_age(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	mockJobsOfVaults(glacierMock)
+	now, _ := time.Parse(time.RFC3339, "2016-08-02T14:00:00Z")
+
+	// When
+	jobsByStatus := GetJobs(restorationContext, JobsFilter{Statuses: []string{"inprogress", "Failed"}}, now)
+	jobsByAction := GetJobs(restorationContext, JobsFilter{Actions: []string{"ArchiveRetrieval"}}, now)
+	jobsByAge := GetJobs(restorationContext, JobsFilter{MaxAge: 24 * time.Hour}, now)
+
+	// Then
+	assert.Equal(t, []string{"jobId1", "jobId2"}, jobIds(jobsByStatus))
+	assert.Equal(t, []string{"mappingJobId", "jobId1"}, jobIds(jobsByAction))
+	assert.Equal(t, []string{"mappingJobId", "jobId1"}, jobIds(jobsByAge))
+}
+
+func TestDisplayJobs_as_table(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	mockJobsOfVaults(glacierMock)
+	now, _ := time.Parse(time.RFC3339, "2016-08-02T14:00:00Z")
+
+	// When
+	DisplayJobs(GetJobs(restorationContext, JobsFilter{}, now), options.OUTPUT_TABLE, now)
+
+	// Then
+	output := string(buffer.Bytes())
+	assert.Contains(t, output, "VAULT                 JOB ID        ACTION              STATUS      AGE       SIZE  RANGE  EXPIRES IN  FILES")
+	assert.Contains(t, output, "region:vault_mapping  mappingJobId  ArchiveRetrieval    Succeeded   6h0m0s    42B   -      22h0m0s     mapping file")
+	assert.Contains(t, output, "region:vault          jobId1        ArchiveRetrieval    InProgress  1h0m0s    4M    0-4M   -")
+	assert.Contains(t, output, "region:vault          jobId2        InventoryRetrieval  Failed      769h0m0s  0     -      -")
+}
+
+func jobIds(jobs []*JobInfo) []string {
+	jobIds := []string{}
+	for _, job := range jobs {
+		jobIds = append(jobIds, job.JobId)
+	}
+	return jobIds
+}
@@ -5,17 +5,27 @@ import (
 	"rsg/utils"
 	"rsg/inputs"
 	"rsg/awsutils"
+	"rsg/hooks"
 	"strings"
 	"os"
 	"fmt"
 	"time"
 	"code.cloudfoundry.org/bytefmt"
+	"errors"
+	"sort"
 )
 
 // Download mapping file
+//
+// A mapping vault can contain several mapping archives (after a re-upload or an interrupted upload by
+// synology), the newest one is used unless another one is selected by id or by date.
+
+const mappingArchiveDateFormat = "2006-01-02"
 
 func DownloadMappingArchive(restorationContext *RestorationContext) {
-	if stat, err := os.Stat(restorationContext.GetMappingFilePath()); os.IsNotExist(err) {
+	if restorationContext.Options.MappingArchive != "" {
+		downloadSelectedMappingArchive(restorationContext)
+	} else if stat, err := os.Stat(restorationContext.GetMappingFilePath()); os.IsNotExist(err) {
 		downloadMappingArchive(restorationContext)
 	} else if queryAndUpdateRefreshMappingFile(restorationContext, stat.ModTime().Format("Mon Jan _2 15:04:05 2006")) {
 		os.Remove(restorationContext.GetMappingFilePath())
@@ -23,16 +33,39 @@ func DownloadMappingArchive(restorationContext *RestorationContext) {
 	}
 }
 
+// the local mapping file is kept only if it comes from the selected mapping archive, the mapping vault is not
+// inventoried again while the selection is the same, unless the mapping file is refreshed
+func downloadSelectedMappingArchive(restorationContext *RestorationContext) {
+	selection := restorationContext.Options.MappingArchive
+	mappingFileArchive := restorationContext.RegionVaultCache.MappingFileArchive
+	refresh := restorationContext.Options.RefreshMappingFile != nil && *restorationContext.Options.RefreshMappingFile
+	if refresh {
+		restorationContext.RegionVaultCache.MappingArchive = nil
+	} else if mappingFileArchive != nil && (restorationContext.RegionVaultCache.MappingFileSelection == selection || mappingFileArchive.ArchiveId == selection) &&
+		utils.Exists(restorationContext.GetMappingFilePath()) {
+		outputs.Printfln(outputs.OptionalInfo, "Local mapping file of archive created %s is used", mappingFileArchive.CreationDate)
+		return
+	}
+	mappingArchive := getMappingArchive(restorationContext)
+	if mappingFileArchive != nil && mappingFileArchive.ArchiveId == mappingArchive.ArchiveId && utils.Exists(restorationContext.GetMappingFilePath()) {
+		outputs.Printfln(outputs.OptionalInfo, "Local mapping file of archive created %s is used", mappingArchive.CreationDate)
+		return
+	}
+	os.Remove(restorationContext.GetMappingFilePath())
+	downloadMappingArchive(restorationContext)
+}
+
 func queryAndUpdateRefreshMappingFile(restorationContext *RestorationContext, modTime string) bool {
 	if restorationContext.Options.RefreshMappingFile == nil {
-		answer := inputs.QueryYesOrNo(fmt.Sprintf("Local mapping archive already exists with last modification date %v, retrieve a new mapping file ?", modTime), false)
+		answer := inputs.QueryYesOrNo("refresh-mapping-file", fmt.Sprintf("Local mapping archive already exists with last modification date %v, retrieve a new mapping file ?", modTime), false)
 		restorationContext.Options.RefreshMappingFile = &answer
 	}
 	return *restorationContext.Options.RefreshMappingFile
 }
 
 func downloadMappingArchive(restorationContext *RestorationContext) {
-	jobId, jobCompleted := checkRetrieveMappingOrStartNewJob(restorationContext, getMappingArchive(restorationContext))
+	mappingArchive := getMappingArchive(restorationContext)
+	jobId, jobCompleted := checkRetrieveMappingOrStartNewJob(restorationContext, mappingArchive)
 	if !jobCompleted {
 		awsutils.WaitJobIsCompleted(restorationContext.GlacierClient, restorationContext.MappingVault, jobId)
 		outputs.Printfln(outputs.OptionalInfo, "Job has finished: %s", jobId)
@@ -41,14 +74,22 @@ func downloadMappingArchive(restorationContext *RestorationContext) {
 	sizeDownloaded := awsutils.DownloadArchiveTo(restorationContext.GlacierClient, restorationContext.MappingVault, jobId, restorationContext.GetMappingFilePath())
 	restorationContext.BytesBySecond = uint64(float64(sizeDownloaded) / time.Since(start).Seconds())
 	outputs.Printfln(outputs.Verbose, "New download speed: %v/s", bytefmt.ByteSize(restorationContext.BytesBySecond))
+	if restorationContext.BytesBySecond > 0 {
+		restorationContext.RegionVaultCache.DownloadSpeed = restorationContext.BytesBySecond
+	}
 	restorationContext.RegionVaultCache.MappingArchive = nil
+	restorationContext.RegionVaultCache.MappingFileArchive = &mappingArchive
+	restorationContext.RegionVaultCache.MappingFileSelection = restorationContext.RegionVaultCache.MappingArchiveSelection
+	restorationContext.RegionVaultCache.MappingArchiveSelection = ""
 	restorationContext.WriteCache()
 	outputs.Println(outputs.OptionalInfo, "Mapping archive has been downloaded")
+	hooks.Fire(hooks.Event{Event: hooks.EVENT_MAPPING_DOWNLOADED, Region: restorationContext.Region, Vault: restorationContext.Vault,
+		JobId: jobId, ArchiveId: mappingArchive.ArchiveId, Size: sizeDownloaded})
 }
 
 func checkRetrieveMappingOrStartNewJob(restorationContext *RestorationContext, archive awsutils.Archive) (string, bool) {
 	jobCompleted := false
-	jobId := awsutils.JobIdsAtStartup.MappingRetrievalJobId
+	jobId := awsutils.JobIdsAtStartup.GetJobIdForMappingRetrieval(archive.ArchiveId)
 	var err error;
 	if jobId != "" {
 		outputs.Printfln(outputs.Verbose, "Retrieve mapping archive job id found : %s", jobId)
@@ -59,6 +100,9 @@ func checkRetrieveMappingOrStartNewJob(restorationContext *RestorationContext, a
 			} else if strings.Contains(err.Error(), "The job ID was not found") {
 				outputs.Println(outputs.Warning, "Retrieve mapping archive job cached was not found")
 				jobId = startRetrieveMappingArchiveJob(restorationContext, restorationContext.MappingVault, archive)
+			} else if _, failed := err.(*awsutils.JobFailedError); failed {
+				outputs.Printfln(outputs.Warning, "%v, mapping archive is retrieved again", err)
+				jobId = startRetrieveMappingArchiveJob(restorationContext, restorationContext.MappingVault, archive)
 			} else {
 				utils.ExitIfError(err)
 			}
@@ -85,13 +129,16 @@ func startRetrieveMappingArchiveJob(restorationContext *RestorationContext, vaul
 
 func getMappingArchive(restorationContext *RestorationContext) awsutils.Archive {
 	mappingArchive := restorationContext.RegionVaultCache.MappingArchive
-	if mappingArchive == nil {
+	selection := restorationContext.Options.MappingArchive
+	if mappingArchive == nil || (selection != restorationContext.RegionVaultCache.MappingArchiveSelection && selection != mappingArchive.ArchiveId) {
 		jobId, jobCompleted := checkMappingInventoryOrStartNewJob(restorationContext)
 		if jobCompleted == false {
 			awsutils.WaitJobIsCompleted(restorationContext.GlacierClient, restorationContext.MappingVault, jobId)
 			outputs.Printfln(outputs.OptionalInfo, "Job has finished: %s", jobId)
 		}
-		restorationContext.RegionVaultCache.MappingArchive = awsutils.GetArchiveIdFromInventory(restorationContext.GlacierClient, restorationContext.MappingVault, jobId)
+		vaultInventory := awsutils.GetVaultInventory(restorationContext.GlacierClient, restorationContext.MappingVault, jobId)
+		restorationContext.RegionVaultCache.MappingArchive = selectMappingArchive(vaultInventory.ArchiveList, selection)
+		restorationContext.RegionVaultCache.MappingArchiveSelection = selection
 		restorationContext.WriteCache()
 	}
 	outputs.Printfln(outputs.Verbose, "Mapping archive id is %s", restorationContext.RegionVaultCache.MappingArchive.ArchiveId)
@@ -111,6 +158,9 @@ func checkMappingInventoryOrStartNewJob(restorationContext *RestorationContext)
 			} else if strings.Contains(err.Error(), "The job ID was not found") {
 				outputs.Println(outputs.Warning, "Inventory job cahed for mapping vaul was not found")
 				jobId = inventoryMappingVault(restorationContext)
+			} else if _, failed := err.(*awsutils.JobFailedError); failed {
+				outputs.Printfln(outputs.Warning, "%v, inventory of mapping vault is started again", err)
+				jobId = inventoryMappingVault(restorationContext)
 			} else {
 				utils.ExitIfError(err)
 			}
@@ -122,9 +172,47 @@ func checkMappingInventoryOrStartNewJob(restorationContext *RestorationContext)
 }
 
 func inventoryMappingVault(restorationContext *RestorationContext) string {
-	jobId := awsutils.InventoryTowElementsOfVault(restorationContext.GlacierClient, restorationContext.MappingVault)
+	jobId := awsutils.InventoryVault(restorationContext.GlacierClient, restorationContext.MappingVault)
 	outputs.Printfln(outputs.OptionalInfo, "Job to find mapping archive id has started (can last up to 4 hours): %s", jobId)
 	return jobId
 }
 
+// newest archive, or archive with the given id, or newest archive created before the end of the given day
+func selectMappingArchive(mappingArchives []awsutils.Archive, selection string) *awsutils.Archive {
+	if len(mappingArchives) == 0 {
+		utils.ExitIfError(errors.New("Mapping vault has no archive"))
+	}
+	sortedMappingArchives := make([]awsutils.Archive, len(mappingArchives))
+	copy(sortedMappingArchives, mappingArchives)
+	sort.SliceStable(sortedMappingArchives, func(i, j int) bool {
+		return parseCreationDate(sortedMappingArchives[i]).After(parseCreationDate(sortedMappingArchives[j]))
+	})
+	if len(sortedMappingArchives) > 1 {
+		outputs.Printfln(outputs.OptionalInfo, "%v mapping archives found in mapping vault:", len(sortedMappingArchives))
+		for _, mappingArchive := range sortedMappingArchives {
+			outputs.Printfln(outputs.OptionalInfo, "  %s (%v, created %s)", mappingArchive.ArchiveId, bytefmt.ByteSize(mappingArchive.Size), mappingArchive.CreationDate)
+		}
+	}
+	if selection == "" {
+		return &sortedMappingArchives[0]
+	}
+	for i := range sortedMappingArchives {
+		if sortedMappingArchives[i].ArchiveId == selection {
+			return &sortedMappingArchives[i]
+		}
+	}
+	if day, err := time.ParseInLocation(mappingArchiveDateFormat, selection, time.Local); err == nil {
+		for i := range sortedMappingArchives {
+			if parseCreationDate(sortedMappingArchives[i]).Before(day.AddDate(0, 0, 1)) {
+				return &sortedMappingArchives[i]
+			}
+		}
+	}
+	utils.ExitIfError(errors.New("No mapping archive found for " + selection))
+	return nil
+}
 
+func parseCreationDate(archive awsutils.Archive) time.Time {
+	creationDate, _ := time.Parse(time.RFC3339, archive.CreationDate)
+	return creationDate
+}
@@ -24,7 +24,6 @@ func mockStartMappingJobInventory(glacierMock *GlacierMock, vault string) *mock.
 		VaultName: aws.String(vault),
 		JobParameters: &glacier.JobParameters{
 			Type:        aws.String("inventory-retrieval"),
-			InventoryRetrievalParameters: &glacier.InventoryRetrievalJobInput{Limit: aws.String("2")},
 		},
 	}
 
@@ -172,6 +171,37 @@ func TestDownloadMappingArchive_download_mapping_with_inventory_job_deprecated(t
 		"Mapping archive has been downloaded" + consts.LINE_BREAK, string(buffer.Bytes()))
 }
 
+func TestDownloadMappingArchive_download_mapping_when_inventory_job_has_failed(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	awsutils.JobIdsAtStartup.MappingInventoryJobId = "failedInventoryMappingJobId"
+
+	glacierMock.On("DescribeJob", &glacier.DescribeJobInput{
+		AccountId: aws.String(awsutils.AccountId),
+		JobId:     aws.String("failedInventoryMappingJobId"),
+		VaultName: aws.String(restorationContext.MappingVault),
+	}).Return(&glacier.JobDescription{Completed: aws.Bool(true), StatusCode: aws.String("Failed"), StatusMessage: aws.String("Inventory cannot be generated")}, nil)
+	mockStartMappingJobInventory(glacierMock, restorationContext.MappingVault)
+	mockDescribeJob(glacierMock, "inventoryMappingJobId", restorationContext.MappingVault, true)
+	mockOutputJob(glacierMock, "inventoryMappingJobId", restorationContext.MappingVault, []byte("{\"ArchiveList\":[{\"ArchiveId\":\"mappingArchiveId\",\"Size\":42}]}"))
+	mockStartRetrieveJob(glacierMock, restorationContext.MappingVault, "mappingArchiveId", "0-41", "retrieveMappingJobId")
+	mockDescribeJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, true)
+	mockOutputJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, []byte("hello !"))
+
+	// When
+	DownloadMappingArchive(restorationContext)
+
+	// Then
+	assertMappingArchive(t, "hello !")
+	assert.Equal(t, "WARNING: Job failedInventoryMappingJobId has failed: Inventory cannot be generated, inventory of mapping vault is started again" + consts.LINE_BREAK +
+		"Job to find mapping archive id has started (can last up to 4 hours): inventoryMappingJobId" + consts.LINE_BREAK +
+		"Job has finished: inventoryMappingJobId" + consts.LINE_BREAK +
+		"Job to retrieve mapping archive has started (can last up to 4 hours): retrieveMappingJobId" + consts.LINE_BREAK +
+		"Job has finished: retrieveMappingJobId" + consts.LINE_BREAK +
+		"Mapping archive has been downloaded" + consts.LINE_BREAK, string(buffer.Bytes()))
+}
+
 func TestDownloadMappingArchive_download_mapping_with_inventory_done(t *testing.T) {
 	// Given
 	buffer := CommonInitTest()
@@ -200,8 +230,8 @@ func TestDownloadMappingArchive_download_mapping_with_retrieve_job_in_progress(t
 	// Given
 	buffer := CommonInitTest()
 	glacierMock, restorationContext := InitTestWithGlacier()
-	awsutils.JobIdsAtStartup.MappingRetrievalJobId = "retrieveMappingJobId"
-	restorationContext.RegionVaultCache = RegionVaultCache{MappingArchive: &awsutils.Archive{"mappingArchiveId", 42},}
+	awsutils.AddMappingRetrievalJobAtStartup("mappingArchiveId", "retrieveMappingJobId")
+	restorationContext.RegionVaultCache = RegionVaultCache{MappingArchive: &awsutils.Archive{ArchiveId: "mappingArchiveId", Size: 42},}
 
 	mockDescribeJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, false).Once()
 	mockDescribeJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, true)
@@ -223,8 +253,8 @@ func TestDownloadMappingArchive_download_mapping_with_retrieve_job_deprecated(t
 	// Given
 	buffer := CommonInitTest()
 	glacierMock, restorationContext := InitTestWithGlacier()
-	awsutils.JobIdsAtStartup.MappingRetrievalJobId = "unknownRetrieveMappingJobId"
-	restorationContext.RegionVaultCache = RegionVaultCache{MappingArchive: &awsutils.Archive{"mappingArchiveId", 42},}
+	awsutils.AddMappingRetrievalJobAtStartup("mappingArchiveId", "unknownRetrieveMappingJobId")
+	restorationContext.RegionVaultCache = RegionVaultCache{MappingArchive: &awsutils.Archive{ArchiveId: "mappingArchiveId", Size: 42},}
 
 	mockDescribeJobErr(glacierMock, "unknownRetrieveMappingJobId", restorationContext.MappingVault, errors.New("The job ID was not found"))
 	mockStartRetrieveJob(glacierMock, restorationContext.MappingVault, "mappingArchiveId", "0-41", "retrieveMappingJobId")
@@ -248,8 +278,8 @@ func TestDownloadMappingArchive_download_mapping_with_retrieve_done(t *testing.T
 	// Given
 	buffer := CommonInitTest()
 	glacierMock, restorationContext := InitTestWithGlacier()
-	awsutils.JobIdsAtStartup.MappingRetrievalJobId = "retrieveMappingJobId"
-	restorationContext.RegionVaultCache = RegionVaultCache{MappingArchive: &awsutils.Archive{"mappingArchiveId", 42},}
+	awsutils.AddMappingRetrievalJobAtStartup("mappingArchiveId", "retrieveMappingJobId")
+	restorationContext.RegionVaultCache = RegionVaultCache{MappingArchive: &awsutils.Archive{ArchiveId: "mappingArchiveId", Size: 42},}
 
 	mockDescribeJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, true)
 	mockOutputJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, []byte("hello !"))
@@ -269,8 +299,8 @@ func TestDownloadMappingArchive_download_mapping_with_mapping_already_exists(t *
 	buffer := CommonInitTest()
 	glacierMock := new(GlacierMock)
 	restorationContext := DefaultRestorationContext(glacierMock)
-	awsutils.JobIdsAtStartup.MappingRetrievalJobId = "retrieveMappingJobId"
-	restorationContext.RegionVaultCache = RegionVaultCache{MappingArchive: &awsutils.Archive{"mappingArchiveId", 42},}
+	awsutils.AddMappingRetrievalJobAtStartup("mappingArchiveId", "retrieveMappingJobId")
+	restorationContext.RegionVaultCache = RegionVaultCache{MappingArchive: &awsutils.Archive{ArchiveId: "mappingArchiveId", Size: 42},}
 
 	ioutil.WriteFile("../../testtmp/cache/mapping.sqllite", []byte("hello !"), 0600)
 
@@ -321,6 +351,117 @@ func TestDownloadMappingArchive_download_mapping_with_mapping_already_exists_but
 	assert.Equal(t, "Mapping archive has been downloaded", outputs[4])
 }
 
+func TestDownloadMappingArchive_download_newest_of_several_mapping_archives(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	awsutils.JobIdsAtStartup.MappingInventoryJobId = "inventoryMappingJobId"
+
+	mockDescribeJob(glacierMock, "inventoryMappingJobId", restorationContext.MappingVault, true)
+	mockOutputJob(glacierMock, "inventoryMappingJobId", restorationContext.MappingVault, []byte("{\"ArchiveList\":[" +
+		"{\"ArchiveId\":\"oldMappingArchiveId\",\"Size\":10,\"CreationDate\":\"2016-07-01T10:00:00Z\"}," +
+		"{\"ArchiveId\":\"mappingArchiveId\",\"Size\":42,\"CreationDate\":\"2016-08-01T10:00:00Z\"}]}"))
+	mockStartRetrieveJob(glacierMock, restorationContext.MappingVault, "mappingArchiveId", "0-41", "retrieveMappingJobId")
+	mockDescribeJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, true)
+	mockOutputJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, []byte("hello !"))
+
+	// When
+	DownloadMappingArchive(restorationContext)
+
+	// Then
+	assertMappingArchive(t, "hello !")
+	assert.Equal(t, "mappingArchiveId", restorationContext.RegionVaultCache.MappingFileArchive.ArchiveId)
+}
+
+func TestDownloadMappingArchive_download_selected_mapping_archive(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	restorationContext.Options.MappingArchive = "oldMappingArchiveId"
+	awsutils.JobIdsAtStartup.MappingInventoryJobId = "inventoryMappingJobId"
+
+	mockDescribeJob(glacierMock, "inventoryMappingJobId", restorationContext.MappingVault, true)
+	mockOutputJob(glacierMock, "inventoryMappingJobId", restorationContext.MappingVault, []byte("{\"ArchiveList\":[" +
+		"{\"ArchiveId\":\"oldMappingArchiveId\",\"Size\":10,\"CreationDate\":\"2016-07-01T10:00:00Z\"}," +
+		"{\"ArchiveId\":\"mappingArchiveId\",\"Size\":42,\"CreationDate\":\"2016-08-01T10:00:00Z\"}]}"))
+	mockStartRetrieveJob(glacierMock, restorationContext.MappingVault, "oldMappingArchiveId", "0-9", "retrieveMappingJobId")
+	mockDescribeJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, true)
+	mockOutputJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, []byte("old mapping"))
+
+	// When
+	DownloadMappingArchive(restorationContext)
+
+	// Then
+	assertMappingArchive(t, "old mapping")
+	assert.Equal(t, "oldMappingArchiveId", restorationContext.RegionVaultCache.MappingFileArchive.ArchiveId)
+}
+
+func TestDownloadMappingArchive_keep_mapping_file_of_same_selection_without_inventory(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	restorationContext.Options.MappingArchive = "2016-07-15"
+	restorationContext.RegionVaultCache = RegionVaultCache{MappingFileSelection: "2016-07-15",
+		MappingFileArchive: &awsutils.Archive{ArchiveId: "oldMappingArchiveId", Size: 10, CreationDate: "2016-07-01T10:00:00Z"}}
+	ioutil.WriteFile(restorationContext.GetMappingFilePath(), []byte("old mapping"), 0600)
+
+	// When
+	DownloadMappingArchive(restorationContext)
+
+	// Then
+	assertMappingArchive(t, "old mapping")
+	glacierMock.AssertNotCalled(t, "InitiateJob", mock.Anything)
+}
+
+func TestDownloadMappingArchive_inventory_again_selection_when_mapping_file_is_refreshed(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	refresh := true
+	restorationContext.Options.RefreshMappingFile = &refresh
+	restorationContext.Options.MappingArchive = "2016-08-15"
+	restorationContext.RegionVaultCache = RegionVaultCache{MappingFileSelection: "2016-08-15",
+		MappingFileArchive: &awsutils.Archive{ArchiveId: "oldMappingArchiveId", Size: 10, CreationDate: "2016-07-01T10:00:00Z"}}
+	ioutil.WriteFile(restorationContext.GetMappingFilePath(), []byte("old mapping"), 0600)
+	awsutils.JobIdsAtStartup.MappingInventoryJobId = "inventoryMappingJobId"
+
+	mockDescribeJob(glacierMock, "inventoryMappingJobId", restorationContext.MappingVault, true)
+	mockOutputJob(glacierMock, "inventoryMappingJobId", restorationContext.MappingVault, []byte("{\"ArchiveList\":[" +
+		"{\"ArchiveId\":\"oldMappingArchiveId\",\"Size\":10,\"CreationDate\":\"2016-07-01T10:00:00Z\"}," +
+		"{\"ArchiveId\":\"mappingArchiveId\",\"Size\":42,\"CreationDate\":\"2016-08-01T10:00:00Z\"}]}"))
+	mockStartRetrieveJob(glacierMock, restorationContext.MappingVault, "mappingArchiveId", "0-41", "retrieveMappingJobId")
+	mockDescribeJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, true)
+	mockOutputJob(glacierMock, "retrieveMappingJobId", restorationContext.MappingVault, []byte("hello !"))
+
+	// When
+	DownloadMappingArchive(restorationContext)
+
+	// Then
+	assertMappingArchive(t, "hello !")
+	assert.Equal(t, "mappingArchiveId", restorationContext.RegionVaultCache.MappingFileArchive.ArchiveId)
+	assert.Equal(t, "2016-08-15", ReadCache(restorationContext.WorkingDirPath).MappingFileSelection)
+}
+
+func TestSelectMappingArchive_by_id_or_by_date(t *testing.T) {
+	// Given
+	CommonInitTest()
+	mappingArchives := []awsutils.Archive{
+		{ArchiveId: "mappingArchiveId1", CreationDate: "2016-07-01T10:00:00Z"},
+		{ArchiveId: "mappingArchiveId3", CreationDate: "2016-08-15T10:00:00Z"},
+		{ArchiveId: "mappingArchiveId2", CreationDate: "2016-08-01T10:00:00Z"},
+	}
+
+	// When
+	newest := selectMappingArchive(mappingArchives, "")
+	byId := selectMappingArchive(mappingArchives, "mappingArchiveId1")
+	byDate := selectMappingArchive(mappingArchives, "2016-08-10")
+
+	// Then
+	assert.Equal(t, "mappingArchiveId3", newest.ArchiveId)
+	assert.Equal(t, "mappingArchiveId1", byId.ArchiveId)
+	assert.Equal(t, "mappingArchiveId2", byDate.ArchiveId)
+}
+
 func assertMappingArchive(t *testing.T, expected string) {
 	data, _ := ioutil.ReadFile("../../testtmp/cache/mapping.sqllite")
 	assert.Equal(t, expected, string(data))
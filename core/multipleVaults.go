@@ -0,0 +1,111 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"rsg/inputs"
+	"rsg/options"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Restore several synology vaults in one run.
+//
+// Each vault is restored in its own subdirectory of the destination directory, with its own working
+// directory and mapping file. Vaults are restored one after the other but share a retrieval budget by
+// region (the data retrieval policy is defined by region), so a vault does not request what a previous
+// vault already consumed.
+
+// select vaults given by --all-vaults or --vault region:name, or the vault to use if only one is expected
+func SelectRegionVaults(optionsValue options.Options) []*SynologyCoupleVault {
+	if optionsValue.AllVaults {
+		synologyCoupleVaults, err := GetSynologyVaults(optionsValue.Region, "")
+		utils.ExitIfError(err)
+		if len(synologyCoupleVaults) == 0 {
+			utils.ExitIfError(errors.New("No synology backup vault found"))
+		}
+		for _, synologyCoupleVault := range synologyCoupleVaults {
+			outputs.Printfln(outputs.OptionalInfo, "Synology backup vault used: %s:%s", synologyCoupleVault.Region, synologyCoupleVault.Name)
+		}
+		return synologyCoupleVaults
+	}
+	if len(optionsValue.Vaults) <= 1 {
+		vault := ""
+		if len(optionsValue.Vaults) == 1 {
+			vault = optionsValue.Vaults[0]
+		}
+		region, vault := parseRegionVault(optionsValue.Region, vault)
+		region, vault = SelectRegionVault(region, vault)
+		if vault == "" {
+			return []*SynologyCoupleVault{}
+		}
+		return []*SynologyCoupleVault{{Region: region, Name: vault}}
+	}
+	synologyCoupleVaults := []*SynologyCoupleVault{}
+	for _, regionVault := range optionsValue.Vaults {
+		region, vault := parseRegionVault(optionsValue.Region, regionVault)
+		synologyCoupleVaultsFound, err := GetSynologyVaults(region, vault)
+		utils.ExitIfError(err)
+		var synologyCoupleVault *SynologyCoupleVault
+		for _, synologyCoupleVaultFound := range synologyCoupleVaultsFound {
+			if synologyCoupleVaultFound.Name == vault {
+				if synologyCoupleVault != nil {
+					utils.ExitIfError(errors.New(fmt.Sprintf("Synology backup vault %s exists in several regions, use region:vault", vault)))
+				}
+				synologyCoupleVault = synologyCoupleVaultFound
+			}
+		}
+		if synologyCoupleVault == nil {
+			utils.ExitIfError(errors.New(fmt.Sprintf("Synology backup vault %s not found", regionVault)))
+		}
+		outputs.Printfln(outputs.OptionalInfo, "Synology backup vault used: %s:%s", synologyCoupleVault.Region, synologyCoupleVault.Name)
+		synologyCoupleVaults = append(synologyCoupleVaults, synologyCoupleVault)
+	}
+	return synologyCoupleVaults
+}
+
+// parse "region:vault" or "vault", the default region is used when not given
+func parseRegionVault(defaultRegion, regionVault string) (string, string) {
+	if index := strings.Index(regionVault, ":"); index >= 0 {
+		return regionVault[0:index], regionVault[index + 1:]
+	}
+	return defaultRegion, regionVault
+}
+
+func CreateRestorationContexts(synologyCoupleVaults []*SynologyCoupleVault, optionsValue options.Options) []*RestorationContext {
+	return createRestorationContexts(synologyCoupleVaults, optionsValue, CreateRestorationContext)
+}
+
+// without glacier client, for commands working only on local files
+func CreateOfflineRestorationContexts(synologyCoupleVaults []*SynologyCoupleVault, optionsValue options.Options) []*RestorationContext {
+	return createRestorationContexts(synologyCoupleVaults, optionsValue, createOfflineRestorationContext)
+}
+
+func createRestorationContexts(synologyCoupleVaults []*SynologyCoupleVault, optionsValue options.Options,
+	createRestorationContext func(string, string, options.Options) *RestorationContext) []*RestorationContext {
+	restorationContexts := []*RestorationContext{}
+	if len(synologyCoupleVaults) > 1 && optionsValue.Dest == "" && optionsValue.Command == options.COMMAND_RESTORE {
+		optionsValue.Dest = inputs.QueryString("destination", "What is the destination directory path ?")
+	}
+	sharedRetrievalBudgets := make(retrievalBudgetsByRegion)
+	for _, synologyCoupleVault := range synologyCoupleVaults {
+		restorationContext := createRestorationContext(synologyCoupleVault.Region, synologyCoupleVault.Name, optionsValue)
+		if len(synologyCoupleVaults) > 1 {
+			restorationContext.DestinationDirPath = optionsValue.Dest + "/" + vaultSubdirectoryName(synologyCoupleVault, synologyCoupleVaults)
+			restorationContext.sharedRetrievalBudgets = sharedRetrievalBudgets
+		}
+		restorationContexts = append(restorationContexts, restorationContext)
+	}
+	return restorationContexts
+}
+
+// vault name, prefixed by its region if another region has a vault with the same name
+func vaultSubdirectoryName(synologyCoupleVault *SynologyCoupleVault, synologyCoupleVaults []*SynologyCoupleVault) string {
+	for _, other := range synologyCoupleVaults {
+		if other.Name == synologyCoupleVault.Name && other.Region != synologyCoupleVault.Region {
+			return synologyCoupleVault.Region + "_" + synologyCoupleVault.Name
+		}
+	}
+	return synologyCoupleVault.Name
+}
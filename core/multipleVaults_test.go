@@ -0,0 +1,53 @@
+package core
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRegionVault_with_region(t *testing.T) {
+	region, vault := parseRegionVault("defaultRegion", "region1:vault1")
+
+	assert.Equal(t, "region1", region)
+	assert.Equal(t, "vault1", vault)
+}
+
+func TestParseRegionVault_without_region(t *testing.T) {
+	region, vault := parseRegionVault("defaultRegion", "vault1")
+
+	assert.Equal(t, "defaultRegion", region)
+	assert.Equal(t, "vault1", vault)
+}
+
+func TestVaultSubdirectoryName_is_prefixed_by_region_only_when_name_is_not_unique(t *testing.T) {
+	synologyVaults := []*SynologyCoupleVault{
+		{"region1", "vault1", nil, nil},
+		{"region1", "vault2", nil, nil},
+		{"region2", "vault1", nil, nil},
+	}
+
+	assert.Equal(t, "region1_vault1", vaultSubdirectoryName(synologyVaults[0], synologyVaults))
+	assert.Equal(t, "vault2", vaultSubdirectoryName(synologyVaults[1], synologyVaults))
+	assert.Equal(t, "region2_vault1", vaultSubdirectoryName(synologyVaults[2], synologyVaults))
+}
+
+func TestLoadRetrievalBudget_is_shared_by_vaults_of_a_region(t *testing.T) {
+	// Given
+	CommonInitTest()
+	glacierMock, restorationContext1 := InitTestWithGlacier()
+	restorationContext2 := DefaultRestorationContext(glacierMock)
+	restorationContext2.Vault = "vault2"
+	sharedRetrievalBudgets := make(retrievalBudgetsByRegion)
+	restorationContext1.sharedRetrievalBudgets = sharedRetrievalBudgets
+	restorationContext2.sharedRetrievalBudgets = sharedRetrievalBudgets
+	downloadContext1 := DownloadContext{restorationContext: restorationContext1}
+	downloadContext2 := DownloadContext{restorationContext: restorationContext2}
+
+	// When
+	downloadContext1.loadRetrievalBudget()
+	downloadContext2.loadRetrievalBudget()
+
+	// Then
+	assert.True(t, downloadContext1.retrievalBudget == downloadContext2.retrievalBudget)
+	glacierMock.AssertNumberOfCalls(t, "GetDataRetrievalPolicy", 1)
+}
@@ -0,0 +1,220 @@
+package core
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"rsg/awsutils"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Queue of the archive parts whose retrieval job is started, kept in a sqlite state file next to the mapping
+// file, so a restore of millions of small files runs in bounded memory. The state of a running restore can be
+// inspected with sqlite3 (ex: SELECT state, count(*) FROM part_tb GROUP BY state).
+//
+// A part is pending while its job is in progress, then ready or failed once its job is completed, and
+// downloading when it is the part being downloaded. The next part to download is the ready part expiring
+// first whose previous parts of the same archive are downloaded.
+//
+// The queue is emptied when a restore starts: jobs of a previous run are found again with the jobs listed at
+// startup (see awsutils.JobIdsAtStartup).
+
+const stateFileName = "state.sqlite"
+
+const (
+	PART_PENDING = "pending"
+	PART_READY = "ready"
+	PART_FAILED = "failed"
+	PART_DOWNLOADING = "downloading"
+)
+
+type partQueue struct {
+	db   *sql.DB
+	size int // number of parts not being downloaded
+}
+
+const partColumns = "key, jobId, archiveId, retrievalByteIndex, retrievedSize, archiveSize, nextByteIndexToWrite, creationDate, completionDate, failedJobIds, failureMessage"
+
+func (restorationContext *RestorationContext) GetStateFilePath() string {
+	return restorationContext.WorkingDirPath + "/" + stateFileName
+}
+
+func openPartQueue(filePath string) *partQueue {
+	db := InitDb(filePath)
+	// readers from outside do not block the restore
+	_, err := db.Exec("PRAGMA journal_mode=WAL")
+	utils.ExitIfError(err)
+	for _, statement := range []string{
+		"CREATE TABLE IF NOT EXISTS part_tb (`key` INTEGER PRIMARY KEY AUTOINCREMENT, state TEXT, jobId TEXT, archiveId TEXT, " +
+			"retrievalByteIndex INTEGER, retrievedSize INTEGER, archiveSize INTEGER, nextByteIndexToWrite INTEGER, " +
+			"creationDate INTEGER, completionDate INTEGER, expiryDate INTEGER, failedJobIds TEXT, failureMessage TEXT)",
+		"CREATE INDEX IF NOT EXISTS part_state_expiry_idx ON part_tb (state, expiryDate)",
+		"CREATE INDEX IF NOT EXISTS part_archive_idx ON part_tb (archiveId, retrievalByteIndex)",
+		"CREATE INDEX IF NOT EXISTS part_job_idx ON part_tb (jobId)",
+		"DELETE FROM part_tb",
+	} {
+		_, err = db.Exec(statement)
+		utils.ExitIfError(err)
+	}
+	return &partQueue{db: db}
+}
+
+func (queue *partQueue) close() {
+	queue.db.Close()
+}
+
+func (queue *partQueue) len() int {
+	return queue.size
+}
+
+// a part whose completion date is known is ready
+func (queue *partQueue) push(part *archivePartRetrieve) {
+	state := PART_PENDING
+	if !part.completionDate.IsZero() {
+		state = PART_READY
+	}
+	result, err := queue.db.Exec("INSERT INTO part_tb (state, jobId, archiveId, retrievalByteIndex, retrievedSize, archiveSize, nextByteIndexToWrite, " +
+		"creationDate, completionDate, expiryDate, failedJobIds, failureMessage) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		state, part.jobId, part.archiveId, part.retrievalByteIndex, part.retrievedSize, part.archiveSize, part.nextByteIndexToWrite,
+		toNanos(part.creationDate), toNanos(part.completionDate), expiryNanos(part.completionDate), strings.Join(part.failedJobIds, ","), part.failureMessage)
+	utils.ExitIfError(err)
+	part.key, err = result.LastInsertId()
+	utils.ExitIfError(err)
+	queue.size++
+}
+
+// the part gets back in the queue with its new job
+func (queue *partQueue) requeue(part *archivePartRetrieve) {
+	queue.update(part, PART_PENDING)
+	queue.size++
+}
+
+func (queue *partQueue) update(part *archivePartRetrieve, state string) {
+	_, err := queue.db.Exec("UPDATE part_tb SET state = ?, jobId = ?, nextByteIndexToWrite = ?, creationDate = ?, completionDate = ?, expiryDate = ?, " +
+		"failedJobIds = ?, failureMessage = ? WHERE key = ?",
+		state, part.jobId, part.nextByteIndexToWrite, toNanos(part.creationDate), toNanos(part.completionDate), expiryNanos(part.completionDate),
+		strings.Join(part.failedJobIds, ","), part.failureMessage, part.key)
+	utils.ExitIfError(err)
+}
+
+// the part is downloaded
+func (queue *partQueue) remove(part *archivePartRetrieve) {
+	_, err := queue.db.Exec("DELETE FROM part_tb WHERE key = ?", part.key)
+	utils.ExitIfError(err)
+}
+
+// return the size retrieved by the removed parts
+func (queue *partQueue) removeArchive(archiveId string) uint64 {
+	var nbParts int
+	var retrievedSize uint64
+	err := queue.db.QueryRow("SELECT count(*), COALESCE(sum(retrievedSize), 0) FROM part_tb WHERE archiveId = ? AND state != ?", archiveId, PART_DOWNLOADING).Scan(&nbParts, &retrievedSize)
+	utils.ExitIfError(err)
+	_, err = queue.db.Exec("DELETE FROM part_tb WHERE archiveId = ? AND state != ?", archiveId, PART_DOWNLOADING)
+	utils.ExitIfError(err)
+	queue.size -= nbParts
+	return retrievedSize
+}
+
+// the ready part expiring first, whose previous parts of the same archive are downloaded; it is marked as
+// downloading. Nil if no part can be downloaded
+func (queue *partQueue) takeNextReadyPart() *archivePartRetrieve {
+	parts := queue.queryParts("SELECT " + partColumns + " FROM part_tb p WHERE state = ? " +
+		"AND NOT EXISTS (SELECT 1 FROM part_tb q WHERE q.archiveId = p.archiveId AND q.retrievalByteIndex < p.retrievalByteIndex) " +
+		"ORDER BY expiryDate IS NULL, expiryDate, key LIMIT 1", PART_READY)
+	if len(parts) == 0 {
+		return nil
+	}
+	queue.update(parts[0], PART_DOWNLOADING)
+	queue.size--
+	return parts[0]
+}
+
+func (queue *partQueue) failedParts() []*archivePartRetrieve {
+	return queue.queryParts("SELECT " + partColumns + " FROM part_tb WHERE state = ? ORDER BY key", PART_FAILED)
+}
+
+// zero if a waited job has an unknown creation date, false if no job is waited
+func (queue *partQueue) firstPendingCreationDate() (time.Time, bool) {
+	var creationDate sql.NullInt64
+	err := queue.db.QueryRow("SELECT min(creationDate) FROM part_tb WHERE state = ?", PART_PENDING).Scan(&creationDate)
+	utils.ExitIfError(err)
+	return fromNanos(creationDate.Int64), creationDate.Valid
+}
+
+// pending parts whose job is completed at the last sweep of the poller become ready or failed
+func (queue *partQueue) updateCompletedParts(jobPoller *awsutils.JobPoller) {
+	rows, err := queue.db.Query("SELECT DISTINCT jobId FROM part_tb WHERE state = ?", PART_PENDING)
+	utils.ExitIfError(err)
+	completedJobs := make(map[string]awsutils.CompletedJob)
+	for rows.Next() {
+		var jobId string
+		err = rows.Scan(&jobId)
+		utils.ExitIfError(err)
+		if completedJob, completed := jobPoller.CompletedJob(jobId); completed {
+			completedJobs[jobId] = completedJob
+		}
+	}
+	rows.Close()
+	if len(completedJobs) == 0 {
+		return
+	}
+	tx, err := queue.db.Begin()
+	utils.ExitIfError(err)
+	for jobId, completedJob := range completedJobs {
+		if completedJob.Failed {
+			_, err = tx.Exec("UPDATE part_tb SET state = ?, failureMessage = ? WHERE jobId = ? AND state = ?",
+				PART_FAILED, completedJob.StatusMessage, jobId, PART_PENDING)
+		} else {
+			_, err = tx.Exec("UPDATE part_tb SET state = ?, completionDate = ?, expiryDate = ? WHERE jobId = ? AND state = ?",
+				PART_READY, toNanos(completedJob.CompletionDate), expiryNanos(completedJob.CompletionDate), jobId, PART_PENDING)
+		}
+		utils.ExitIfError(err)
+	}
+	err = tx.Commit()
+	utils.ExitIfError(err)
+	outputs.Printfln(outputs.Verbose, "%v retrieval jobs completed", len(completedJobs))
+}
+
+func (queue *partQueue) queryParts(query string, args ...interface{}) []*archivePartRetrieve {
+	rows, err := queue.db.Query(query, args...)
+	utils.ExitIfError(err)
+	defer rows.Close()
+	parts := []*archivePartRetrieve{}
+	for rows.Next() {
+		part := &archivePartRetrieve{}
+		var creationDate, completionDate int64
+		var failedJobIds string
+		err = rows.Scan(&part.key, &part.jobId, &part.archiveId, &part.retrievalByteIndex, &part.retrievedSize, &part.archiveSize,
+			&part.nextByteIndexToWrite, &creationDate, &completionDate, &failedJobIds, &part.failureMessage)
+		utils.ExitIfError(err)
+		part.creationDate, part.completionDate = fromNanos(creationDate), fromNanos(completionDate)
+		if failedJobIds != "" {
+			part.failedJobIds = strings.Split(failedJobIds, ",")
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+func toNanos(date time.Time) int64 {
+	if date.IsZero() {
+		return 0
+	}
+	return date.UnixNano()
+}
+
+func fromNanos(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// null if the completion date is unknown, such parts are downloaded after the others
+func expiryNanos(completionDate time.Time) interface{} {
+	if completionDate.IsZero() {
+		return nil
+	}
+	return completionDate.Add(jobOutputAvailability).UnixNano()
+}
@@ -14,7 +14,7 @@ func DisplayInfoAboutCosts(options options.Options) {
 		outputs.Printfln(outputs.OptionalInfo, "The author(s) of this program cannot be held responsible for these additional costs")
 		outputs.Printfln(outputs.OptionalInfo, "More information about pricing : https://aws.amazon.com/glacier/pricing/")
 		outputs.Printfln(outputs.OptionalInfo, "####################################################################################")
-		inputs.QueryContinue()
+		inputs.QueryContinue("costs-warning")
 	}
 }
 
@@ -27,7 +27,7 @@ func DisplayWarnIfNotFreeTier(restorationContext *RestorationContext) {
 			outputs.Printfln(outputs.OptionalInfo, "Select strategy \"FreeTier\" to avoid these costs :")
 			outputs.Printfln(outputs.OptionalInfo, "http://docs.aws.amazon.com/amazonglacier/latest/dev/data-retrieval-policy.html#data-retrieval-policy-using-console")
 			outputs.Printfln(outputs.OptionalInfo, "##################################################################################################################")
-			inputs.QueryContinue()
+			inputs.QueryContinue("retrieval-strategy-warning")
 		}
 	}
 
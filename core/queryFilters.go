@@ -8,8 +8,8 @@ import (
 
 func QueryFiltersIfNecessary(restorationContext *RestorationContext) {
 	if len(restorationContext.Options.Filters) == 0 && outputs.OptionalInfoFlag == true {
-		if inputs.QueryYesOrNo("Do you want add filter(s) on files to retrieve ?", false) {
-			filtersAsString := inputs.QueryString("Write filters separated by '|'. You can use global * and ?:")
+		if inputs.QueryYesOrNo("add-filters", "Do you want add filter(s) on files to retrieve ?", false) {
+			filtersAsString := inputs.QueryString("filters", "Write filters separated by '|'. You can use global * and ?:")
 			restorationContext.Options.Filters = strings.Split(filtersAsString, "|")
 		}
 	}
@@ -5,13 +5,13 @@ import (
 	"rsg/outputs"
 	"rsg/utils"
 	"github.com/aws/aws-sdk-go/service/glacier"
-	"os/user"
 	"io/ioutil"
 	"encoding/json"
 	"os"
 	"github.com/aws/aws-sdk-go/service/glacier/glacieriface"
 	"rsg/options"
 	"rsg/awsutils"
+	"rsg/schedule"
 )
 
 type RestorationContext struct {
@@ -24,6 +24,7 @@ type RestorationContext struct {
 	DestinationDirPath   string
 	BytesBySecond        uint64
 	Options              RestorationOptions
+	sharedRetrievalBudgets retrievalBudgetsByRegion // nil when only one vault is restored
 }
 
 type RestorationOptions struct {
@@ -31,21 +32,43 @@ type RestorationOptions struct {
 	RefreshMappingFile *bool
 	KeepFiles          *bool
 	InfoMessage        bool
+	DownloadWindow     *schedule.Window
+	RetrievalWindow    *schedule.Window
+	Speed              uint64
+	SpeedTestUrl       string
+	SpeedTestMode      string
+	MappingArchive     string
+	JobRetries         int
 }
 
 type RegionVaultCache struct {
-	MappingArchive             *awsutils.Archive
+	Version                    int // 0 for caches written before versioning
+	MappingArchive             *awsutils.Archive // selected from the inventory of the mapping vault, until it is downloaded
+	MappingArchiveSelection    string // --mapping-archive selecting MappingArchive, empty for the newest
+	MappingFileArchive         *awsutils.Archive // archive of the local mapping file
+	MappingFileSelection       string // --mapping-archive selecting MappingFileArchive, empty for the newest
+	DownloadSpeed              uint64 // bytes by second measured on glacier downloads
 }
 
+const mappingFileName = "mapping.sqllite"
+const cacheFileName = "cache.json"
+
+// version of RegionVaultCache, increase it and complete migrateCache when the cache changes
+const cacheVersion = 1
+
 func CreateRestorationContext(region, vault string, optionsValue options.Options) *RestorationContext {
-	usr, err := user.Current()
-	utils.ExitIfError(err)
-	workingDirPath := usr.HomeDir + "/.rsg/" + region + "/" + vault
-	err = os.MkdirAll(workingDirPath, 0700)
+	restorationContext := createOfflineRestorationContext(region, vault, optionsValue)
+	restorationContext.GlacierClient = glacier.New(awsutils.Session, &aws.Config{Region: aws.String(region)})
+	return restorationContext
+}
+
+// without glacier client, for commands working only on local files
+func createOfflineRestorationContext(region, vault string, optionsValue options.Options) *RestorationContext {
+	workingDirPath := GetVaultWorkingDirPath(region, vault)
+	err := os.MkdirAll(workingDirPath, 0700)
 	utils.ExitIfError(err)
-	glacierClient := glacier.New(awsutils.Session, &aws.Config{Region: aws.String(region)})
 	cache := ReadCache(workingDirPath);
-	return &RestorationContext{GlacierClient: glacierClient,
+	return &RestorationContext{
 		WorkingDirPath: workingDirPath,
 		Region: region,
 		Vault: vault,
@@ -57,29 +80,55 @@ func CreateRestorationContext(region, vault string, optionsValue options.Options
 			RefreshMappingFile: optionsValue.RefreshMappingFile,
 			KeepFiles: optionsValue.KeepFiles,
 			InfoMessage: optionsValue.InfoMessage,
+			DownloadWindow: optionsValue.DownloadWindow,
+			RetrievalWindow: optionsValue.RetrievalWindow,
+			Speed: optionsValue.Speed,
+			SpeedTestUrl: optionsValue.SpeedTestUrl,
+			SpeedTestMode: optionsValue.SpeedTestMode,
+			MappingArchive: optionsValue.MappingArchive,
+			JobRetries: optionsValue.JobRetries,
 		},
 	}
 }
 
+// a corrupted cache, or a cache written by a newer version, is discarded: it only avoids aws requests
 func ReadCache(workingDirPath string) RegionVaultCache {
-	if bytes, err := ioutil.ReadFile(workingDirPath + "/cache.json"); err == nil {
-		cache := RegionVaultCache{}
-		err = json.Unmarshal(bytes, &cache)
-		utils.ExitIfError(err)
-		return cache
-	} else {
+	cacheFilePath := workingDirPath + "/" + cacheFileName
+	bytes, err := ioutil.ReadFile(cacheFilePath)
+	if err != nil {
+		return RegionVaultCache{}
+	}
+	cache := RegionVaultCache{}
+	if err = json.Unmarshal(bytes, &cache); err != nil {
+		outputs.Printfln(outputs.Warning, "Cache %s is corrupted, it is discarded: %v", cacheFilePath, err)
+		os.Remove(cacheFilePath)
+		return RegionVaultCache{}
+	}
+	if cache.Version > cacheVersion {
+		outputs.Printfln(outputs.Warning, "Cache %s has been written by a newer version (%v), it is discarded", cacheFilePath, cache.Version)
 		return RegionVaultCache{}
 	}
+	return migrateCache(cache)
+}
+
+func migrateCache(cache RegionVaultCache) RegionVaultCache {
+	if cache.Version < cacheVersion {
+		outputs.Printfln(outputs.Verbose, "Migrate cache from version %v to version %v", cache.Version, cacheVersion)
+	}
+	// version 0 to 1: only the version field is added
+	cache.Version = cacheVersion
+	return cache
 }
 
 func (restorationContext *RestorationContext) WriteCache() {
 	outputs.Println(outputs.Verbose, "Write cache")
+	restorationContext.RegionVaultCache.Version = cacheVersion
 	bytes, err := json.Marshal(restorationContext.RegionVaultCache)
 	utils.ExitIfError(err)
-	err = ioutil.WriteFile(restorationContext.WorkingDirPath + "/cache.json", bytes, 0700)
+	err = utils.WriteFileAtomically(restorationContext.WorkingDirPath + "/" + cacheFileName, bytes, 0600)
 	utils.ExitIfError(err)
 }
 
 func (restorationContext *RestorationContext) GetMappingFilePath() string {
-	return restorationContext.WorkingDirPath + "/mapping.sqllite"
+	return restorationContext.WorkingDirPath + "/" + mappingFileName
 }
\ No newline at end of file
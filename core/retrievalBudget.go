@@ -0,0 +1,143 @@
+package core
+
+import (
+	"container/list"
+	"time"
+	"rsg/awsutils"
+)
+
+// Keep retrieval requests under the data retrieval policy of the account.
+//
+// Aws considers that a retrieval job lasts 4 hours and spreads its size over these 4 hours to compute the
+// peak retrieval rate. So with the BytesPerHour strategy, the sum of sizes requested during the last
+// 4 hours cannot exceed 4 * BytesPerHour. For the other strategies, the limit is not known and only
+// PolicyEnforcedException tells us that it has been reached: the size requested during the last window is
+// then used as an estimation of the limit until the end of the window.
+//
+// When the limit is reached, the next attempt is done when enough requests went out of the window to request
+// at least the given minimal size. Without any request in the window (limit reached by others or before
+// this run), we wait with an exponential backoff.
+
+const BYTES_PER_HOUR_STRATEGY = "BytesPerHour"
+const retrievalPolicyWindow = 4 * time.Hour
+
+var RetryMinWaitTime = 5 * time.Minute
+var RetryMaxWaitTime = 1 * time.Hour
+
+type retrievalRequest struct {
+	date time.Time
+	size uint64
+}
+
+type retrievalBudget struct {
+	policy                 awsutils.DataRetrievalPolicy
+	requests               *list.List // requests of the last window, oldest at front
+	estimatedWindowMaxSize uint64     // deduced from PolicyEnforcedException when policy has no known limit
+	estimationDate         time.Time
+	nbConsecutiveRetries   uint
+}
+
+// budgets shared by the restorations of several vaults
+type retrievalBudgetsByRegion map[string]*retrievalBudget
+
+func newRetrievalBudget(policy awsutils.DataRetrievalPolicy) *retrievalBudget {
+	return &retrievalBudget{policy: policy, requests: list.New()}
+}
+
+func (budget *retrievalBudget) hasLimit() bool {
+	return budget.policy.Strategy == BYTES_PER_HOUR_STRATEGY && budget.policy.BytesPerHour > 0
+}
+
+func (budget *retrievalBudget) windowMaxSize() uint64 {
+	return budget.policy.BytesPerHour * uint64(retrievalPolicyWindow / time.Hour)
+}
+
+// known or estimated limit, 0 if there is none
+func (budget *retrievalBudget) currentWindowMaxSize(now time.Time) uint64 {
+	if budget.hasLimit() {
+		return budget.windowMaxSize()
+	}
+	if budget.estimatedWindowMaxSize > 0 && now.Sub(budget.estimationDate) < retrievalPolicyWindow {
+		return budget.estimatedWindowMaxSize
+	}
+	return 0
+}
+
+// cap the retrieval buffer to what the policy allows to request during one window
+func (budget *retrievalBudget) capRetrievalMaxSize(retrievalMaxSize uint64) uint64 {
+	if budget.hasLimit() && retrievalMaxSize > budget.windowMaxSize() {
+		return budget.windowMaxSize()
+	}
+	return retrievalMaxSize
+}
+
+// max number of bytes that can be requested at the given date without exceeding the policy
+func (budget *retrievalBudget) sizeLeft(now time.Time) uint64 {
+	windowMaxSize := budget.currentWindowMaxSize(now)
+	if windowMaxSize == 0 {
+		return ^uint64(0)
+	}
+	requestedSize := budget.requestedSize(now)
+	if requestedSize >= windowMaxSize {
+		return 0
+	}
+	return windowMaxSize - requestedSize
+}
+
+// date of the next retrieval attempt and size that could be requested at this date
+func (budget *retrievalBudget) nextAttempt(now time.Time, minSize uint64) (time.Time, uint64) {
+	windowMaxSize := budget.currentWindowMaxSize(now)
+	requestedSize := budget.requestedSize(now)
+	if windowMaxSize > 0 {
+		if requestedSize + minSize <= windowMaxSize {
+			return now, windowMaxSize - requestedSize
+		}
+		for element := budget.requests.Front(); element != nil; element = element.Next() {
+			request := element.Value.(*retrievalRequest)
+			requestedSize -= request.size
+			if requestedSize + minSize <= windowMaxSize {
+				return request.date.Add(retrievalPolicyWindow), windowMaxSize - requestedSize
+			}
+		}
+	}
+	// doubled one retry at a time, a shift by the number of retries would overflow
+	waitTime := RetryMinWaitTime
+	for i := uint(0); i < budget.nbConsecutiveRetries && waitTime < RetryMaxWaitTime; i++ {
+		waitTime *= 2
+	}
+	if waitTime > RetryMaxWaitTime {
+		waitTime = RetryMaxWaitTime
+	}
+	return now.Add(waitTime), minSize
+}
+
+// called when aws refuses a retrieval because of the policy
+func (budget *retrievalBudget) recordPolicyEnforced(now time.Time) {
+	if !budget.hasLimit() {
+		if requestedSize := budget.requestedSize(now); requestedSize > 0 {
+			budget.estimatedWindowMaxSize = requestedSize
+			budget.estimationDate = now
+		}
+	}
+	budget.nbConsecutiveRetries++
+}
+
+func (budget *retrievalBudget) requestedSize(now time.Time) uint64 {
+	budget.forgetRequestsBefore(now.Add(-retrievalPolicyWindow))
+	requestedSize := uint64(0)
+	for element := budget.requests.Front(); element != nil; element = element.Next() {
+		requestedSize += element.Value.(*retrievalRequest).size
+	}
+	return requestedSize
+}
+
+func (budget *retrievalBudget) record(now time.Time, size uint64) {
+	budget.requests.PushBack(&retrievalRequest{date: now, size: size})
+	budget.nbConsecutiveRetries = 0
+}
+
+func (budget *retrievalBudget) forgetRequestsBefore(date time.Time) {
+	for element := budget.requests.Front(); element != nil && element.Value.(*retrievalRequest).date.Before(date); element = budget.requests.Front() {
+		budget.requests.Remove(element)
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"rsg/awsutils"
+	"rsg/utils"
+)
+
+func TestRetrievalBudget_no_limit_without_bytes_per_hour_strategy(t *testing.T) {
+	// Given
+	budget := newRetrievalBudget(awsutils.DataRetrievalPolicy{Strategy: "FreeTier"})
+	budget.record(time.Now(), utils.S_1GB)
+
+	// When
+	sizeLeft := budget.sizeLeft(time.Now())
+
+	// Then
+	assert.Equal(t, ^uint64(0), sizeLeft)
+	assert.Equal(t, uint64(utils.S_1GB), budget.capRetrievalMaxSize(utils.S_1GB))
+}
+
+func TestRetrievalBudget_size_left_on_last_4_hours(t *testing.T) {
+	// Given
+	now := time.Now()
+	budget := newRetrievalBudget(awsutils.DataRetrievalPolicy{Strategy: BYTES_PER_HOUR_STRATEGY, BytesPerHour: utils.S_1MB})
+	budget.record(now.Add(-5 * time.Hour), 2 * utils.S_1MB)
+	budget.record(now.Add(-3 * time.Hour), utils.S_1MB)
+	budget.record(now.Add(-1 * time.Hour), utils.S_1MB)
+
+	// When
+	sizeLeft := budget.sizeLeft(now)
+
+	// Then
+	assert.Equal(t, uint64(2 * utils.S_1MB), sizeLeft)
+	assert.Equal(t, 2, budget.requests.Len())
+	assert.Equal(t, uint64(4 * utils.S_1MB), budget.capRetrievalMaxSize(utils.S_1GB))
+}
+
+func TestRetrievalBudget_size_left_when_limit_is_exceeded(t *testing.T) {
+	// Given
+	now := time.Now()
+	budget := newRetrievalBudget(awsutils.DataRetrievalPolicy{Strategy: BYTES_PER_HOUR_STRATEGY, BytesPerHour: utils.S_1MB})
+	budget.record(now, 5 * utils.S_1MB)
+
+	// When
+	sizeLeft := budget.sizeLeft(now)
+
+	// Then
+	assert.Equal(t, uint64(0), sizeLeft)
+}
+
+func TestRetrievalBudget_next_attempt_when_oldest_requests_leave_the_window(t *testing.T) {
+	// Given
+	now := time.Now()
+	budget := newRetrievalBudget(awsutils.DataRetrievalPolicy{Strategy: BYTES_PER_HOUR_STRATEGY, BytesPerHour: utils.S_1MB})
+	budget.record(now.Add(-3 * time.Hour), utils.S_1MB)
+	budget.record(now.Add(-2 * time.Hour), 2 * utils.S_1MB)
+	budget.record(now.Add(-1 * time.Hour), utils.S_1MB)
+
+	// When
+	nextAttemptDate, nextSize := budget.nextAttempt(now, 2 * utils.S_1MB)
+
+	// Then
+	assert.Equal(t, now.Add(2 * time.Hour), nextAttemptDate)
+	assert.Equal(t, uint64(3 * utils.S_1MB), nextSize)
+}
+
+func TestRetrievalBudget_next_attempt_with_estimated_limit(t *testing.T) {
+	// Given
+	now := time.Now()
+	budget := newRetrievalBudget(awsutils.DataRetrievalPolicy{Strategy: "FreeTier"})
+	budget.record(now.Add(-1 * time.Hour), utils.S_1MB)
+	budget.record(now.Add(-30 * time.Minute), utils.S_1MB)
+
+	// When
+	budget.recordPolicyEnforced(now)
+	nextAttemptDate, nextSize := budget.nextAttempt(now, utils.S_1MB)
+
+	// Then
+	assert.Equal(t, uint64(0), budget.sizeLeft(now))
+	assert.Equal(t, now.Add(3 * time.Hour), nextAttemptDate)
+	assert.Equal(t, uint64(utils.S_1MB), nextSize)
+}
+
+func TestRetrievalBudget_next_attempt_with_exponential_backoff(t *testing.T) {
+	// Given
+	now := time.Now()
+	RetryMinWaitTime = 5 * time.Minute
+	defer func() { RetryMinWaitTime = 1 * time.Nanosecond }()
+	budget := newRetrievalBudget(awsutils.DataRetrievalPolicy{Strategy: "None"})
+
+	// When
+	budget.recordPolicyEnforced(now)
+	budget.recordPolicyEnforced(now)
+	nextAttemptDate, _ := budget.nextAttempt(now, utils.S_1MB)
+	for i := 0; i < 10; i++ {
+		budget.recordPolicyEnforced(now)
+	}
+	lastAttemptDate, _ := budget.nextAttempt(now, utils.S_1MB)
+
+	// Then
+	assert.Equal(t, now.Add(20 * time.Minute), nextAttemptDate)
+	assert.Equal(t, now.Add(RetryMaxWaitTime), lastAttemptDate)
+}
+
+func TestRetrievalBudget_backoff_does_not_overflow_after_many_retries(t *testing.T) {
+	// Given
+	now := time.Now()
+	RetryMinWaitTime = 5 * time.Minute
+	defer func() { RetryMinWaitTime = 1 * time.Nanosecond }()
+	budget := newRetrievalBudget(awsutils.DataRetrievalPolicy{Strategy: "None"})
+	attemptDates := []time.Time{}
+
+	// When
+	for i := 0; i < 200; i++ {
+		budget.recordPolicyEnforced(now)
+		attemptDate, _ := budget.nextAttempt(now, utils.S_1MB)
+		attemptDates = append(attemptDates, attemptDate)
+	}
+
+	// Then
+	for _, attemptDate := range attemptDates[5:] {
+		assert.Equal(t, now.Add(RetryMaxWaitTime), attemptDate)
+	}
+}
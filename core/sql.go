@@ -33,6 +33,15 @@ func GetArchives(db *sql.DB, filters []string) *sql.Rows {
 	return rows
 }
 
+func GetFilesWithSize(db *sql.DB, filters []string) *sql.Rows {
+	where := buildWhereFromFilters(filters)
+	sqlQuery := "SELECT shareName || '/' || basePath, archiveId, fileSize FROM file_info_tb " + where + " ORDER BY basePath"
+	outputs.Printfln(outputs.Verbose, "Query mapping file for files: %v", sqlQuery)
+	rows, err := db.Query(sqlQuery)
+	utils.ExitIfError(err)
+	return rows
+}
+
 func GetPaths(db *sql.DB, archiveId string) *sql.Rows {
 	stmt, err := db.Prepare("SELECT DISTINCT shareName || '/' || basePath FROM file_info_tb WHERE archiveId = ?")
 	utils.ExitIfError(err)
@@ -45,7 +54,7 @@ func GetPaths(db *sql.DB, archiveId string) *sql.Rows {
 func GetTotalSize(db *sql.DB, filters []string) uint64 {
 	where := buildWhereFromFilters(filters)
 	//row := db.QueryRow("SELECT sum(fileSize) FROM file_info_tb " + where + "GROUP BY archiveId")
-	row := db.QueryRow("SELECT sum(t.fileSize) FROM (SELECT fileSize FROM file_info_tb " + where + " GROUP BY archiveId) t")
+	row := db.QueryRow("SELECT COALESCE(sum(t.fileSize), 0) FROM (SELECT fileSize FROM file_info_tb " + where + " GROUP BY archiveId) t")
 	var totalSize uint64
 	err := row.Scan(&totalSize)
 	utils.ExitIfError(err)
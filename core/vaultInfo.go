@@ -0,0 +1,155 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"rsg/awsutils"
+	"rsg/options"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Display information about synology vaults, their cache and their mapping file
+
+const dateFormat = "Mon Jan _2 15:04:05 2006"
+
+// all vaults, or vaults given by --vault
+func SelectVaultsForInfo(optionsValue options.Options) []*SynologyCoupleVault {
+	synologyCoupleVaults, err := GetSynologyVaults(optionsValue.Region, "")
+	utils.ExitIfError(err)
+	if len(optionsValue.Vaults) == 0 {
+		return synologyCoupleVaults
+	}
+	selectedSynologyCoupleVaults := []*SynologyCoupleVault{}
+	for _, synologyCoupleVault := range synologyCoupleVaults {
+		for _, regionVault := range optionsValue.Vaults {
+			region, vault := parseRegionVault(synologyCoupleVault.Region, regionVault)
+			if synologyCoupleVault.Region == region && synologyCoupleVault.Name == vault {
+				selectedSynologyCoupleVaults = append(selectedSynologyCoupleVaults, synologyCoupleVault)
+				break
+			}
+		}
+	}
+	return selectedSynologyCoupleVaults
+}
+
+func DisplayVaultsInfo(synologyCoupleVaults []*SynologyCoupleVault, optionsValue options.Options) {
+	if len(synologyCoupleVaults) == 0 {
+		outputs.Println(outputs.Error, "No synology backup vault found")
+	}
+	for _, synologyCoupleVault := range synologyCoupleVaults {
+		restorationContext := CreateRestorationContext(synologyCoupleVault.Region, synologyCoupleVault.Name, optionsValue)
+		displayVaultInfo(restorationContext, synologyCoupleVault)
+	}
+}
+
+func displayVaultInfo(restorationContext *RestorationContext, synologyCoupleVault *SynologyCoupleVault) {
+	now := time.Now()
+	outputs.Printfln(outputs.Info, "Vault %s:%s", synologyCoupleVault.Region, synologyCoupleVault.Name)
+	outputs.Printfln(outputs.Info, "  Data vault:       %s", describeVault(synologyCoupleVault.DataVault))
+	outputs.Printfln(outputs.Info, "  Mapping vault:    %s", describeVault(synologyCoupleVault.MappingVault))
+	// vault stats come from the vaults cache, they may be as old as --vaults-cache-ttl
+	if regionCache, ok := readVaultsCache().Regions[synologyCoupleVault.Region]; ok {
+		outputs.Printfln(outputs.Info, "  Vault stats:      cached %s (--refresh-vaults to scan again)", describeDuration(regionCache.Date, now))
+	}
+
+	// the archive of the mapping file, and the archive selected but not downloaded yet if there is one
+	mappingFileArchive := restorationContext.RegionVaultCache.MappingFileArchive
+	if mappingFileArchive != nil {
+		outputs.Printfln(outputs.Info, "  Mapping archive:  %s", describeArchive(mappingFileArchive, now))
+	} else {
+		outputs.Println(outputs.Info, "  Mapping archive:  not downloaded")
+	}
+	if mappingArchive := restorationContext.RegionVaultCache.MappingArchive; mappingArchive != nil &&
+		(mappingFileArchive == nil || mappingArchive.ArchiveId != mappingFileArchive.ArchiveId) {
+		outputs.Printfln(outputs.Info, "  Pending archive:  %s", describeArchive(mappingArchive, now))
+	}
+
+	mappingFileExists := false
+	if stat, err := os.Stat(restorationContext.GetMappingFilePath()); err == nil {
+		mappingFileExists = true
+		outputs.Printfln(outputs.Info, "  Mapping file:     %s (downloaded %s)", restorationContext.GetMappingFilePath(), stat.ModTime().Format(dateFormat))
+	} else {
+		outputs.Println(outputs.Info, "  Mapping file:     not downloaded")
+	}
+
+	// succeeded jobs are listed by aws until their output expires
+	dataInProgress, dataSucceeded := countJobs(restorationContext, restorationContext.Vault)
+	mappingInProgress, mappingSucceeded := countJobs(restorationContext, restorationContext.MappingVault)
+	outputs.Printfln(outputs.Info, "  Jobs in progress: %v on data vault, %v on mapping vault", dataInProgress, mappingInProgress)
+	outputs.Printfln(outputs.Info, "  Jobs succeeded:   %v on data vault, %v on mapping vault", dataSucceeded, mappingSucceeded)
+
+	if mappingFileExists {
+		db := InitDb(restorationContext.GetMappingFilePath())
+		defer db.Close()
+		mappingSize := GetTotalSize(db, []string{})
+		comparison := ""
+		if dataVaultSize := sizeInBytes(synologyCoupleVault.DataVault); dataVaultSize > 0 {
+			comparison = fmt.Sprintf(" (%v%% of data vault size)", mappingSize * 100 / dataVaultSize)
+		}
+		outputs.Printfln(outputs.Info, "  Mapping size:     %v%s", bytefmt.ByteSize(mappingSize), comparison)
+	}
+}
+
+func describeVault(vault *glacier.DescribeVaultOutput) string {
+	if vault == nil {
+		return "unknown"
+	}
+	numberOfArchives := int64(0)
+	if vault.NumberOfArchives != nil {
+		numberOfArchives = *vault.NumberOfArchives
+	}
+	lastInventoryDate := "never"
+	if vault.LastInventoryDate != nil {
+		lastInventoryDate = *vault.LastInventoryDate
+	}
+	creationDate := ""
+	if vault.CreationDate != nil {
+		creationDate = *vault.CreationDate
+	}
+	return fmt.Sprintf("%v archives, %v, created %s, last inventory %s",
+		numberOfArchives, bytefmt.ByteSize(sizeInBytes(vault)), creationDate, lastInventoryDate)
+}
+
+func sizeInBytes(vault *glacier.DescribeVaultOutput) uint64 {
+	if vault == nil || vault.SizeInBytes == nil || *vault.SizeInBytes < 0 {
+		return 0
+	}
+	return uint64(*vault.SizeInBytes)
+}
+
+func describeArchive(archive *awsutils.Archive, now time.Time) string {
+	return fmt.Sprintf("%s (%v, created %s)", archive.ArchiveId, bytefmt.ByteSize(archive.Size), describeAge(archive.CreationDate, now))
+}
+
+func describeAge(date string, now time.Time) string {
+	parsedDate, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return "at unknown date"
+	}
+	return fmt.Sprintf("%s, %v days ago", parsedDate.Format(dateFormat), int(now.Sub(parsedDate).Hours() / 24))
+}
+
+func describeDuration(date time.Time, now time.Time) string {
+	return fmt.Sprintf("%s, %v ago", date.Format(dateFormat), now.Sub(date).Round(time.Second))
+}
+
+// jobs in progress and succeeded jobs
+func countJobs(restorationContext *RestorationContext, vault string) (int, int) {
+	inProgress, succeeded := 0, 0
+	awsutils.DoOnJobPages(restorationContext.GlacierClient, vault, func(page *glacier.ListJobsOutput, lastPage bool) bool {
+		for _, desc := range page.JobList {
+			switch *desc.StatusCode {
+			case "InProgress":
+				inProgress++
+			case "Succeeded":
+				succeeded++
+			}
+		}
+		return true
+	})
+	return inProgress, succeeded
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/glacier"
+	"github.com/stretchr/testify/assert"
+	"rsg/awsutils"
+)
+
+func TestDisplayVaultInfo(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	restorationContext.RegionVaultCache.MappingFileArchive = &awsutils.Archive{ArchiveId: "mappingArchiveId", Size: 42, CreationDate: "2016-08-01T12:00:00Z"}
+	synologyCoupleVault := &SynologyCoupleVault{Region: "region", Name: "vault",
+		DataVault: &glacier.DescribeVaultOutput{NumberOfArchives: aws.Int64(3), SizeInBytes: aws.Int64(20), CreationDate: aws.String("2016-01-01T12:00:00Z"), LastInventoryDate: aws.String("2016-08-02T12:00:00Z")},
+		MappingVault: &glacier.DescribeVaultOutput{NumberOfArchives: aws.Int64(1), SizeInBytes: aws.Int64(42), CreationDate: aws.String("2016-01-01T12:00:00Z")},
+	}
+
+	db, _ := sql.Open("sqlite3", restorationContext.GetMappingFilePath())
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 10);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file2.txt', 'archiveId1', 10);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file3.txt', 'archiveId2', 5);")
+	db.Close()
+
+	mockListJobs(glacierMock, "vault",
+		&glacier.JobDescription{StatusCode: aws.String("InProgress")},
+		&glacier.JobDescription{StatusCode: aws.String("Succeeded")},
+		&glacier.JobDescription{StatusCode: aws.String("Failed")})
+	mockListJobs(glacierMock, "vault_mapping")
+
+	// When
+	displayVaultInfo(restorationContext, synologyCoupleVault)
+
+	// Then
+	output := string(buffer.Bytes())
+	assert.Contains(t, output, "Vault region:vault")
+	assert.Contains(t, output, "Data vault:       3 archives, 20B, created 2016-01-01T12:00:00Z, last inventory 2016-08-02T12:00:00Z")
+	assert.Contains(t, output, "Mapping vault:    1 archives, 42B, created 2016-01-01T12:00:00Z, last inventory never")
+	assert.Contains(t, output, "Mapping archive:  mappingArchiveId (42B, created Mon Aug  1 12:00:00 2016")
+	assert.NotContains(t, output, "Pending archive:")
+	assert.Contains(t, output, "Mapping file:     ../../testtmp/cache/mapping.sqllite (downloaded")
+	assert.Contains(t, output, "Jobs in progress: 1 on data vault, 0 on mapping vault")
+	assert.Contains(t, output, "Jobs succeeded:   1 on data vault, 0 on mapping vault")
+	assert.NotContains(t, output, "Vault stats:")
+	assert.Contains(t, output, "Mapping size:     15B (75% of data vault size)")
+}
+
+func TestDisplayVaultInfo_mapping_archive_selected_but_not_downloaded(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	restorationContext.RegionVaultCache.MappingFileArchive = &awsutils.Archive{ArchiveId: "mappingArchiveId", Size: 42, CreationDate: "2016-08-01T12:00:00Z"}
+	restorationContext.RegionVaultCache.MappingArchive = &awsutils.Archive{ArchiveId: "olderMappingArchiveId", Size: 40, CreationDate: "2016-07-01T12:00:00Z"}
+	synologyCoupleVault := &SynologyCoupleVault{Region: "region", Name: "vault"}
+	mockListJobs(glacierMock, "vault")
+	mockListJobs(glacierMock, "vault_mapping")
+
+	// When
+	displayVaultInfo(restorationContext, synologyCoupleVault)
+
+	// Then
+	output := string(buffer.Bytes())
+	assert.Contains(t, output, "Mapping archive:  mappingArchiveId (42B, created Mon Aug  1 12:00:00 2016")
+	assert.Contains(t, output, "Pending archive:  olderMappingArchiveId (40B, created Fri Jul  1 12:00:00 2016")
+}
+
+func TestDisplayVaultInfo_mapping_archive_not_downloaded(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	synologyCoupleVault := &SynologyCoupleVault{Region: "region", Name: "vault"}
+	mockListJobs(glacierMock, "vault")
+	mockListJobs(glacierMock, "vault_mapping")
+
+	// When
+	displayVaultInfo(restorationContext, synologyCoupleVault)
+
+	// Then
+	output := string(buffer.Bytes())
+	assert.Contains(t, output, "Mapping archive:  not downloaded")
+	assert.NotContains(t, output, "Pending archive:")
+}
+
+func TestDisplayVaultInfo_date_of_vaults_cache(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	glacierMock, restorationContext := InitTestWithGlacier()
+	scanDate := time.Now().Add(-3 * time.Hour).Round(time.Second)
+	synologyCoupleVault := &SynologyCoupleVault{Region: "region", Name: "vault"}
+	writeVaultsCache(&vaultsCache{AccountId: "accountId", Regions: map[string]*regionVaultsCache{
+		"region": {Date: scanDate, Vaults: []*SynologyCoupleVault{synologyCoupleVault}}}})
+	mockListJobs(glacierMock, "vault")
+	mockListJobs(glacierMock, "vault_mapping")
+
+	// When
+	displayVaultInfo(restorationContext, synologyCoupleVault)
+
+	// Then
+	assert.Contains(t, string(buffer.Bytes()), "Vault stats:      cached " + scanDate.Format(dateFormat) + ", 3h0m")
+}
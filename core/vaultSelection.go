@@ -23,11 +23,13 @@ func selectRegionVaultFromSynologyVaults(synologyCoupleVaults []*SynologyCoupleV
 			outputs.Printfln(outputs.Info, "%s:%s", synologyCoupleVault.Region, synologyCoupleVault.Name)
 		}
 		for synologyCoupleVaultToUse == nil {
-			region := inputs.QueryString("Select the region of the vault to use:")
-			vault := inputs.QueryString("Select the vault to use:")
+			region := inputs.QueryString("region", "Select the region of the vault to use:")
+			vault := inputs.QueryString("vault", "Select the vault to use:")
 			synologyCoupleVaultToUse = getVaultIfExist(region, vault, synologyCoupleVaults)
 			if synologyCoupleVaultToUse == nil {
 				outputs.Println(outputs.Info, "Vault or region doesn't exist. Try again...")
+				inputs.RejectAnswer("region")
+				inputs.RejectAnswer("vault")
 			}
 		}
 	}
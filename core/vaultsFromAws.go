@@ -1,20 +1,38 @@
 package core
 
 import (
-	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/glacier"
 	"github.com/aws/aws-sdk-go/service/glacier/glacieriface"
 	"strings"
-	"errors"
 	"rsg/outputs"
 	"rsg/utils"
 	"rsg/awsutils"
+	"rsg/options"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
 )
 
 // Get vaults from aws
+//
+// Regions are scanned concurrently, a region which cannot be scanned is reported as a warning. Results are
+// cached in the home working directory, so next runs scan only regions whose cache has expired.
 
-var Regions = []string{"us-east-1", "us-west-1", "us-west-2", "eu-west-1", "eu-central-1", "ap-northeast-1", "ap-northeast-2", "ap-southeast-2"}
+// Regions scanned when no region is given, can be replaced with --regions. Any other region can be given
+// with --region, the SDK does not know which regions glacier is available in
+var Regions = []string{"us-east-1", "us-east-2", "us-west-1", "us-west-2", "ca-central-1", "sa-east-1",
+	"eu-west-1", "eu-west-2", "eu-west-3", "eu-central-1", "eu-north-1",
+	"ap-northeast-1", "ap-northeast-2", "ap-northeast-3", "ap-southeast-1", "ap-southeast-2", "ap-south-1"}
+var VaultsCacheTtl = 24 * time.Hour
+var RefreshVaultsCache = false
+var MaxConcurrentRegionScans = 4
+
+var newGlacierClient = func(region string) glacieriface.GlacierAPI {
+	return glacier.New(awsutils.Session, &aws.Config{Region: aws.String(region)})
+}
 
 type SynologyCoupleVault struct {
 	Region       string
@@ -23,6 +41,24 @@ type SynologyCoupleVault struct {
 	MappingVault *glacier.DescribeVaultOutput
 }
 
+type vaultsCache struct {
+	AccountId string
+	Regions   map[string]*regionVaultsCache
+}
+
+type regionVaultsCache struct {
+	Date   time.Time
+	Vaults []*SynologyCoupleVault
+}
+
+func ConfigureVaultsDiscovery(optionsValue options.Options) {
+	if len(optionsValue.Regions) > 0 {
+		Regions = optionsValue.Regions
+	}
+	VaultsCacheTtl = optionsValue.VaultsCacheTtl
+	RefreshVaultsCache = optionsValue.RefreshVaults
+}
+
 func GetSynologyVaults(regionFilter, vaultFilter string) ([]*SynologyCoupleVault, error) {
 	outputs.Printfln(outputs.OptionalInfo, "Scan synology backup vaults...")
 	if regionFilter != "" {
@@ -33,24 +69,117 @@ func GetSynologyVaults(regionFilter, vaultFilter string) ([]*SynologyCoupleVault
 
 func getSynologyVaultsOnOneRegions(regionFilter, vaultFilter string) ([]*SynologyCoupleVault, error) {
 	if !utils.Contains(Regions, regionFilter) {
-		return nil, errors.New(fmt.Sprintf("Region %s is not allowed, use : %s", regionFilter, strings.Join(Regions, ", ")))
+		outputs.Printfln(outputs.Verbose, "Region %s is not in scanned regions: %s", regionFilter, strings.Join(Regions, ", "))
 	}
-	glacierClient := glacier.New(awsutils.Session, &aws.Config{Region: aws.String(regionFilter)})
-	return getSynologyVaultsForRegion(glacierClient, regionFilter, vaultFilter)
+	synologyCoupleVaultsByRegion, errorsByRegion := scanRegions([]string{regionFilter})
+	if err, ok := errorsByRegion[regionFilter]; ok {
+		return nil, err
+	}
+	return filterSynologyVaults(synologyCoupleVaultsByRegion[regionFilter], vaultFilter), nil
 }
 
 func getSynologyVaultsOnAllRegions(vaultFilter string) ([]*SynologyCoupleVault, error) {
+	synologyCoupleVaultsByRegion, errorsByRegion := scanRegions(Regions)
 	synologyCoupleVaults := []*SynologyCoupleVault{}
 	for _, region := range Regions {
+		if err, ok := errorsByRegion[region]; ok {
+			outputs.Printfln(outputs.Warning, "Cannot scan region %s: %v", region, err)
+		}
+		synologyCoupleVaults = append(synologyCoupleVaults, synologyCoupleVaultsByRegion[region]...)
+	}
+	if len(errorsByRegion) == len(Regions) {
+		return nil, errorsByRegion[Regions[0]]
+	}
+	return filterSynologyVaults(synologyCoupleVaults, vaultFilter), nil
+}
 
-		glacierClient := glacier.New(awsutils.Session, &aws.Config{Region: aws.String(region)})
-		synologyCoupleVaultsForRegion, err := getSynologyVaultsForRegion(glacierClient, region, vaultFilter)
-		if err != nil {
-			return nil, err
+// vaults with the given name if there are some, all vaults otherwise
+func filterSynologyVaults(synologyCoupleVaults []*SynologyCoupleVault, vaultFilter string) []*SynologyCoupleVault {
+	filteredSynologyCoupleVaults := []*SynologyCoupleVault{}
+	for _, synologyCoupleVault := range synologyCoupleVaults {
+		if synologyCoupleVault.Name == vaultFilter {
+			filteredSynologyCoupleVaults = append(filteredSynologyCoupleVaults, synologyCoupleVault)
+		}
+	}
+	if len(filteredSynologyCoupleVaults) > 0 {
+		return filteredSynologyCoupleVaults
+	}
+	return synologyCoupleVaults
+}
+
+// scan regions not found in cache, with at most MaxConcurrentRegionScans concurrent scans. The cache is read
+// before the scans start and updated once they are all done, scans only write their results under the mutex
+func scanRegions(regions []string) (map[string][]*SynologyCoupleVault, map[string]error) {
+	cache := readVaultsCache()
+	synologyCoupleVaultsByRegion := make(map[string][]*SynologyCoupleVault)
+	errorsByRegion := make(map[string]error)
+	now := time.Now()
+	regionsToScan := []string{}
+	for _, region := range regions {
+		if regionCache, ok := cache.Regions[region]; ok && !RefreshVaultsCache && now.Sub(regionCache.Date) < VaultsCacheTtl {
+			outputs.Printfln(outputs.Verbose, "Vaults of region %s found in cache", region)
+			synologyCoupleVaultsByRegion[region] = regionCache.Vaults
+		} else {
+			regionsToScan = append(regionsToScan, region)
+		}
+	}
+	if len(regionsToScan) == 0 {
+		return synologyCoupleVaultsByRegion, errorsByRegion
+	}
+	scannedVaultsByRegion := make(map[string][]*SynologyCoupleVault)
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	semaphore := make(chan bool, MaxConcurrentRegionScans)
+	for _, region := range regionsToScan {
+		waitGroup.Add(1)
+		go func(region string) {
+			defer waitGroup.Done()
+			semaphore <- true
+			defer func() { <-semaphore }()
+			synologyCoupleVaults, err := getSynologyVaultsForRegion(newGlacierClient(region), region, "")
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errorsByRegion[region] = err
+			} else {
+				scannedVaultsByRegion[region] = synologyCoupleVaults
+			}
+		}(region)
+	}
+	waitGroup.Wait()
+	for region, synologyCoupleVaults := range scannedVaultsByRegion {
+		synologyCoupleVaultsByRegion[region] = synologyCoupleVaults
+		cache.Regions[region] = &regionVaultsCache{Date: now, Vaults: synologyCoupleVaults}
+	}
+	writeVaultsCache(cache)
+	return synologyCoupleVaultsByRegion, errorsByRegion
+}
+
+func getVaultsCachePath() string {
+	return GetAccountWorkingDirPath() + "/vaults.json"
+}
+
+func readVaultsCache() *vaultsCache {
+	cache := &vaultsCache{}
+	if bytes, err := ioutil.ReadFile(getVaultsCachePath()); err == nil {
+		if err = json.Unmarshal(bytes, cache); err != nil {
+			outputs.Printfln(outputs.Warning, "Vaults cache is corrupted, it will be rebuilt: %v", err)
 		}
-		synologyCoupleVaults = append(synologyCoupleVaults, synologyCoupleVaultsForRegion...)
 	}
-	return synologyCoupleVaults, nil;
+	if cache.AccountId != awsutils.AccountId || cache.Regions == nil {
+		cache = &vaultsCache{AccountId: awsutils.AccountId, Regions: make(map[string]*regionVaultsCache)}
+	}
+	return cache
+}
+
+func writeVaultsCache(cache *vaultsCache) {
+	bytes, err := json.Marshal(cache)
+	utils.ExitIfError(err)
+	err = os.MkdirAll(GetAccountWorkingDirPath(), 0700)
+	utils.ExitIfError(err)
+	if err = utils.WriteFileAtomically(getVaultsCachePath(), bytes, 0600); err != nil {
+		outputs.Printfln(outputs.Warning, "Cannot write vaults cache: %v", err)
+	}
 }
 
 func getSynologyVaultsForRegion(glacierClient glacieriface.GlacierAPI, region string, vaultFilter string) ([]*SynologyCoupleVault, error) {
@@ -6,6 +6,10 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/stretchr/testify/assert"
 	"rsg/outputs"
+	"errors"
+	"time"
+	"github.com/aws/aws-sdk-go/service/glacier/glacieriface"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestGetSynologyVaults_should_return_one_vault(t *testing.T) {
@@ -97,3 +101,114 @@ func TestGetSynologyVaults_should_return_two_vault2_with_two_aws_requests(t *tes
 
 
 
+
+func mockListVaultsForRegion(glacierMock *GlacierMock, vaultNames ...string) {
+	params := &glacier.ListVaultsInput{
+		AccountId: aws.String("accountId"),
+	}
+	vaultList := []*glacier.DescribeVaultOutput{}
+	for _, vaultName := range vaultNames {
+		vaultList = append(vaultList, &glacier.DescribeVaultOutput{VaultName: aws.String(vaultName)})
+	}
+	glacierMock.On("ListVaults", params).Return(&glacier.ListVaultsOutput{VaultList: vaultList}, nil)
+}
+
+func mockGlacierClientsByRegion(glacierMocks map[string]*GlacierMock) {
+	newGlacierClient = func(region string) glacieriface.GlacierAPI {
+		return glacierMocks[region]
+	}
+}
+
+func TestGetSynologyVaults_should_warn_on_region_errors_and_return_other_regions(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	Regions = []string{"region1", "region2", "region3"}
+	RefreshVaultsCache = true
+	glacierMocks := map[string]*GlacierMock{"region1": new(GlacierMock), "region2": new(GlacierMock), "region3": new(GlacierMock)}
+	mockListVaultsForRegion(glacierMocks["region1"], "vault1", "vault1_mapping")
+	glacierMocks["region2"].On("ListVaults", mock.Anything).Return((*glacier.ListVaultsOutput)(nil), errors.New("UnrecognizedClientException"))
+	mockListVaultsForRegion(glacierMocks["region3"], "vault3", "vault3_mapping")
+	mockGlacierClientsByRegion(glacierMocks)
+
+	// When
+	synologyCoupleVaults, err := GetSynologyVaults("", "")
+
+	// Then
+	assert.Nil(t, err)
+	assert.Len(t, synologyCoupleVaults, 2)
+	assert.Equal(t, "vault1", synologyCoupleVaults[0].Name)
+	assert.Equal(t, "vault3", synologyCoupleVaults[1].Name)
+	assert.Contains(t, string(buffer.Bytes()), "WARNING: Cannot scan region region2: UnrecognizedClientException")
+}
+
+func TestGetSynologyVaults_should_use_cache_of_previous_scan(t *testing.T) {
+	// Given
+	CommonInitTest()
+	Regions = []string{"region1", "region2"}
+	RefreshVaultsCache = false
+	VaultsCacheTtl = 1 * time.Hour
+	glacierMocks := map[string]*GlacierMock{"region1": new(GlacierMock), "region2": new(GlacierMock)}
+	mockListVaultsForRegion(glacierMocks["region1"], "vault1", "vault1_mapping")
+	mockListVaultsForRegion(glacierMocks["region2"], "vault2", "vault2_mapping")
+	mockGlacierClientsByRegion(glacierMocks)
+	GetSynologyVaults("", "")
+
+	// When
+	synologyCoupleVaults, err := GetSynologyVaults("", "vault2")
+
+	// Then
+	assert.Nil(t, err)
+	assert.Len(t, synologyCoupleVaults, 1)
+	assert.Equal(t, "region2", synologyCoupleVaults[0].Region)
+	glacierMocks["region1"].AssertNumberOfCalls(t, "ListVaults", 1)
+	glacierMocks["region2"].AssertNumberOfCalls(t, "ListVaults", 1)
+}
+
+func TestGetSynologyVaults_should_scan_region_not_in_scanned_regions(t *testing.T) {
+	// Given
+	CommonInitTest()
+	Regions = []string{"region1"}
+	RefreshVaultsCache = true
+	glacierMocks := map[string]*GlacierMock{"region1": new(GlacierMock), "new-region-1": new(GlacierMock)}
+	mockListVaultsForRegion(glacierMocks["new-region-1"], "vault1", "vault1_mapping")
+	mockGlacierClientsByRegion(glacierMocks)
+
+	// When
+	synologyCoupleVaults, err := GetSynologyVaults("new-region-1", "")
+
+	// Then
+	assert.Nil(t, err)
+	assert.Len(t, synologyCoupleVaults, 1)
+	assert.Equal(t, "new-region-1", synologyCoupleVaults[0].Region)
+	glacierMocks["region1"].AssertNotCalled(t, "ListVaults", mock.Anything)
+}
+
+func TestGetSynologyVaults_should_scan_expired_regions_and_keep_cached_ones(t *testing.T) {
+	// Given
+	CommonInitTest()
+	Regions = []string{"region1", "region2", "region3", "region4"}
+	RefreshVaultsCache = false
+	VaultsCacheTtl = 1 * time.Hour
+	glacierMocks := map[string]*GlacierMock{}
+	for _, region := range Regions {
+		glacierMocks[region] = new(GlacierMock)
+		mockListVaultsForRegion(glacierMocks[region], "vault_" + region, "vault_" + region + "_mapping")
+	}
+	mockGlacierClientsByRegion(glacierMocks)
+	RefreshVaultsCache = true
+	GetSynologyVaults("region1", "")
+	GetSynologyVaults("region3", "")
+	RefreshVaultsCache = false
+
+	// When
+	synologyCoupleVaults, err := GetSynologyVaults("", "")
+
+	// Then
+	assert.Nil(t, err)
+	assert.Len(t, synologyCoupleVaults, 4)
+	for i, region := range Regions {
+		assert.Equal(t, region, synologyCoupleVaults[i].Region)
+		glacierMocks[region].AssertNumberOfCalls(t, "ListVaults", 1)
+	}
+	assert.Len(t, readVaultsCache().Regions, 4)
+}
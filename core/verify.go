@@ -0,0 +1,174 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"code.cloudfoundry.org/bytefmt"
+	"rsg/options"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Verify a restored destination directory against the mapping file, for the same filters.
+//
+// It works offline: vaults are found in the working directory from their downloaded mapping file. Files
+// of the mapping must exist with their size, an archive file named by its archive id is a download which
+// was not completed, and the other files are not expected in the destination.
+
+type VerificationReport struct {
+	NbFilesChecked int
+	MissingFiles   []string
+	SizeMismatches []string
+	PartialFiles   []string
+	ExtraFiles     []string
+}
+
+func (verificationReport *VerificationReport) HasDiscrepancies() bool {
+	return len(verificationReport.MissingFiles) > 0 || len(verificationReport.SizeMismatches) > 0 ||
+		len(verificationReport.PartialFiles) > 0 || len(verificationReport.ExtraFiles) > 0
+}
+
+// vaults with a downloaded mapping file, all of them with --all-vaults or those given by --vault
+func SelectLocalVaults(optionsValue options.Options) []*SynologyCoupleVault {
+	localVaults := findLocalVaults()
+	if len(localVaults) == 0 {
+		utils.ExitIfError(errors.New("No mapping file found, restore or list files of a vault first"))
+	}
+	if optionsValue.AllVaults {
+		return localVaults
+	}
+	if len(optionsValue.Vaults) == 0 {
+		if len(localVaults) > 1 {
+			utils.ExitIfError(errors.New("Mapping files of several vaults found, use --vault or --all-vaults"))
+		}
+		return localVaults
+	}
+	selectedVaults := []*SynologyCoupleVault{}
+	for _, regionVault := range optionsValue.Vaults {
+		region, vault := parseRegionVault(optionsValue.Region, regionVault)
+		var selectedVault *SynologyCoupleVault
+		for _, localVault := range localVaults {
+			if localVault.Name == vault && (region == "" || localVault.Region == region) {
+				if selectedVault != nil {
+					utils.ExitIfError(errors.New(fmt.Sprintf("Mapping files of vault %s found in several regions, use region:vault", vault)))
+				}
+				selectedVault = localVault
+			}
+		}
+		if selectedVault == nil {
+			utils.ExitIfError(errors.New(fmt.Sprintf("No mapping file found for vault %s", regionVault)))
+		}
+		selectedVaults = append(selectedVaults, selectedVault)
+	}
+	return selectedVaults
+}
+
+func findLocalVaults() []*SynologyCoupleVault {
+	localVaults := []*SynologyCoupleVault{}
+	regionDirs, _ := ioutil.ReadDir(GetAccountWorkingDirPath())
+	for _, regionDir := range regionDirs {
+		if !regionDir.IsDir() {
+			continue
+		}
+		vaultDirs, _ := ioutil.ReadDir(GetAccountWorkingDirPath() + "/" + regionDir.Name())
+		for _, vaultDir := range vaultDirs {
+			if vaultDir.IsDir() && utils.Exists(GetVaultWorkingDirPath(regionDir.Name(), vaultDir.Name()) + "/" + mappingFileName) {
+				localVaults = append(localVaults, &SynologyCoupleVault{Region: regionDir.Name(), Name: vaultDir.Name()})
+			}
+		}
+	}
+	return localVaults
+}
+
+// return false if destination directory differs from mapping
+func VerifyDestination(restorationContext *RestorationContext) bool {
+	verificationReport := verifyDestination(restorationContext)
+	for _, path := range verificationReport.MissingFiles {
+		outputs.Printfln(outputs.Warning, "Missing file: %s", path)
+	}
+	for _, sizeMismatch := range verificationReport.SizeMismatches {
+		outputs.Printfln(outputs.Warning, "Size mismatch: %s", sizeMismatch)
+	}
+	for _, path := range verificationReport.PartialFiles {
+		outputs.Printfln(outputs.Warning, "Partial archive file: %s", path)
+	}
+	for _, path := range verificationReport.ExtraFiles {
+		outputs.Printfln(outputs.Warning, "Unexpected file: %s", path)
+	}
+	outputs.Printfln(outputs.Info, "Verification of %s: %v files checked, %v missing, %v size mismatches, %v partial archive files, %v unexpected files",
+		restorationContext.DestinationDirPath, verificationReport.NbFilesChecked, len(verificationReport.MissingFiles), len(verificationReport.SizeMismatches),
+		len(verificationReport.PartialFiles), len(verificationReport.ExtraFiles))
+	return !verificationReport.HasDiscrepancies()
+}
+
+func verifyDestination(restorationContext *RestorationContext) *VerificationReport {
+	verificationReport := &VerificationReport{}
+	destinationDirPath := restorationContext.DestinationDirPath
+	if !utils.Exists(restorationContext.GetMappingFilePath()) {
+		utils.ExitIfError(errors.New("Mapping file not found: " + restorationContext.GetMappingFilePath()))
+	}
+	db := InitDb(restorationContext.GetMappingFilePath())
+	defer db.Close()
+
+	expectedPaths := make(map[string]bool)
+	fileRows := GetFilesWithSize(db, restorationContext.Options.Filters)
+	defer fileRows.Close()
+	for fileRows.Next() {
+		var path, archiveId string
+		var fileSize uint64
+		err := fileRows.Scan(&path, &archiveId, &fileSize)
+		utils.ExitIfError(err)
+		expectedPaths[path] = true
+		verificationReport.NbFilesChecked++
+		if stat, err := os.Stat(destinationDirPath + "/" + path); err != nil || stat.IsDir() {
+			verificationReport.MissingFiles = append(verificationReport.MissingFiles, path)
+		} else if uint64(stat.Size()) != fileSize {
+			verificationReport.SizeMismatches = append(verificationReport.SizeMismatches,
+				fmt.Sprintf("%s (%v expected, %v found)", path, bytefmt.ByteSize(fileSize), bytefmt.ByteSize(uint64(stat.Size()))))
+		}
+	}
+	utils.ExitIfError(fileRows.Err())
+
+	archiveIds := make(map[string]bool)
+	archiveRows := GetArchives(db, []string{})
+	defer archiveRows.Close()
+	for archiveRows.Next() {
+		var archiveId string
+		var fileSize uint64
+		err := archiveRows.Scan(&archiveId, &fileSize)
+		utils.ExitIfError(err)
+		archiveIds[archiveId] = true
+	}
+	utils.ExitIfError(archiveRows.Err())
+
+	err := filepath.Walk(destinationDirPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(destinationDirPath, filePath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		if expectedPaths[relativePath] {
+			return nil
+		}
+		if !strings.Contains(relativePath, "/") && archiveIds[relativePath] {
+			verificationReport.PartialFiles = append(verificationReport.PartialFiles, relativePath)
+		} else {
+			verificationReport.ExtraFiles = append(verificationReport.ExtraFiles, relativePath)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		utils.ExitIfError(err)
+	}
+	return verificationReport
+}
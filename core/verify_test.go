@@ -0,0 +1,82 @@
+package core
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"rsg/options"
+)
+
+func createVerifyMappingFile(mappingFilePath string) {
+	db, _ := sql.Open("sqlite3", mappingFilePath)
+	db.Exec("CREATE TABLE `file_info_tb` (`key` INTEGER PRIMARY KEY AUTOINCREMENT, `shareName` TEXT, `basePath` TEXT,`archiveID` TEXT, fileSize INTEGER);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file1.txt', 'archiveId1', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file2.txt', 'archiveId2', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'data/file3.txt', 'archiveId3', 5);")
+	db.Exec("INSERT INTO `file_info_tb` (shareName, basePath, archiveID, fileSize) VALUES ('share', 'other/file4.txt', 'archiveId4', 5);")
+	db.Close()
+}
+
+func TestVerifyDestination_report_discrepancies(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	createVerifyMappingFile(restorationContext.GetMappingFilePath())
+	restorationContext.Options.Filters = []string{"data/*"}
+	os.MkdirAll("../../testtmp/dest/share/data", 0700)
+	ioutil.WriteFile("../../testtmp/dest/share/data/file1.txt", []byte("hello"), 0600)
+	ioutil.WriteFile("../../testtmp/dest/share/data/file2.txt", []byte("hel"), 0600)
+	ioutil.WriteFile("../../testtmp/dest/share/data/extra.txt", []byte("extra"), 0600)
+	ioutil.WriteFile("../../testtmp/dest/archiveId3", []byte("he"), 0600)
+
+	// When
+	consistent := VerifyDestination(restorationContext)
+
+	// Then
+	assert.False(t, consistent)
+	output := string(buffer.Bytes())
+	assert.Contains(t, output, "Missing file: share/data/file3.txt")
+	assert.Contains(t, output, "Size mismatch: share/data/file2.txt (5B expected, 3B found)")
+	assert.Contains(t, output, "Partial archive file: archiveId3")
+	assert.Contains(t, output, "Unexpected file: share/data/extra.txt")
+	assert.Contains(t, output, "Verification of ../../testtmp/dest: 3 files checked, 1 missing, 1 size mismatches, 1 partial archive files, 1 unexpected files")
+	assert.NotContains(t, output, "file4.txt")
+}
+
+func TestVerifyDestination_without_discrepancy(t *testing.T) {
+	// Given
+	CommonInitTest()
+	_, restorationContext := InitTestWithGlacier()
+	createVerifyMappingFile(restorationContext.GetMappingFilePath())
+	os.MkdirAll("../../testtmp/dest/share/data", 0700)
+	os.MkdirAll("../../testtmp/dest/share/other", 0700)
+	for _, path := range []string{"share/data/file1.txt", "share/data/file2.txt", "share/data/file3.txt", "share/other/file4.txt"} {
+		ioutil.WriteFile("../../testtmp/dest/" + path, []byte("hello"), 0600)
+	}
+
+	// When
+	consistent := VerifyDestination(restorationContext)
+
+	// Then
+	assert.True(t, consistent)
+}
+
+func TestSelectLocalVaults_find_vaults_with_mapping_file(t *testing.T) {
+	// Given
+	CommonInitTest()
+	os.MkdirAll(GetVaultWorkingDirPath("region1", "vault1"), 0700)
+	os.MkdirAll(GetVaultWorkingDirPath("region2", "vault1"), 0700)
+	os.MkdirAll(GetVaultWorkingDirPath("region2", "vault2"), 0700)
+	createVerifyMappingFile(GetVaultWorkingDirPath("region1", "vault1") + "/" + mappingFileName)
+	createVerifyMappingFile(GetVaultWorkingDirPath("region2", "vault2") + "/" + mappingFileName)
+
+	// When
+	allVaults := SelectLocalVaults(options.Options{AllVaults: true})
+	selectedVaults := SelectLocalVaults(options.Options{Vaults: []string{"vault2"}})
+
+	// Then
+	assert.Equal(t, []*SynologyCoupleVault{{Region: "region1", Name: "vault1"}, {Region: "region2", Name: "vault2"}}, allVaults)
+	assert.Equal(t, []*SynologyCoupleVault{{Region: "region2", Name: "vault2"}}, selectedVaults)
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"rsg/awsutils"
+	"rsg/options"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Working directory of rsg, with the cache and the mapping file of each vault.
+//
+// It is given by --work-dir, else by the RSG_HOME environment variable, else it is $XDG_CACHE_HOME/rsg
+// (~/.cache/rsg by default). Two aws accounts can have vaults with the same name, so each account has its
+// own directory: <working dir>/<account id>/<region>/<vault>. The daemon has its own directory <working dir>/daemon,
+// which is not an account.
+//
+// Previous versions used ~/.rsg/<region>/<vault> whatever the account, nothing tells which account these directories
+// belong to. They are moved into the directory of the account given by --account-id, when this account directory does
+// not exist yet, ~/.rsg keeps only the configuration file. Without --account-id they are left in place.
+
+const workDirEnvVariable = "RSG_HOME"
+
+// given by --work-dir, default working directory if empty
+var HomeWorkingDirPath = ""
+
+// working directory of previous versions, ~/.rsg if empty
+var LegacyWorkingDirPath = ""
+
+var legacyWorkingDirChecked = false
+
+// given by --account-id, the working directory of previous versions is moved only into the directory of this account
+var legacyWorkingDirAccountId = ""
+
+func ConfigureWorkingDir(optionsValue options.Options) {
+	if optionsValue.WorkDir != "" {
+		HomeWorkingDirPath = optionsValue.WorkDir
+	}
+	legacyWorkingDirAccountId = optionsValue.AccountId
+}
+
+func getLegacyWorkingDirPath() string {
+	if LegacyWorkingDirPath != "" {
+		return LegacyWorkingDirPath
+	}
+	return getUserHomeDir() + "/.rsg"
+}
+
+// ~/.rsg may contain the configuration file, previous versions had a directory by region
+func getSubdirectories(dirPath string) []string {
+	subdirectories := []string{}
+	files, _ := ioutil.ReadDir(dirPath)
+	for _, file := range files {
+		if file.IsDir() {
+			subdirectories = append(subdirectories, file.Name())
+		}
+	}
+	return subdirectories
+}
+
+// move the region directories of previous versions into the directory of the account, if it does not exist yet and
+// if the account is explicitly given by --account-id
+func migrateLegacyWorkingDir(accountWorkingDirPath string) {
+	legacyWorkingDirPath := getLegacyWorkingDirPath()
+	if filepath.Clean(legacyWorkingDirPath) == filepath.Clean(GetHomeWorkingDirPath()) {
+		return
+	}
+	if _, err := os.Stat(accountWorkingDirPath); !os.IsNotExist(err) {
+		return
+	}
+	regions := getSubdirectories(legacyWorkingDirPath)
+	if len(regions) == 0 {
+		return
+	}
+	if legacyWorkingDirAccountId != awsutils.AccountId {
+		outputs.Printfln(outputs.Warning, "Working directory of previous versions %s is not used, its account is unknown, use --account-id with the id of its account to move it to %s",
+			legacyWorkingDirPath, GetHomeWorkingDirPath() + "/<account id>")
+		return
+	}
+	err := os.MkdirAll(accountWorkingDirPath, 0700)
+	utils.ExitIfError(err)
+	for _, region := range regions {
+		if err = os.Rename(legacyWorkingDirPath + "/" + region, accountWorkingDirPath + "/" + region); err != nil {
+			outputs.Printfln(outputs.Warning, "Cannot move %s of previous versions to %s, move it by hand: %v",
+				legacyWorkingDirPath + "/" + region, accountWorkingDirPath, err)
+		}
+	}
+	outputs.Printfln(outputs.Info, "Working directory of previous versions %s is moved to %s", legacyWorkingDirPath, accountWorkingDirPath)
+}
+
+// working directory shared by all accounts
+func GetHomeWorkingDirPath() string {
+	if HomeWorkingDirPath != "" {
+		return HomeWorkingDirPath
+	}
+	if workDir := os.Getenv(workDirEnvVariable); workDir != "" {
+		return workDir
+	}
+	// relative paths must be ignored according to xdg base directory specification
+	if xdgCacheHome := os.Getenv("XDG_CACHE_HOME"); filepath.IsAbs(xdgCacheHome) {
+		return xdgCacheHome + "/rsg"
+	}
+	return getUserHomeDir() + "/.cache/rsg"
+}
+
+func getUserHomeDir() string {
+	usr, err := user.Current()
+	utils.ExitIfError(err)
+	return usr.HomeDir
+}
+
+// working directory shared by all vaults of the account
+func GetAccountWorkingDirPath() string {
+	if awsutils.AccountId == "" {
+		utils.ExitIfError(errors.New("Aws account is unknown, the working directory cannot be found"))
+	}
+	accountWorkingDirPath := GetHomeWorkingDirPath() + "/" + awsutils.AccountId
+	if !legacyWorkingDirChecked {
+		legacyWorkingDirChecked = true
+		migrateLegacyWorkingDir(accountWorkingDirPath)
+	}
+	return accountWorkingDirPath
+}
+
+func GetVaultWorkingDirPath(region, vault string) string {
+	return GetAccountWorkingDirPath() + "/" + region + "/" + vault
+}
+
+// directories of the accounts in the working directory, without the directory of the daemon
+func getAccountIds() []string {
+	accountIds := []string{}
+	for _, accountId := range getSubdirectories(GetHomeWorkingDirPath()) {
+		if accountId != daemonDirName {
+			accountIds = append(accountIds, accountId)
+		}
+	}
+	return accountIds
+}
+
+// for commands working only on local files, the account is given by --account-id or is the only one of the
+// working directory
+func SelectLocalAccount(optionsValue options.Options) {
+	if optionsValue.AccountId != "" {
+		awsutils.AccountId = optionsValue.AccountId
+		return
+	}
+	accountIds := getAccountIds()
+	if len(accountIds) == 0 && len(getSubdirectories(getLegacyWorkingDirPath())) > 0 {
+		utils.ExitIfError(errors.New(fmt.Sprintf("No account found in working directory %s, use --account-id to move %s of previous versions into it",
+			GetHomeWorkingDirPath(), getLegacyWorkingDirPath())))
+	}
+	if len(accountIds) == 0 {
+		utils.ExitIfError(errors.New("No account found in working directory " + GetHomeWorkingDirPath()))
+	}
+	if len(accountIds) > 1 {
+		utils.ExitIfError(errors.New(fmt.Sprintf("Several accounts found in working directory (%s), use --account-id", strings.Join(accountIds, ", "))))
+	}
+	awsutils.AccountId = accountIds[0]
+}
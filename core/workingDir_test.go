@@ -0,0 +1,126 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"rsg/awsutils"
+	"rsg/options"
+)
+
+func TestGetHomeWorkingDirPath_from_option_environment_or_xdg(t *testing.T) {
+	// Given
+	CommonInitTest()
+	defer os.Setenv(workDirEnvVariable, os.Getenv(workDirEnvVariable))
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	HomeWorkingDirPath = ""
+	os.Setenv(workDirEnvVariable, "")
+	os.Setenv("XDG_CACHE_HOME", "/xdg/cache")
+
+	// When
+	fromXdg := GetHomeWorkingDirPath()
+	os.Setenv(workDirEnvVariable, "/rsg/home")
+	fromEnvironment := GetHomeWorkingDirPath()
+	ConfigureWorkingDir(options.Options{WorkDir: "/work/dir"})
+	fromOption := GetHomeWorkingDirPath()
+
+	// Then
+	assert.Equal(t, "/xdg/cache/rsg", fromXdg)
+	assert.Equal(t, "/rsg/home", fromEnvironment)
+	assert.Equal(t, "/work/dir", fromOption)
+}
+
+func TestGetVaultWorkingDirPath_by_account(t *testing.T) {
+	// Given
+	CommonInitTest()
+	awsutils.AccountId = "123456789012"
+
+	// When
+	vaultWorkingDirPath := GetVaultWorkingDirPath("region", "vault")
+
+	// Then
+	assert.Equal(t, "../../testtmp/home/123456789012/region/vault", vaultWorkingDirPath)
+}
+
+func TestSelectLocalAccount_only_account_of_working_directory(t *testing.T) {
+	// Given
+	CommonInitTest()
+	os.MkdirAll(GetVaultWorkingDirPath("region", "vault"), 0700)
+	os.MkdirAll(getDaemonDirPath() + "/logs", 0700)
+	awsutils.AccountId = ""
+
+	// When
+	SelectLocalAccount(options.Options{})
+	accountId := awsutils.AccountId
+	SelectLocalAccount(options.Options{AccountId: "otherAccountId"})
+
+	// Then
+	assert.Equal(t, "accountId", accountId)
+	assert.Equal(t, "otherAccountId", awsutils.AccountId)
+}
+
+func TestGetVaultWorkingDirPath_move_working_directory_of_previous_versions(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	os.MkdirAll(LegacyWorkingDirPath + "/region/vault", 0700)
+	ioutil.WriteFile(LegacyWorkingDirPath + "/region/vault/mapping.sqllite", []byte("mapping"), 0600)
+	ioutil.WriteFile(LegacyWorkingDirPath + "/config.yaml", []byte("region: region"), 0600)
+	ConfigureWorkingDir(options.Options{AccountId: "accountId"})
+
+	// When
+	vaultWorkingDirPath := GetVaultWorkingDirPath("region", "vault")
+
+	// Then
+	content, err := ioutil.ReadFile(vaultWorkingDirPath + "/mapping.sqllite")
+	assert.Nil(t, err)
+	assert.Equal(t, "mapping", string(content))
+	assert.Empty(t, getSubdirectories(LegacyWorkingDirPath))
+	_, err = os.Stat(LegacyWorkingDirPath + "/config.yaml")
+	assert.Nil(t, err)
+	assert.Contains(t, string(buffer.Bytes()), "Working directory of previous versions ../../testtmp/legacy is moved to ../../testtmp/home/accountId")
+}
+
+func TestGetVaultWorkingDirPath_keep_working_directory_of_previous_versions_when_account_directory_exists(t *testing.T) {
+	// Given
+	CommonInitTest()
+	os.MkdirAll(LegacyWorkingDirPath + "/region/vault", 0700)
+	os.MkdirAll(HomeWorkingDirPath + "/accountId/region/otherVault", 0700)
+	ConfigureWorkingDir(options.Options{AccountId: "accountId"})
+
+	// When
+	GetVaultWorkingDirPath("region", "vault")
+
+	// Then
+	assert.Equal(t, []string{"region"}, getSubdirectories(LegacyWorkingDirPath))
+	assert.Equal(t, []string{"otherVault"}, getSubdirectories(HomeWorkingDirPath + "/accountId/region"))
+}
+
+func TestGetVaultWorkingDirPath_keep_working_directory_of_previous_versions_without_account_id(t *testing.T) {
+	// Given
+	buffer := CommonInitTest()
+	os.MkdirAll(LegacyWorkingDirPath + "/region/vault", 0700)
+	ConfigureWorkingDir(options.Options{})
+
+	// When
+	GetVaultWorkingDirPath("region", "vault")
+
+	// Then
+	assert.Equal(t, []string{"region"}, getSubdirectories(LegacyWorkingDirPath))
+	_, err := os.Stat(HomeWorkingDirPath + "/accountId")
+	assert.True(t, os.IsNotExist(err))
+	assert.Contains(t, string(buffer.Bytes()), "Working directory of previous versions ../../testtmp/legacy is not used, its account is unknown, use --account-id")
+}
+
+func TestGetVaultWorkingDirPath_keep_working_directory_of_previous_versions_for_other_account(t *testing.T) {
+	// Given
+	CommonInitTest()
+	os.MkdirAll(LegacyWorkingDirPath + "/region/vault", 0700)
+	ConfigureWorkingDir(options.Options{AccountId: "otherAccountId"})
+
+	// When
+	GetVaultWorkingDirPath("region", "vault")
+
+	// Then
+	assert.Equal(t, []string{"region"}, getSubdirectories(LegacyWorkingDirPath))
+}
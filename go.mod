@@ -13,4 +13,5 @@ require (
 	github.com/spf13/pflag v0.0.0-20151218134703-7f60f83a2c81
 	github.com/stretchr/objx v0.0.0-20150928122152-1a9d0bb9f541
 	github.com/stretchr/testify v1.1.4-0.20160615092844-d77da356e56a
+	gopkg.in/yaml.v2 v2.4.0
 )
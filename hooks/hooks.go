@@ -0,0 +1,282 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+	"rsg/outputs"
+)
+
+// Hooks fired on the events of a restore, to be notified when a restore of several days completes or dies.
+//
+// A command hook is run by the shell with the event as json on its stdin (and its type in $RSG_EVENT), without the
+// secret options of rsg given by environment variables. A webhook receives the event as json by an http POST, retried
+// with an exponential wait if it fails. A hook failure is only displayed as a warning, it never stops the restore.
+//
+// Hooks are fired by default on the events of the life of a restore only (mapping downloaded, restore finished,
+// fatal error), --hook-event selects other events. They run one after the other in a worker, so a slow hook
+// never blocks the downloads: events are queued, and dropped with a warning when too many are pending. Wait is
+// called before exiting to deliver the pending events.
+
+const (
+	EVENT_MAPPING_DOWNLOADED = "mapping-downloaded"
+	EVENT_JOB_STARTED = "job-started"
+	EVENT_JOB_READY = "job-ready"
+	EVENT_ARCHIVE_RESTORED = "archive-restored"
+	EVENT_ARCHIVE_SKIPPED = "archive-skipped"
+	EVENT_RESTORE_FINISHED = "restore-finished"
+	EVENT_FATAL_ERROR = "fatal-error"
+)
+
+var EventNames = []string{EVENT_MAPPING_DOWNLOADED, EVENT_JOB_STARTED, EVENT_JOB_READY, EVENT_ARCHIVE_RESTORED, EVENT_ARCHIVE_SKIPPED, EVENT_RESTORE_FINISHED, EVENT_FATAL_ERROR}
+
+// events firing the hooks when none is selected
+var DefaultEventNames = []string{EVENT_MAPPING_DOWNLOADED, EVENT_RESTORE_FINISHED, EVENT_FATAL_ERROR}
+
+var WebhookRetryWaitTime = 2 * time.Second
+var webhookTimeout = 30 * time.Second
+
+// max duration of Wait, pending events are given up after it
+var MaxWaitTime = 2 * time.Minute
+var waitPollInterval = 10 * time.Millisecond
+
+const maxPendingDeliveries = 1000
+
+// environment variables of rsg not given to the command hooks, the secret options
+var HiddenEnvironmentVariables = []string{}
+
+type Event struct {
+	Event       string    `json:"event"`
+	Time        time.Time `json:"time"`
+	Host        string    `json:"host"`
+	Region      string    `json:"region,omitempty"`
+	Vault       string    `json:"vault,omitempty"`
+	JobId       string    `json:"jobId,omitempty"`
+	ArchiveId   string    `json:"archiveId,omitempty"`
+	Size        uint64    `json:"size,omitempty"`
+	Files       int       `json:"files,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type Hook interface {
+	Fire(event Event, content []byte) error
+	String() string
+}
+
+// hook also receiving every event when it is fired, whether it selects it or not, before the event is queued
+type Observer interface {
+	Observe(event Event)
+}
+
+type CommandHook struct {
+	Command string
+}
+
+type Webhook struct {
+	Url     string
+	Retries int
+}
+
+type registeredHook struct {
+	hook   Hook
+	events []string // empty means default events
+}
+
+// an event with the hooks it is fired to
+type delivery struct {
+	event   Event
+	content []byte
+	hooks   []Hook
+}
+
+var hooks = []registeredHook{}
+var deliveries = make(chan delivery, maxPendingDeliveries)
+// queued events not delivered yet, Wait polls it so no goroutine keeps waiting after Wait has given up
+var pendingDeliveries int64
+
+func init() {
+	go deliver()
+}
+
+// selectedEvents empty means default events
+func Configure(commands, webhookUrls []string, webhookRetries int, selectedEvents []string) {
+	hooks = []registeredHook{}
+	for _, command := range commands {
+		Register(&CommandHook{Command: command}, selectedEvents)
+	}
+	for _, webhookUrl := range webhookUrls {
+		Register(&Webhook{Url: webhookUrl, Retries: webhookRetries}, selectedEvents)
+	}
+}
+
+func Register(hook Hook, events []string) {
+	hooks = append(hooks, registeredHook{hook: hook, events: events})
+}
+
+func IsEventName(name string) bool {
+	for _, eventName := range EventNames {
+		if eventName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (registeredHook registeredHook) isSelected(eventName string) bool {
+	selectedEvents := registeredHook.events
+	if len(selectedEvents) == 0 {
+		selectedEvents = DefaultEventNames
+	}
+	for _, selectedEvent := range selectedEvents {
+		if selectedEvent == eventName {
+			return true
+		}
+	}
+	return false
+}
+
+// queue the event for the hooks selecting it, the restore does not wait for them, observers are called at once
+func Fire(event Event) {
+	selectedHooks := []Hook{}
+	for _, registeredHook := range hooks {
+		if registeredHook.isSelected(event.Event) {
+			selectedHooks = append(selectedHooks, registeredHook.hook)
+		}
+	}
+	observers := []Observer{}
+	for _, registeredHook := range hooks {
+		if observer, ok := registeredHook.hook.(Observer); ok {
+			observers = append(observers, observer)
+		}
+	}
+	if len(selectedHooks) == 0 && len(observers) == 0 {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Host, _ = os.Hostname()
+	for _, observer := range observers {
+		observer.Observe(event)
+	}
+	if len(selectedHooks) == 0 {
+		return
+	}
+	content, err := json.Marshal(event)
+	if err != nil {
+		outputs.Printfln(outputs.Warning, "Cannot encode event %s: %v", event.Event, err)
+		return
+	}
+	atomic.AddInt64(&pendingDeliveries, 1)
+	select {
+	case deliveries <- delivery{event: event, content: content, hooks: selectedHooks}:
+	default:
+		atomic.AddInt64(&pendingDeliveries, -1)
+		outputs.Printfln(outputs.Warning, "Event %s is dropped, %v events are waiting for the hooks", event.Event, maxPendingDeliveries)
+	}
+}
+
+// run the hooks of the queued events one after the other
+func deliver() {
+	for delivery := range deliveries {
+		for _, hook := range delivery.hooks {
+			outputs.Printfln(outputs.Verbose, "Fire event %s to %v", delivery.event.Event, hook)
+			if err := hook.Fire(delivery.event, delivery.content); err != nil {
+				outputs.Printfln(outputs.Warning, "Hook %v failed on event %s: %v", hook, delivery.event.Event, err)
+			}
+		}
+		atomic.AddInt64(&pendingDeliveries, -1)
+	}
+}
+
+// wait until the queued events are delivered, at most MaxWaitTime
+func Wait() {
+	giveUpTime := time.Now().Add(MaxWaitTime)
+	for atomic.LoadInt64(&pendingDeliveries) > 0 {
+		if time.Now().After(giveUpTime) {
+			outputs.Printfln(outputs.Warning, "Hooks are given up after %v, some events are not delivered", MaxWaitTime)
+			return
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+func (hook *CommandHook) Fire(event Event, content []byte) error {
+	command := exec.Command("sh", "-c", hook.Command)
+	command.Stdin = bytes.NewReader(content)
+	command.Env = append(getCommandEnvironment(), "RSG_EVENT=" + event.Event)
+	output, err := command.CombinedOutput()
+	if len(output) > 0 {
+		outputs.Printfln(outputs.Verbose, "Hook %v output: %s", hook, output)
+	}
+	return err
+}
+
+func getCommandEnvironment() []string {
+	environment := []string{}
+	for _, variable := range os.Environ() {
+		hidden := false
+		for _, name := range HiddenEnvironmentVariables {
+			if strings.HasPrefix(variable, name + "=") {
+				hidden = true
+			}
+		}
+		if !hidden {
+			environment = append(environment, variable)
+		}
+	}
+	return environment
+}
+
+func (hook *CommandHook) String() string {
+	return "command \"" + hook.Command + "\""
+}
+
+func (hook *Webhook) Fire(event Event, content []byte) error {
+	client := &http.Client{Timeout: webhookTimeout}
+	waitTime := WebhookRetryWaitTime
+	var err error
+	for attempt := 0; attempt <= hook.Retries; attempt++ {
+		if attempt > 0 {
+			outputs.Printfln(outputs.Verbose, "Retry %v in %v: %v", hook, waitTime, err)
+			time.Sleep(waitTime)
+			waitTime *= 2
+		}
+		var response *http.Response
+		response, err = client.Post(hook.Url, "application/json", bytes.NewReader(content))
+		if urlErr, ok := err.(*url.Error); ok {
+			// without the url, it often contains a token
+			err = urlErr.Err
+		}
+		if err != nil {
+			continue
+		}
+		response.Body.Close()
+		if response.StatusCode < 300 {
+			return nil
+		}
+		err = errors.New(fmt.Sprintf("status %s", response.Status))
+		// the request is wrong, sending it again would not help
+		if response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+	}
+	return err
+}
+
+// the path of the url often contains a token
+func (hook *Webhook) String() string {
+	if parsedUrl, err := url.Parse(hook.Url); err == nil {
+		return "webhook " + parsedUrl.Scheme + "://" + parsedUrl.Host
+	}
+	return "webhook"
+}
@@ -0,0 +1,151 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"rsg/outputs"
+)
+
+// hook recording the events it receives, after waiting for release if it is not nil
+type recordingHook struct {
+	release chan bool
+	mutex   sync.Mutex
+	events  []string
+}
+
+func (hook *recordingHook) Fire(event Event, content []byte) error {
+	if hook.release != nil {
+		<-hook.release
+	}
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	hook.events = append(hook.events, event.Event)
+	return nil
+}
+
+func (hook *recordingHook) String() string {
+	return "recording hook"
+}
+
+func (hook *recordingHook) receivedEvents() []string {
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	return append([]string{}, hook.events...)
+}
+
+func initTestHooks() {
+	outputs.InitDefaultOutputs()
+	Wait()
+	Configure([]string{}, []string{}, 0, []string{})
+}
+
+func TestFire_selected_events(t *testing.T) {
+	tests := []struct {
+		selectedEvents []string
+		receivedEvents []string
+	}{
+		{[]string{}, []string{EVENT_MAPPING_DOWNLOADED, EVENT_RESTORE_FINISHED, EVENT_FATAL_ERROR}},
+		{[]string{EVENT_JOB_STARTED, EVENT_FATAL_ERROR}, []string{EVENT_JOB_STARTED, EVENT_FATAL_ERROR}},
+		{EventNames, EventNames},
+	}
+	for _, test := range tests {
+		// Given
+		initTestHooks()
+		hook := &recordingHook{}
+		Register(hook, test.selectedEvents)
+
+		// When
+		for _, eventName := range EventNames {
+			Fire(Event{Event: eventName})
+		}
+		Wait()
+
+		// Then
+		assert.Equal(t, test.receivedEvents, hook.receivedEvents(), "%v", test.selectedEvents)
+	}
+}
+
+func TestFire_does_not_wait_for_hooks(t *testing.T) {
+	// Given
+	initTestHooks()
+	hook := &recordingHook{release: make(chan bool)}
+	Register(hook, EventNames)
+
+	// When
+	start := time.Now()
+	for _, eventName := range EventNames {
+		Fire(Event{Event: eventName})
+	}
+	fireDuration := time.Since(start)
+	close(hook.release)
+	Wait()
+
+	// Then
+	assert.True(t, fireDuration < time.Second, "events fired in %s", fireDuration)
+	assert.Equal(t, EventNames, hook.receivedEvents())
+}
+
+func TestFire_drop_events_when_too_many_are_pending(t *testing.T) {
+	// Given
+	initTestHooks()
+	hook := &recordingHook{release: make(chan bool)}
+	Register(hook, EventNames)
+
+	// When
+	for i := 0; i < maxPendingDeliveries + 10; i++ {
+		Fire(Event{Event: EVENT_JOB_STARTED})
+	}
+	close(hook.release)
+	Wait()
+
+	// Then
+	receivedEvents := len(hook.receivedEvents())
+	assert.True(t, receivedEvents >= maxPendingDeliveries && receivedEvents <= maxPendingDeliveries + 1, "%v events received", receivedEvents)
+}
+
+func TestWait_gives_up_after_max_wait_time(t *testing.T) {
+	// Given
+	initTestHooks()
+	defer func(maxWaitTime time.Duration) { MaxWaitTime = maxWaitTime }(MaxWaitTime)
+	MaxWaitTime = 10 * time.Millisecond
+	hook := &recordingHook{release: make(chan bool)}
+	Register(hook, EventNames)
+	Fire(Event{Event: EVENT_RESTORE_FINISHED})
+
+	// When
+	Wait()
+
+	// Then
+	assert.Empty(t, hook.receivedEvents())
+	close(hook.release)
+	MaxWaitTime = time.Minute
+	Wait()
+	assert.Equal(t, []string{EVENT_RESTORE_FINISHED}, hook.receivedEvents())
+}
+
+func TestCommandHook_without_hidden_environment_variables(t *testing.T) {
+	// Given
+	initTestHooks()
+	os.Setenv("RSG_TEST_SECRET", "secret")
+	os.Setenv("RSG_TEST_OTHER", "other")
+	defer os.Unsetenv("RSG_TEST_SECRET")
+	defer os.Unsetenv("RSG_TEST_OTHER")
+	HiddenEnvironmentVariables = []string{"RSG_TEST_SECRET"}
+	defer func() { HiddenEnvironmentVariables = []string{} }()
+	outputFile, _ := ioutil.TempFile("", "rsg-hook")
+	outputFile.Close()
+	defer os.Remove(outputFile.Name())
+	hook := &CommandHook{Command: "echo \"$RSG_EVENT:$RSG_TEST_SECRET:$RSG_TEST_OTHER\" > " + outputFile.Name()}
+
+	// When
+	err := hook.Fire(Event{Event: EVENT_RESTORE_FINISHED}, []byte("{}"))
+
+	// Then
+	assert.Nil(t, err)
+	output, _ := ioutil.ReadFile(outputFile.Name())
+	assert.Equal(t, EVENT_RESTORE_FINISHED + "::other\n", string(output))
+}
@@ -0,0 +1,209 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"code.cloudfoundry.org/bytefmt"
+)
+
+// Mail sent by SMTP when the mapping file is ready, when a restore is finished and when it fails, with a
+// summary of the restore built from the events received since the previous restore. A restore finished with
+// archives which cannot be restored sends a "finished with errors" mail listing the skipped archives.
+//
+// The summary is built as the events are fired, only the mails are queued: events of restored archives are never
+// dropped from the summary when the delivery of the events waits for the SMTP server.
+
+const (
+	SMTP_STARTTLS = "starttls"
+	SMTP_TLS = "tls"
+	SMTP_NONE = "none"
+)
+
+var SmtpSecurities = []string{SMTP_STARTTLS, SMTP_TLS, SMTP_NONE}
+
+// skipped archives listed in a mail, the others are only counted
+const maxListedSkippedArchives = 50
+
+type MailConfig struct {
+	Server   string // host:port
+	Security string
+	User     string
+	Password string
+	From     string
+	To       []string
+}
+
+type restoreSummary struct {
+	start           time.Time
+	bytesRestored   uint64
+	files           int
+	skippedArchives []string // "<archive id> (<size>): <error>"
+	lastError       string
+}
+
+// events sending a mail
+var mailEventNames = []string{EVENT_MAPPING_DOWNLOADED, EVENT_RESTORE_FINISHED, EVENT_FATAL_ERROR}
+
+type MailHook struct {
+	config  MailConfig
+	mutex   sync.Mutex
+	summary restoreSummary
+	outbox  [][]byte // mails written when their event was observed, waiting to be sent
+}
+
+func ConfigureMail(config MailConfig) {
+	if config.From == "" {
+		hostname, _ := os.Hostname()
+		config.From = "rsg@" + hostname
+	}
+	Register(&MailHook{config: config, summary: restoreSummary{start: time.Now()}}, mailEventNames)
+}
+
+// update the summary with the event, and write the mail of the event with the summary at this time
+func (hook *MailHook) Observe(event Event) {
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	switch event.Event {
+	case EVENT_ARCHIVE_RESTORED:
+		hook.summary.bytesRestored += event.Size
+		hook.summary.files += event.Files
+	case EVENT_ARCHIVE_SKIPPED:
+		hook.summary.skippedArchives = append(hook.summary.skippedArchives,
+			fmt.Sprintf("%s (%s): %s", event.ArchiveId, bytefmt.ByteSize(event.Size), event.Error))
+		hook.summary.lastError = fmt.Sprintf("archive %s skipped: %s", event.ArchiveId, event.Error)
+	case EVENT_MAPPING_DOWNLOADED:
+		hook.write(fmt.Sprintf("Mapping file of vault %s is ready", vaultName(event)),
+			fmt.Sprintf("The mapping file of vault %s has been downloaded on %s.", vaultName(event), event.Host), event)
+	case EVENT_RESTORE_FINISHED:
+		if event.Error != "" {
+			hook.write(fmt.Sprintf("Restore of vault %s is finished with errors", vaultName(event)),
+				fmt.Sprintf("The restore of vault %s to %s is finished on %s, but %s.", vaultName(event), event.Destination, event.Host, event.Error), event)
+		} else {
+			hook.write(fmt.Sprintf("Restore of vault %s is finished", vaultName(event)),
+				fmt.Sprintf("The restore of vault %s to %s is finished on %s.", vaultName(event), event.Destination, event.Host), event)
+		}
+		hook.summary = restoreSummary{start: time.Now()}
+	case EVENT_FATAL_ERROR:
+		hook.summary.lastError = event.Error
+		hook.write(fmt.Sprintf("Restore of vault %s has failed", vaultName(event)),
+			fmt.Sprintf("The restore of vault %s has failed on %s: %s", vaultName(event), event.Host, event.Error), event)
+	}
+}
+
+// send the mails written so far, also those of events dropped before their delivery
+func (hook *MailHook) Fire(event Event, content []byte) error {
+	hook.mutex.Lock()
+	outbox := hook.outbox
+	hook.outbox = nil
+	hook.mutex.Unlock()
+	var err error
+	for _, message := range outbox {
+		if sendErr := sendMail(hook.config, message); sendErr != nil {
+			err = sendErr
+		}
+	}
+	return err
+}
+
+func (hook *MailHook) String() string {
+	return "mail to " + strings.Join(hook.config.To, ", ")
+}
+
+func vaultName(event Event) string {
+	if event.Vault == "" {
+		return "(none)"
+	}
+	return event.Region + ":" + event.Vault
+}
+
+func (hook *MailHook) write(subject, text string, event Event) {
+	body := new(bytes.Buffer)
+	fmt.Fprintf(body, "From: %s\r\n", hook.config.From)
+	fmt.Fprintf(body, "To: %s\r\n", strings.Join(hook.config.To, ", "))
+	fmt.Fprintf(body, "Subject: [rsg] %s\r\n", subject)
+	fmt.Fprintf(body, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(body, "%s\r\n\r\n", text)
+	fmt.Fprintf(body, "Restored: %s\r\n", bytefmt.ByteSize(hook.summary.bytesRestored))
+	fmt.Fprintf(body, "Files: %d\r\n", hook.summary.files)
+	fmt.Fprintf(body, "Skipped archives: %d\r\n", len(hook.summary.skippedArchives))
+	fmt.Fprintf(body, "Duration: %v\r\n", event.Time.Sub(hook.summary.start).Round(time.Second))
+	if hook.summary.lastError != "" {
+		fmt.Fprintf(body, "Last error: %s\r\n", hook.summary.lastError)
+	}
+	if event.Event == EVENT_RESTORE_FINISHED && event.Error != "" {
+		fmt.Fprintf(body, "\r\nSkipped archives:\r\n")
+		for i, skippedArchive := range hook.summary.skippedArchives {
+			if i == maxListedSkippedArchives {
+				fmt.Fprintf(body, "  ... and %d more\r\n", len(hook.summary.skippedArchives) - maxListedSkippedArchives)
+				break
+			}
+			fmt.Fprintf(body, "  %s\r\n", skippedArchive)
+		}
+	}
+	hook.outbox = append(hook.outbox, body.Bytes())
+}
+
+func sendMail(config MailConfig, message []byte) error {
+	host, _, err := net.SplitHostPort(config.Server)
+	if err != nil {
+		return err
+	}
+	var client *smtp.Client
+	if config.Security == SMTP_TLS {
+		connection, err := tls.Dial("tcp", config.Server, &tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+		client, err = smtp.NewClient(connection, host)
+		if err != nil {
+			return err
+		}
+	} else {
+		client, err = smtp.Dial(config.Server)
+		if err != nil {
+			return err
+		}
+	}
+	defer client.Close()
+	if config.Security == SMTP_STARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server " + config.Server + " does not support STARTTLS")
+		}
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if config.User != "" {
+		if err = client.Auth(smtp.PlainAuth("", config.User, config.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(config.From); err != nil {
+		return err
+	}
+	for _, to := range config.To {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(message); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,74 @@
+package hooks
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMailHook() *MailHook {
+	return &MailHook{config: MailConfig{From: "rsg@localhost", To: []string{"user@localhost"}}, summary: restoreSummary{start: time.Now()}}
+}
+
+func TestMailHook_summary_counts_events_dropped_by_the_hooks(t *testing.T) {
+	// Given
+	initTestHooks()
+	hook := &recordingHook{release: make(chan bool)}
+	Register(hook, EventNames)
+	mailHook := newTestMailHook()
+	Register(mailHook, mailEventNames)
+
+	// When
+	for i := 0; i < maxPendingDeliveries + 10; i++ {
+		Fire(Event{Event: EVENT_ARCHIVE_RESTORED, Size: 1, Files: 2})
+	}
+	Fire(Event{Event: EVENT_RESTORE_FINISHED, Region: "region", Vault: "vault"})
+	mailHook.mutex.Lock()
+	outbox := mailHook.outbox
+	mailHook.outbox = nil
+	mailHook.mutex.Unlock()
+	close(hook.release)
+	Wait()
+
+	// Then
+	assert.Equal(t, 1, len(outbox))
+	mail := string(outbox[0])
+	assert.Contains(t, mail, "Subject: [rsg] Restore of vault region:vault is finished\r\n")
+	assert.Contains(t, mail, "Files: 2020\r\n")
+}
+
+func TestMailHook_queues_only_mail_events(t *testing.T) {
+	// Given
+	initTestHooks()
+	mailHook := newTestMailHook()
+	Register(mailHook, mailEventNames)
+
+	// When
+	selectedEvents := []string{}
+	for _, eventName := range EventNames {
+		if hooks[0].isSelected(eventName) {
+			selectedEvents = append(selectedEvents, eventName)
+		}
+	}
+
+	// Then
+	assert.Equal(t, []string{EVENT_MAPPING_DOWNLOADED, EVENT_RESTORE_FINISHED, EVENT_FATAL_ERROR}, selectedEvents)
+}
+
+func TestMailHook_summary_starts_again_after_restore_finished(t *testing.T) {
+	// Given
+	mailHook := newTestMailHook()
+
+	// When
+	mailHook.Observe(Event{Event: EVENT_ARCHIVE_RESTORED, Size: 1, Files: 3})
+	mailHook.Observe(Event{Event: EVENT_RESTORE_FINISHED})
+	mailHook.Observe(Event{Event: EVENT_ARCHIVE_RESTORED, Size: 1, Files: 1})
+	mailHook.Observe(Event{Event: EVENT_FATAL_ERROR, Error: "failure"})
+
+	// Then
+	assert.Equal(t, 2, len(mailHook.outbox))
+	assert.True(t, strings.Contains(string(mailHook.outbox[0]), "Files: 3\r\n"))
+	assert.True(t, strings.Contains(string(mailHook.outbox[1]), "Files: 1\r\n"))
+	assert.True(t, strings.Contains(string(mailHook.outbox[1]), "Last error: failure\r\n"))
+}
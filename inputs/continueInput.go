@@ -6,7 +6,7 @@ import (
 	"rsg/consts"
 )
 
-func QueryContinue() {
+func (prompter TerminalPrompter) QueryContinue(id string) {
 	outputs.Print(outputs.Info, "Press to continue...")
 	for range consts.LINE_BREAK {
 		_, err := StdinReader.ReadByte()
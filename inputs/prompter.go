@@ -0,0 +1,156 @@
+package inputs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"gopkg.in/yaml.v2"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Questions asked to the user go through a Prompter, each prompt has a stable id.
+//
+// The terminal prompter reads answers on stdin. The answers prompter takes them from a yaml file keyed by
+// prompt id, so a restore can be replayed exactly: a list gives the answers of successive prompts with the
+// same id, a single value answers all of them. The fail prompter stops the run instead of waiting for an
+// answer, for unattended runs.
+
+type Prompter interface {
+	QueryString(id, query string) string
+	QueryYesOrNo(id, query string, defaultAnswer bool) bool
+	QueryContinue(id string)
+	// the last answer of the prompt is not valid and the prompt will be asked again
+	RejectAnswer(id string)
+}
+
+var CurrentPrompter Prompter = TerminalPrompter{}
+
+func QueryString(id, query string) string {
+	return CurrentPrompter.QueryString(id, query)
+}
+
+func QueryYesOrNo(id, query string, defaultAnswer bool) bool {
+	return CurrentPrompter.QueryYesOrNo(id, query, defaultAnswer)
+}
+
+func QueryContinue(id string) {
+	CurrentPrompter.QueryContinue(id)
+}
+
+func RejectAnswer(id string) {
+	CurrentPrompter.RejectAnswer(id)
+}
+
+// answers file given by --answers, and --no-prompt to fail on prompts without answer
+func ConfigurePrompter(answersFilePath string, failOnPrompt bool) {
+	var prompter Prompter = TerminalPrompter{}
+	if failOnPrompt {
+		prompter = FailPrompter{}
+	}
+	if answersFilePath != "" {
+		content, err := ioutil.ReadFile(answersFilePath)
+		utils.ExitIfError(err)
+		answers := make(map[string]interface{})
+		if err = yaml.Unmarshal(content, &answers); err != nil {
+			utils.ExitIfError(errors.New(fmt.Sprintf("Cannot read answers file %s: %v", answersFilePath, err)))
+		}
+		prompter = NewAnswersPrompter(answers, prompter)
+	}
+	CurrentPrompter = prompter
+}
+
+type AnswersPrompter struct {
+	answers          map[string]interface{}
+	nbAnswersUsed    map[string]int
+	lastAnswerIsFile map[string]bool
+	fallback         Prompter // for prompts without answer
+}
+
+func NewAnswersPrompter(answers map[string]interface{}, fallback Prompter) *AnswersPrompter {
+	return &AnswersPrompter{answers: answers, nbAnswersUsed: make(map[string]int), lastAnswerIsFile: make(map[string]bool), fallback: fallback}
+}
+
+func (prompter *AnswersPrompter) nextAnswer(id string) (string, bool) {
+	prompter.lastAnswerIsFile[id] = false
+	value, ok := prompter.answers[id]
+	if !ok {
+		return "", false
+	}
+	if list, isList := value.([]interface{}); isList {
+		if prompter.nbAnswersUsed[id] >= len(list) {
+			return "", false
+		}
+		value = list[prompter.nbAnswersUsed[id]]
+	}
+	prompter.nbAnswersUsed[id]++
+	prompter.lastAnswerIsFile[id] = true
+	return fmt.Sprint(value), true
+}
+
+func (prompter *AnswersPrompter) QueryString(id, query string) string {
+	if answer, ok := prompter.nextAnswer(id); ok {
+		outputs.Printfln(outputs.Info, "%v %v", query, answer)
+		return answer
+	}
+	return prompter.fallback.QueryString(id, query)
+}
+
+func (prompter *AnswersPrompter) QueryYesOrNo(id, query string, defaultAnswer bool) bool {
+	answer, ok := prompter.nextAnswer(id)
+	if !ok {
+		return prompter.fallback.QueryYesOrNo(id, query, defaultAnswer)
+	}
+	outputs.Printfln(outputs.Info, "%s %v", query, answer)
+	switch strings.ToLower(answer) {
+	case "y", "yes", "true":
+		return true
+	case "n", "no", "false":
+		return false
+	case "":
+		return defaultAnswer
+	}
+	utils.ExitIfError(errors.New(fmt.Sprintf("Answer of prompt %s must be y or n: %s", id, answer)))
+	return false
+}
+
+func (prompter *AnswersPrompter) QueryContinue(id string) {
+	if _, ok := prompter.nextAnswer(id); !ok {
+		prompter.fallback.QueryContinue(id)
+	}
+}
+
+// a single answer would be given again, and rejected again
+func (prompter *AnswersPrompter) RejectAnswer(id string) {
+	if !prompter.lastAnswerIsFile[id] {
+		prompter.fallback.RejectAnswer(id)
+		return
+	}
+	if _, isList := prompter.answers[id].([]interface{}); !isList {
+		utils.ExitIfError(errors.New(fmt.Sprintf("Answer of prompt %s is rejected: %v", id, prompter.answers[id])))
+	}
+}
+
+type FailPrompter struct{}
+
+func (prompter FailPrompter) QueryString(id, query string) string {
+	failOnPrompt(id, query)
+	return ""
+}
+
+func (prompter FailPrompter) QueryYesOrNo(id, query string, defaultAnswer bool) bool {
+	failOnPrompt(id, query)
+	return defaultAnswer
+}
+
+func (prompter FailPrompter) QueryContinue(id string) {
+	failOnPrompt(id, "Press to continue...")
+}
+
+func (prompter FailPrompter) RejectAnswer(id string) {
+}
+
+func failOnPrompt(id, query string) {
+	utils.ExitIfError(errors.New(fmt.Sprintf("Prompt %s needs an answer (%s), give it with an option or in the answers file", id, strings.TrimSpace(query))))
+}
@@ -0,0 +1,192 @@
+package inputs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// prompter recording the prompts it receives, with the same answer to all of them
+type recordingPrompter struct {
+	answer   string
+	prompts  []string
+	rejected []string
+}
+
+func (prompter *recordingPrompter) QueryString(id, query string) string {
+	prompter.prompts = append(prompter.prompts, id)
+	return prompter.answer
+}
+
+func (prompter *recordingPrompter) QueryYesOrNo(id, query string, defaultAnswer bool) bool {
+	prompter.prompts = append(prompter.prompts, id)
+	return defaultAnswer
+}
+
+func (prompter *recordingPrompter) QueryContinue(id string) {
+	prompter.prompts = append(prompter.prompts, id)
+}
+
+func (prompter *recordingPrompter) RejectAnswer(id string) {
+	prompter.rejected = append(prompter.rejected, id)
+}
+
+func initTestPrompter() {
+	outputs.InitOutputs(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+	utils.OnFatalError = func(err error) {
+		panic(err)
+	}
+}
+
+// error of the action stopping the run, nil if it does not stop it
+func fatalError(action func()) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.New(fmt.Sprint(recovered))
+		}
+	}()
+	action()
+	return nil
+}
+
+func TestAnswersPrompter_list_answers_successive_prompts_then_fallback(t *testing.T) {
+	// Given
+	initTestPrompter()
+	fallback := &recordingPrompter{answer: "fallback"}
+	prompter := NewAnswersPrompter(map[string]interface{}{"destination": []interface{}{"/first", "/second"}}, fallback)
+
+	// When
+	answers := []string{}
+	for i := 0; i < 3; i++ {
+		answers = append(answers, prompter.QueryString("destination", "Destination ?"))
+	}
+
+	// Then
+	assert.Equal(t, []string{"/first", "/second", "fallback"}, answers)
+	assert.Equal(t, []string{"destination"}, fallback.prompts)
+}
+
+func TestAnswersPrompter_single_answer_answers_all_prompts(t *testing.T) {
+	// Given
+	initTestPrompter()
+	fallback := &recordingPrompter{answer: "fallback"}
+	prompter := NewAnswersPrompter(map[string]interface{}{"destination": "/restore"}, fallback)
+
+	// When
+	answers := []string{}
+	for i := 0; i < 3; i++ {
+		answers = append(answers, prompter.QueryString("destination", "Destination ?"))
+	}
+
+	// Then
+	assert.Equal(t, []string{"/restore", "/restore", "/restore"}, answers)
+	assert.Empty(t, fallback.prompts)
+}
+
+func TestAnswersPrompter_yes_or_no_answers(t *testing.T) {
+	tests := []struct {
+		answer   interface{}
+		expected bool
+		err      string
+	}{
+		{"y", true, ""},
+		{"No", false, ""},
+		{true, true, ""},
+		{false, false, ""},
+		{"", true, ""},
+		{"maybe", false, "Answer of prompt refresh-mapping-file must be y or n: maybe"},
+	}
+	for _, test := range tests {
+		// Given
+		initTestPrompter()
+		prompter := NewAnswersPrompter(map[string]interface{}{"refresh-mapping-file": test.answer}, &recordingPrompter{})
+
+		// When
+		var answer bool
+		err := fatalError(func() {
+			answer = prompter.QueryYesOrNo("refresh-mapping-file", "Refresh ?", true)
+		})
+
+		// Then
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, "%v", test.answer)
+		} else {
+			assert.NoError(t, err, "%v", test.answer)
+			assert.Equal(t, test.expected, answer, "%v", test.answer)
+		}
+	}
+}
+
+func TestAnswersPrompter_rejected_answer_of_list_is_replaced_by_next_answer(t *testing.T) {
+	// Given
+	initTestPrompter()
+	fallback := &recordingPrompter{}
+	prompter := NewAnswersPrompter(map[string]interface{}{"destination": []interface{}{"/invalid", "/restore"}}, fallback)
+
+	// When
+	first := prompter.QueryString("destination", "Destination ?")
+	err := fatalError(func() {
+		prompter.RejectAnswer("destination")
+	})
+	second := prompter.QueryString("destination", "Destination ?")
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, "/invalid", first)
+	assert.Equal(t, "/restore", second)
+	assert.Empty(t, fallback.rejected)
+}
+
+func TestAnswersPrompter_rejected_single_answer_stops_the_run(t *testing.T) {
+	// Given
+	initTestPrompter()
+	prompter := NewAnswersPrompter(map[string]interface{}{"destination": "/invalid"}, &recordingPrompter{})
+	prompter.QueryString("destination", "Destination ?")
+
+	// When
+	err := fatalError(func() {
+		prompter.RejectAnswer("destination")
+	})
+
+	// Then
+	assert.EqualError(t, err, "Answer of prompt destination is rejected: /invalid")
+}
+
+func TestAnswersPrompter_rejected_answer_of_fallback_is_rejected_by_fallback(t *testing.T) {
+	// Given
+	initTestPrompter()
+	fallback := &recordingPrompter{answer: "/typed"}
+	prompter := NewAnswersPrompter(map[string]interface{}{"other": "answer"}, fallback)
+	prompter.QueryString("destination", "Destination ?")
+
+	// When
+	err := fatalError(func() {
+		prompter.RejectAnswer("destination")
+	})
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"destination"}, fallback.rejected)
+}
+
+func TestAnswersPrompter_prompt_without_answer_fails_with_fail_prompter(t *testing.T) {
+	// Given
+	initTestPrompter()
+	prompter := NewAnswersPrompter(map[string]interface{}{"destination": "/restore"}, FailPrompter{})
+
+	// When
+	answered := fatalError(func() {
+		prompter.QueryString("destination", "Destination ?")
+	})
+	notAnswered := fatalError(func() {
+		prompter.QueryContinue("continue-download")
+	})
+
+	// Then
+	assert.NoError(t, answered)
+	assert.EqualError(t, notAnswered, "Prompt continue-download needs an answer (Press to continue...), give it with an option or in the answers file")
+}
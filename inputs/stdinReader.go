@@ -7,3 +7,10 @@ import (
 
 var StdinReader = bufio.NewReader(os.Stdin)
 
+// reads answers on stdin
+type TerminalPrompter struct{}
+
+// the prompt is asked again
+func (prompter TerminalPrompter) RejectAnswer(id string) {
+}
+
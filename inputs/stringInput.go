@@ -7,7 +7,7 @@ import (
 	"rsg/consts"
 )
 
-func QueryString(query string) string {
+func (prompter TerminalPrompter) QueryString(id, query string) string {
 	for {
 		outputs.Printf(outputs.Info, "%v ", query)
 		answer, err := StdinReader.ReadString(consts.LINE_BREAK_LAST_CHAR)
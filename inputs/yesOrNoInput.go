@@ -7,7 +7,7 @@ import (
 	"rsg/consts"
 )
 
-func QueryYesOrNo(query string, defaultAnswer bool) bool {
+func (prompter TerminalPrompter) QueryYesOrNo(id, query string, defaultAnswer bool) bool {
 	for {
 		yes := "y"
 		no := "n"
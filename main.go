@@ -6,6 +6,13 @@ import (
 	"rsg/awsutils"
 	"rsg/utils"
 	"rsg/options"
+	"rsg/inputs"
+	"rsg/bandwidth"
+	"rsg/hooks"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
 )
 
 const version = "0.0.1-SNAPSHOT"
@@ -13,32 +20,156 @@ var date string
 
 func main() {
 	outputs.InitDefaultOutputs()
-	options := options.ParseOptions()
-	if options.Version {
+	optionsValue := options.ParseOptions()
+	if optionsValue.Command == options.COMMAND_COMPLETE {
+		// only completions on the output
+		outputs.InitOutputs(ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard, ioutil.Discard)
+		for _, completion := range core.Complete(optionsValue.CommandArgs) {
+			fmt.Println(completion)
+		}
+		return
+	}
+	if optionsValue.Version {
 		outputs.Printfln(outputs.Info, "Version %v (%v)", version, date)
 		return
 	}
-	core.DisplayInfoAboutCosts(options)
-	awsutils.LoadAccountSession(options.AwsId, options.AwsSecret)
-	region, vaultName := core.SelectRegionVault(options.Region, options.Vault)
-	restorationContext := core.CreateRestorationContext(region, vaultName, options)
+	core.ConfigureWorkingDir(optionsValue)
+	inputs.ConfigurePrompter(optionsValue.AnswersPath, optionsValue.NoPrompt)
+	configureHooks(optionsValue)
+	runCommand(optionsValue)
+	hooks.Wait()
+}
 
-	if options.ListJobs {
-		core.ListJobs(restorationContext)
+// the pending events are delivered to the hooks before exiting
+func exit(code int) {
+	hooks.Wait()
+	os.Exit(code)
+}
 
-	} else {
-		awsutils.LoadJobIdsAtStartup(restorationContext.GlacierClient, restorationContext.MappingVault, restorationContext.Vault)
-		core.DownloadMappingArchive(restorationContext)
-		core.QueryFiltersIfNecessary(restorationContext)
-		if options.List {
-			core.ListArchives(restorationContext)
-		} else {
+func runCommand(optionsValue options.Options) {
+	switch optionsValue.Command {
+	case options.COMMAND_RESTORE:
+		core.DisplayInfoAboutCosts(optionsValue)
+		awsutils.DownloadLimiter = bandwidth.NewLimiter(optionsValue.MaxBandwidth, optionsValue.BandwidthSchedule)
+		restored := true
+		forEachVault(optionsValue, true, func(restorationContext *core.RestorationContext) {
 			err := core.CheckDestinationDirectory(restorationContext)
 			utils.ExitIfError(err)
-			core.DownloadArchives(restorationContext)
+			if !core.DownloadArchives(restorationContext) {
+				restored = false
+			}
+		})
+		if !restored {
+			exit(1)
 		}
+	case options.COMMAND_LS:
+		forEachVault(optionsValue, true, core.ListArchives)
+	case options.COMMAND_MAPPING:
+		forEachVault(optionsValue, false, func(restorationContext *core.RestorationContext) {
+			outputs.Printfln(outputs.Info, "Mapping file of vault %s:%s: %s", restorationContext.Region, restorationContext.Vault, restorationContext.GetMappingFilePath())
+		})
+	case options.COMMAND_ESTIMATE:
+		forEachVault(optionsValue, true, func(restorationContext *core.RestorationContext) {
+			core.DisplayRestorationEstimate(core.EstimateRestoration(restorationContext))
+		})
+	case options.COMMAND_VAULTS:
+		awsutils.LoadAccountSession(optionsValue.AwsId, optionsValue.AwsSecret, optionsValue.AwsProfile)
+		core.ConfigureVaultsDiscovery(optionsValue)
+		core.DisplayVaultsInfo(core.SelectVaultsForInfo(optionsValue), optionsValue)
+	case options.COMMAND_AUDIT:
+		consistent := true
+		forEachVault(optionsValue, false, func(restorationContext *core.RestorationContext) {
+			if !core.AuditVault(restorationContext, optionsValue.RefreshInventory) {
+				consistent = false
+			}
+		})
+		if !consistent {
+			exit(1)
+		}
+	case options.COMMAND_JOBS:
+		awsutils.LoadAccountSession(optionsValue.AwsId, optionsValue.AwsSecret, optionsValue.AwsProfile)
+		core.ConfigureVaultsDiscovery(optionsValue)
+		jobsFilter := core.JobsFilter{Statuses: optionsValue.JobStatuses, Actions: optionsValue.JobActions, MaxAge: optionsValue.JobMaxAge}
+		jobs := []*core.JobInfo{}
+		for _, restorationContext := range core.CreateRestorationContexts(core.SelectRegionVaults(optionsValue), optionsValue) {
+			jobs = append(jobs, core.GetJobs(restorationContext, jobsFilter, time.Now())...)
+		}
+		core.DisplayJobs(jobs, optionsValue.Output, time.Now())
+	case options.COMMAND_VERIFY:
+		core.SelectLocalAccount(optionsValue)
+		if optionsValue.Dest == "" {
+			optionsValue.Dest = inputs.QueryString("destination", "What is the destination directory path ?")
+		}
+		consistent := true
+		for _, restorationContext := range core.CreateOfflineRestorationContexts(core.SelectLocalVaults(optionsValue), optionsValue) {
+			if !core.VerifyDestination(restorationContext) {
+				consistent = false
+			}
+		}
+		if !consistent {
+			exit(1)
+		}
+	case options.COMMAND_COMPLETION:
+		outputs.Println(outputs.Info, core.CompletionScript(optionsValue.CommandArgs[0]))
+	case options.COMMAND_CONFIG:
+		options.DisplaySettings(optionsValue.Settings)
+	case options.COMMAND_DAEMON:
+		core.RunDaemon(optionsValue, os.Args[2:])
+	case options.COMMAND_CTL:
+		core.RunCtl(optionsValue)
+	case options.COMMAND_CACHE:
+		core.SelectLocalAccount(optionsValue)
+		runCacheCommand(optionsValue.CommandArgs[0], optionsValue)
 	}
+}
 
+func runCacheCommand(action string, optionsValue options.Options) {
+	switch action {
+	case "list":
+		core.ListVaultCaches(core.GetVaultCaches(), time.Now())
+	case "show":
+		core.ShowVaultCaches(core.SelectVaultCaches(optionsValue))
+	case "clean":
+		core.CleanVaultCaches(core.SelectVaultCaches(optionsValue))
+	case "prune":
+		core.PruneVaultCaches(optionsValue.OlderThan, time.Now())
+	}
 }
 
+var currentRestorationContext *core.RestorationContext
+
+func configureHooks(optionsValue options.Options) {
+	hooks.HiddenEnvironmentVariables = options.SecretEnvironmentVariables()
+	hooks.Configure(optionsValue.HookCommands, optionsValue.Webhooks, optionsValue.WebhookRetries, optionsValue.HookEvents)
+	if len(optionsValue.Mail.To) > 0 {
+		hooks.ConfigureMail(optionsValue.Mail)
+	}
+	utils.OnFatalError = func(err error) {
+		event := hooks.Event{Event: hooks.EVENT_FATAL_ERROR, Error: err.Error()}
+		if currentRestorationContext != nil {
+			event.Region, event.Vault, event.Destination = currentRestorationContext.Region, currentRestorationContext.Vault, currentRestorationContext.DestinationDirPath
+		}
+		hooks.Fire(event)
+		hooks.Wait()
+	}
+}
 
+// run the action on each selected vault once its mapping file is downloaded, and its filters are queried if needed
+func forEachVault(optionsValue options.Options, withFilters bool, action func(restorationContext *core.RestorationContext)) {
+	awsutils.LoadAccountSession(optionsValue.AwsId, optionsValue.AwsSecret, optionsValue.AwsProfile)
+	core.ConfigureVaultsDiscovery(optionsValue)
+	restorationContexts := core.CreateRestorationContexts(core.SelectRegionVaults(optionsValue), optionsValue)
+	for _, restorationContext := range restorationContexts {
+		if len(restorationContexts) > 1 {
+			outputs.Printfln(outputs.Info, "### Vault %s:%s", restorationContext.Region, restorationContext.Vault)
+		}
+		currentRestorationContext = restorationContext
+		awsutils.ResetJobIdsAtStartup()
+		awsutils.LoadJobIdsAtStartup(restorationContext.GlacierClient, restorationContext.MappingVault, restorationContext.Vault)
+		core.DownloadMappingArchive(restorationContext)
+		if withFilters {
+			core.QueryFiltersIfNecessary(restorationContext)
+		}
+		action(restorationContext)
+	}
+}
@@ -0,0 +1,344 @@
+package options
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+	flag "github.com/spf13/pflag"
+	"rsg/hooks"
+)
+
+// Commands of rsg, each one with its own options added to the global options.
+//
+// Without command, "restore" is used so the command lines of previous versions still work.
+
+const (
+	COMMAND_RESTORE = "restore"
+	COMMAND_LS = "ls"
+	COMMAND_JOBS = "jobs"
+	COMMAND_VAULTS = "vaults"
+	COMMAND_MAPPING = "mapping"
+	COMMAND_ESTIMATE = "estimate"
+	COMMAND_VERIFY = "verify"
+	COMMAND_AUDIT = "audit"
+	COMMAND_CACHE = "cache"
+	COMMAND_COMPLETION = "completion"
+	COMMAND_CONFIG = "config"
+	COMMAND_DAEMON = "daemon"
+	COMMAND_CTL = "ctl"
+	COMMAND_HELP = "help"
+	COMMAND_COMPLETE = "__complete" // called by completion scripts, not displayed in help
+)
+
+type command struct {
+	name           string
+	description    string
+	arguments      []string          // allowed values of the first argument, no argument if empty
+	argumentValues map[string]string // name of the value following an argument, for arguments followed by a value
+	argumentFlags  map[string]string // flags used only with one argument, by flag name
+	addFlags       func(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions)
+}
+
+// options which need to be parsed after the flags
+type rawOptions struct {
+	maxBandwidth       string
+	bandwidthSchedule  []string
+	downloadWindow     string
+	retrievalWindow    string
+	speed              string
+	refreshMappingFile bool
+	keepFiles          bool
+	list               bool
+	listJobs           bool
+}
+
+var commands = []*command{
+	{name: COMMAND_RESTORE, description: "restore files of synology backup vaults (default command)", addFlags: func(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+		addDestinationFlag(flagSet, options)
+		addMappingFlags(flagSet, options, rawOptions)
+		flagSet.BoolVar(&rawOptions.keepFiles, "keep-files", true, "enable or disable keep existing files")
+		flagSet.IntVar(&options.JobRetries, "job-retries", 2, "number of new jobs started for a range of an archive whose retrieval job has failed")
+		addDownloadFlags(flagSet, options, rawOptions)
+		flagSet.BoolVarP(&rawOptions.list, "list", "l", false, "list files")
+		flagSet.MarkDeprecated("list", "use \"rsg ls\"")
+		flagSet.BoolVar(&rawOptions.listJobs, "list-jobs", false, "list aws jobs")
+		flagSet.MarkDeprecated("list-jobs", "use \"rsg jobs\"")
+	}},
+	{name: COMMAND_LS, description: "list files of the mapping file", addFlags: addMappingFlags},
+	{name: COMMAND_JOBS, description: "list aws jobs of the vaults", addFlags: func(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+		flagSet.StringSliceVar(&options.JobStatuses, "status", []string{}, "keep jobs with this status (InProgress, Succeeded, Failed)")
+		flagSet.StringSliceVar(&options.JobActions, "action", []string{}, "keep jobs with this action (ArchiveRetrieval, InventoryRetrieval)")
+		flagSet.DurationVar(&options.JobMaxAge, "max-age", 0, "keep jobs created during this duration (ex 24h)")
+		flagSet.StringVarP(&options.Output, "output", "o", OUTPUT_TABLE, "output format, \"table\" or \"json\"")
+	}},
+	{name: COMMAND_VAULTS, description: "display synology backup vaults with their cache and mapping file", addFlags: noFlags},
+	{name: COMMAND_MAPPING, description: "download the mapping file of the vaults", addFlags: addMappingFlags},
+	{name: COMMAND_ESTIMATE, description: "estimate size and duration of a restore", addFlags: func(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+		addMappingFlags(flagSet, options, rawOptions)
+		flagSet.StringVar(&rawOptions.speed, "speed", "", "download speed by second (ex 512K, 20M), default: speed measured on glacier downloads")
+	}},
+	{name: COMMAND_VERIFY, description: "verify a restored destination directory against the mapping file, offline", addFlags: func(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+		addDestinationFlag(flagSet, options)
+		addFilterFlag(flagSet, options)
+	}},
+	{name: COMMAND_AUDIT, description: "reconcile the mapping file with an inventory of the data vault", addFlags: func(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+		addMappingFlags(flagSet, options, rawOptions)
+		flagSet.BoolVar(&options.RefreshInventory, "refresh-inventory", false, "retrieve a new inventory of the data vault instead of the cached one")
+	}},
+	{name: COMMAND_CACHE, description: "manage caches and mapping files of the working directory", arguments: []string{"list", "show", "clean", "prune"},
+		argumentFlags: map[string]string{"older-than": "prune"},
+		addFlags: func(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+			flagSet.DurationVar(&options.OlderThan, "older-than", 0, "prune: remove caches of vaults not used during this duration (ex 720h)")
+		}},
+	{name: COMMAND_COMPLETION, description: "print the completion script of a shell", arguments: []string{"bash", "zsh", "fish"}, addFlags: noFlags},
+	{name: COMMAND_DAEMON, description: "run restores submitted by \"rsg ctl\", its global options are given to each restore", addFlags: noFlags},
+	{name: COMMAND_CTL, description: "submit, list, pause, resume and cancel restores of the daemon", arguments: []string{"submit", "list", "pause", "resume", "cancel"},
+		argumentValues: map[string]string{"pause": "id", "resume": "id", "cancel": "id"},
+		argumentFlags: map[string]string{"destination": "submit", "filter": "submit"},
+		addFlags: func(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+			addDestinationFlag(flagSet, options)
+			addFilterFlag(flagSet, options)
+			flagSet.StringVarP(&options.Output, "output", "o", OUTPUT_TABLE, "list: output format, \"table\" or \"json\"")
+		}},
+}
+
+// "config show" accepts the options of all commands, to show their effective values
+func init() {
+	commands = append(commands, &command{name: COMMAND_CONFIG, description: "show the effective options, with the configuration file and the profile", arguments: []string{"show"},
+		addFlags: func(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+			for _, command := range commands {
+				if command.name != COMMAND_CONFIG {
+					commandFlagSet := flag.NewFlagSet(command.name, flag.ContinueOnError)
+					command.addFlags(commandFlagSet, options, rawOptions)
+					flagSet.AddFlagSet(commandFlagSet)
+				}
+			}
+		}})
+}
+
+// values of flags which accept a fixed list of values
+var flagValues = map[string][]string{
+	"output": {OUTPUT_TABLE, OUTPUT_JSON},
+	"speed-test-mode": {SPEED_TEST_WEB, SPEED_TEST_GLACIER},
+	"status": {"InProgress", "Succeeded", "Failed"},
+	"action": {"ArchiveRetrieval", "InventoryRetrieval"},
+	"hook-event": hooks.EventNames,
+	"smtp-security": hooks.SmtpSecurities,
+}
+
+func findCommand(name string) *command {
+	for _, command := range commands {
+		if command.name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+func CommandNames() []string {
+	names := []string{}
+	for _, command := range commands {
+		names = append(names, command.name)
+	}
+	return append(names, COMMAND_HELP)
+}
+
+// allowed values of the argument of the command, nil if it has no argument
+func CommandArguments(commandName string) []string {
+	if command := findCommand(commandName); command != nil {
+		return command.arguments
+	}
+	return nil
+}
+
+// "--name" and "-n" of the global and command flags, without deprecated flags
+func CommandFlags(commandName string) []string {
+	flagNames := []string{}
+	if command := findCommand(commandName); command != nil {
+		newFlagSet(command, &Options{}, &rawOptions{}).VisitAll(func(flag *flag.Flag) {
+			if flag.Deprecated == "" && !flag.Hidden {
+				flagNames = append(flagNames, "--" + flag.Name)
+				if flag.Shorthand != "" {
+					flagNames = append(flagNames, "-" + flag.Shorthand)
+				}
+			}
+		})
+	}
+	return flagNames
+}
+
+// long name of the flag given as "--name" or "-n" if it expects a value, "" otherwise
+func FlagExpectingValue(commandName, flagName string) string {
+	command := findCommand(commandName)
+	if command == nil {
+		return ""
+	}
+	name := ""
+	newFlagSet(command, &Options{}, &rawOptions{}).VisitAll(func(flag *flag.Flag) {
+		if (flagName == "--" + flag.Name || (flag.Shorthand != "" && flagName == "-" + flag.Shorthand)) && flag.Value.Type() != "bool" {
+			name = flag.Name
+		}
+	})
+	return name
+}
+
+// fixed values of the flag, nil if any value is accepted
+func FlagValues(flagName string) []string {
+	return flagValues[flagName]
+}
+
+func addGlobalFlags(flagSet *flag.FlagSet, options *Options) {
+	flagSet.StringVarP(&options.Region, "region", "r", "", "region of the vault")
+	flagSet.StringSliceVarP(&options.Vaults, "vault", "v", []string{}, "vault, repeat it or use region:vault to use several vaults")
+	flagSet.BoolVar(&options.AllVaults, "all-vaults", false, "use all synology backup vaults, restored each one in a subdirectory of destination")
+	flagSet.StringSliceVar(&options.Regions, "regions", []string{}, "regions to scan for synology backup vaults (default: all glacier regions)")
+	flagSet.DurationVar(&options.VaultsCacheTtl, "vaults-cache-ttl", 24 * time.Hour, "duration before scanning again the vaults of a region")
+	flagSet.BoolVar(&options.RefreshVaults, "refresh-vaults", false, "scan again the vaults of all regions")
+	flagSet.StringVar(&options.AwsId, "aws-id", "", "id of aws credentials")
+	flagSet.StringVar(&options.AwsSecret, "aws-secret", "", "secret of aws credentials")
+	flagSet.StringVar(&options.AwsProfile, "aws-profile", "", "profile of aws shared credentials file (default: $AWS_PROFILE, else \"default\")")
+	flagSet.StringVar(&options.ConfigPath, "config", "", "configuration file (default: ~/.rsg/config.yaml)")
+	flagSet.StringVar(&options.ProfileName, "profile-name", "", "profile of the configuration file to use")
+	flagSet.StringVar(&options.AccountId, "account-id", "", "aws account of the vaults for offline commands, when the working directory has several accounts, also moves the working directory ~/.rsg of previous versions into this account")
+	flagSet.StringVar(&options.WorkDir, "work-dir", "", "working directory for caches and mapping files (default: $RSG_HOME, else $XDG_CACHE_HOME/rsg)")
+	flagSet.StringVar(&options.AnswersPath, "answers", "", "yaml file of answers to the prompts, by prompt id (ex destination: /mnt/restore)")
+	flagSet.BoolVar(&options.NoPrompt, "no-prompt", false, "fail instead of prompting when an answer is missing")
+	flagSet.Var(newStringArrayValue(&options.HookCommands), "hook-command", "command run on restore events with the event as json on stdin, repeat it to run several commands")
+	flagSet.Var(newStringArrayValue(&options.Webhooks), "webhook", "url receiving restore events as json by http POST, repeat it to use several urls")
+	flagSet.IntVar(&options.WebhookRetries, "webhook-retries", 3, "number of retries of a failed webhook")
+	flagSet.StringSliceVar(&options.HookEvents, "hook-event", []string{}, "events firing the hooks among " + strings.Join(hooks.EventNames, ", ") + " (default: " + strings.Join(hooks.DefaultEventNames, ", ") + ")")
+	flagSet.StringVar(&options.Mail.Server, "smtp-server", "", "SMTP server sending mails, host:port")
+	flagSet.StringVar(&options.Mail.Security, "smtp-security", hooks.SMTP_STARTTLS, "security of the SMTP connection, " + strings.Join(hooks.SmtpSecurities, ", "))
+	flagSet.StringVar(&options.Mail.User, "smtp-user", "", "user of SMTP authentication")
+	flagSet.StringVar(&options.Mail.Password, "smtp-password", "", "password of SMTP authentication")
+	flagSet.StringVar(&options.Mail.From, "mail-from", "", "sender of mails (default: rsg@hostname)")
+	flagSet.StringSliceVar(&options.Mail.To, "mail-to", []string{}, "mail mapping ready, restore finished and restore failure to these addresses")
+	flagSet.BoolVar(&options.Verbose, "verbose", false, "display low level messages")
+	flagSet.BoolVar(&options.InfoMessage, "info-messages", true, "display information messages")
+	flagSet.BoolVar(&options.Version, "version", false, "display version")
+}
+
+func noFlags(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+}
+
+func addDestinationFlag(flagSet *flag.FlagSet, options *Options) {
+	flagSet.StringVarP(&options.Dest, "destination", "d", "", "path to restoration directory")
+}
+
+func addFilterFlag(flagSet *flag.FlagSet, options *Options) {
+	flagSet.StringSliceVarP(&options.Filters, "filter", "f", []string{}, "filter files (globals * and ?)")
+}
+
+func addMappingFlags(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+	addFilterFlag(flagSet, options)
+	flagSet.BoolVar(&rawOptions.refreshMappingFile, "refresh-mapping-file", false, "enable or disable refresh of mapping file")
+	flagSet.StringVar(&options.MappingArchive, "mapping-archive", "", "id of the mapping archive to use, or date (ex 2016-08-01) to use the newest mapping created before the end of this day (default: newest)")
+}
+
+func addDownloadFlags(flagSet *flag.FlagSet, options *Options, rawOptions *rawOptions) {
+	flagSet.StringVar(&rawOptions.maxBandwidth, "max-bandwidth", "", "max download bandwidth by second (ex 512K, 20M)")
+	flagSet.StringSliceVar(&rawOptions.bandwidthSchedule, "bandwidth-schedule", []string{}, "max download bandwidth by time of day, overrides max-bandwidth (ex 08:00-18:00=2M)")
+	flagSet.StringVar(&rawOptions.downloadWindow, "download-window", "", "download only inside this time of day window (ex 22:00-07:00)")
+	flagSet.StringVar(&rawOptions.retrievalWindow, "retrieval-window", "", "start retrieval jobs only inside this time of day window (ex 22:00-07:00)")
+	flagSet.StringVar(&rawOptions.speed, "speed", "", "download speed by second, skip the speed test (ex 512K, 20M)")
+	flagSet.StringVar(&options.SpeedTestUrl, "speed-test-url", "", "url of the file downloaded to test speed (default: last go source archive)")
+	flagSet.StringVar(&options.SpeedTestMode, "speed-test-mode", SPEED_TEST_WEB, "\"web\" to test speed on speed-test-url, \"glacier\" to use the speed measured on glacier downloads")
+}
+
+// list flag keeping each value as given, unlike a string slice flag splitting values on commas, for commands and
+// urls which may contain commas
+type stringArrayValue struct {
+	value   *[]string
+	changed bool
+}
+
+func newStringArrayValue(value *[]string) *stringArrayValue {
+	*value = []string{}
+	return &stringArrayValue{value: value}
+}
+
+func (stringArray *stringArrayValue) Set(value string) error {
+	if !stringArray.changed {
+		*stringArray.value = []string{value}
+	} else {
+		*stringArray.value = append(*stringArray.value, value)
+	}
+	stringArray.changed = true
+	return nil
+}
+
+func (stringArray *stringArrayValue) Type() string {
+	return "stringArray"
+}
+
+func (stringArray *stringArrayValue) String() string {
+	return "[" + strings.Join(*stringArray.value, ",") + "]"
+}
+
+func newFlagSet(command *command, options *Options, rawOptions *rawOptions) *flag.FlagSet {
+	flagSet := flag.NewFlagSet("rsg " + command.name, flag.ContinueOnError)
+	flagSet.SetOutput(new(bytes.Buffer)) // errors are returned by Parse
+	flagSet.Usage = func() {}
+	addGlobalFlags(flagSet, options)
+	command.addFlags(flagSet, options, rawOptions)
+	return flagSet
+}
+
+func usage() string {
+	buffer := new(bytes.Buffer)
+	fmt.Fprintln(buffer, "Usage: rsg [command] [options]")
+	fmt.Fprintln(buffer)
+	fmt.Fprintln(buffer, "Commands:")
+	writer := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	for _, command := range commands {
+		fmt.Fprintf(writer, "  %s\t%s\n", commandLine(command), command.description)
+	}
+	writer.Flush()
+	fmt.Fprintln(buffer)
+	fmt.Fprintln(buffer, "Global options:")
+	globalFlagSet := flag.NewFlagSet("rsg", flag.ContinueOnError)
+	addGlobalFlags(globalFlagSet, &Options{})
+	fmt.Fprint(buffer, globalFlagSet.FlagUsages())
+	fmt.Fprintln(buffer)
+	fmt.Fprint(buffer, "Use \"rsg help <command>\" for the options of a command.")
+	return buffer.String()
+}
+
+func commandUsage(command *command) string {
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "Usage: rsg %s [options]\n", commandLine(command))
+	fmt.Fprintln(buffer)
+	fmt.Fprintln(buffer, command.description)
+	fmt.Fprintln(buffer)
+	commandFlagSet := flag.NewFlagSet("rsg " + command.name, flag.ContinueOnError)
+	command.addFlags(commandFlagSet, &Options{}, &rawOptions{})
+	if commandOptions := commandFlagSet.FlagUsages(); commandOptions != "" {
+		fmt.Fprintln(buffer, "Options:")
+		fmt.Fprint(buffer, commandOptions)
+		fmt.Fprintln(buffer)
+	}
+	fmt.Fprint(buffer, "Use \"rsg help\" for the global options.")
+	return buffer.String()
+}
+
+// false if the flag is used only with another argument of the command
+func (command *command) appliesFlag(flagName string, commandArgs []string) bool {
+	argument, ok := command.argumentFlags[flagName]
+	return !ok || (len(commandArgs) > 0 && commandArgs[0] == argument)
+}
+
+func commandLine(command *command) string {
+	if len(command.arguments) == 0 {
+		return command.name
+	}
+	arguments := []string{}
+	for _, argument := range command.arguments {
+		if valueName, ok := command.argumentValues[argument]; ok {
+			argument += " <" + valueName + ">"
+		}
+		arguments = append(arguments, argument)
+	}
+	return command.name + " " + strings.Join(arguments, "|")
+}
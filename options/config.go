@@ -0,0 +1,329 @@
+package options
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+	"rsg/outputs"
+	"rsg/utils"
+)
+
+// Configuration file giving default values of the options.
+//
+// Keys are the names of the options, "defaults" applies to every run and a profile selected with --profile-name
+// overrides them. Environment variables RSG_<OPTION> (ex RSG_AWS_SECRET) override both, and options of the
+// command line override everything. Options which do not apply to the command are ignored. Example:
+//
+//   defaults:
+//     region: eu-west-1
+//     max-bandwidth: 2M
+//   profiles:
+//     photos:
+//       aws-profile: home
+//       vault: backup
+//       destination: /mnt/restore
+//       filter: ["photos/*", "videos/*"]
+//       download-window: 22:00-07:00
+
+const (
+	SOURCE_DEFAULT = "default"
+	SOURCE_CONFIG = "config"
+	SOURCE_PROFILE = "profile"
+	SOURCE_ENVIRONMENT = "environment"
+	SOURCE_COMMAND_LINE = "command line"
+)
+
+// options displayed masked by "rsg config show"
+var secretOptions = []string{"aws-id", "aws-secret", "webhook", "smtp-password"}
+
+type configFile struct {
+	Defaults map[string]interface{}            `yaml:"defaults"`
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// effective value of an option and where it comes from
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// ~/.rsg/config.yaml, or $XDG_CONFIG_HOME/rsg/config.yaml (~/.config/rsg/config.yaml by default) if only this
+// one exists
+func defaultConfigPath() string {
+	usr, err := user.Current()
+	utils.ExitIfError(err)
+	configPath := usr.HomeDir + "/.rsg/config.yaml"
+	if utils.Exists(configPath) {
+		return configPath
+	}
+	xdgConfigPath := usr.HomeDir + "/.config/rsg/config.yaml"
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(xdgConfigHome) {
+		xdgConfigPath = xdgConfigHome + "/rsg/config.yaml"
+	}
+	if utils.Exists(xdgConfigPath) {
+		return xdgConfigPath
+	}
+	return configPath
+}
+
+func environmentVariable(optionName string) string {
+	return "RSG_" + strings.ToUpper(strings.Replace(optionName, "-", "_", -1))
+}
+
+// variables of the secret options, given to the restores started by the daemon
+func SecretEnvironmentVariables() []string {
+	variables := []string{}
+	for _, name := range secretOptions {
+		variables = append(variables, environmentVariable(name))
+	}
+	return variables
+}
+
+func isListFlag(flag *flag.Flag) bool {
+	return flag.Value.Type() == "stringSlice" || flag.Value.Type() == "stringArray"
+}
+
+// values of commands and urls may contain commas, they are given one by line in environment variables
+func listSeparator(flag *flag.Flag) string {
+	if flag.Value.Type() == "stringArray" {
+		return "\n"
+	}
+	return ","
+}
+
+// each value of a flag repeated on the command line is set apart, the values of other flags are split by the flag
+func setFlagValues(flagSet *flag.FlagSet, name string, values []string) error {
+	if flagSet.Lookup(name).Value.Type() != "stringArray" {
+		return flagSet.Set(name, strings.Join(values, ","))
+	}
+	for _, value := range values {
+		if err := flagSet.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// move the secret options of the arguments to environment variables, so they are not on the command line of a
+// process started with the arguments, where any user can read them
+func SplitSecretArguments(arguments []string) ([]string, []string) {
+	flagSet := newFlagSet(findCommand(COMMAND_RESTORE), &Options{}, &rawOptions{})
+	otherArguments := []string{}
+	secretNames := []string{}
+	secretValues := make(map[string][]string)
+	for i := 0; i < len(arguments); i++ {
+		name := strings.TrimPrefix(arguments[i], "--")
+		value := ""
+		hasValue := false
+		if index := strings.Index(name, "="); index >= 0 {
+			name, value, hasValue = name[:index], name[index + 1:], true
+		}
+		if !strings.HasPrefix(arguments[i], "--") || !utils.Contains(secretOptions, name) {
+			otherArguments = append(otherArguments, arguments[i])
+			continue
+		}
+		if !hasValue && i + 1 < len(arguments) {
+			i++
+			value = arguments[i]
+		}
+		if _, ok := secretValues[name]; !ok {
+			secretNames = append(secretNames, name)
+		}
+		// the last value is used, except for lists
+		if isListFlag(flagSet.Lookup(name)) {
+			secretValues[name] = append(secretValues[name], value)
+		} else {
+			secretValues[name] = []string{value}
+		}
+	}
+	environment := []string{}
+	for _, name := range secretNames {
+		environment = append(environment, environmentVariable(name) + "=" + strings.Join(secretValues[name], listSeparator(flagSet.Lookup(name))))
+	}
+	return otherArguments, environment
+}
+
+func readConfigFile(configPath string, configPathGiven bool) (*configFile, error) {
+	config := &configFile{}
+	content, err := ioutil.ReadFile(configPath)
+	if os.IsNotExist(err) && !configPathGiven {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(content, config); err != nil {
+		return nil, errors.New(fmt.Sprintf("Cannot read configuration file %s: %v", configPath, err))
+	}
+	return config, nil
+}
+
+// set the options not given on the command line from the environment, then from the profile, then from the
+// defaults, and return where each option comes from
+func applyConfig(flagSet *flag.FlagSet, command *command, options *Options) (map[string]string, error) {
+	sources := make(map[string]string)
+	flagSet.VisitAll(func(flag *flag.Flag) {
+		sources[flag.Name] = SOURCE_DEFAULT
+		if flag.Changed {
+			sources[flag.Name] = SOURCE_COMMAND_LINE
+		}
+	})
+	var err error
+	flagSet.VisitAll(func(flag *flag.Flag) {
+		value, ok := os.LookupEnv(environmentVariable(flag.Name))
+		if !ok || err != nil || sources[flag.Name] != SOURCE_DEFAULT || flag.Deprecated != "" || !command.appliesFlag(flag.Name, options.CommandArgs) {
+			return
+		}
+		if err = setFlagValues(flagSet, flag.Name, strings.Split(value, listSeparator(flag))); err != nil {
+			err = errors.New(fmt.Sprintf("Invalid value of %s: %v", environmentVariable(flag.Name), err))
+			return
+		}
+		sources[flag.Name] = SOURCE_ENVIRONMENT
+	})
+	if err != nil {
+		return nil, err
+	}
+	configPath := options.ConfigPath
+	if configPath == "" {
+		configPath = defaultConfigPath()
+	}
+	config, err := readConfigFile(configPath, options.ConfigPath != "")
+	if err != nil {
+		return nil, err
+	}
+	values := []map[string]interface{}{}
+	valueSources := []string{}
+	if options.ProfileName != "" {
+		profile, ok := config.Profiles[options.ProfileName]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Profile %s not found in %s, profiles: %s", options.ProfileName, configPath, strings.Join(profileNames(config), ", ")))
+		}
+		values = append(values, profile)
+		valueSources = append(valueSources, SOURCE_PROFILE)
+	}
+	values = append(values, config.Defaults)
+	valueSources = append(valueSources, SOURCE_CONFIG)
+
+	for i, configValues := range values {
+		for _, name := range sortedKeys(configValues) {
+			if !isOptionName(name) {
+				return nil, errors.New(fmt.Sprintf("Unknown option %s in %s", name, configPath))
+			}
+			if name == "config" || name == "profile-name" {
+				return nil, errors.New(fmt.Sprintf("Option %s cannot be set in %s", name, configPath))
+			}
+			// options of other commands, or of other arguments of the command, are ignored
+			if flagSet.Lookup(name) == nil || sources[name] != SOURCE_DEFAULT || !command.appliesFlag(name, options.CommandArgs) {
+				continue
+			}
+			if err := setConfigValue(flagSet, name, configValues[name]); err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid value of %s in %s: %v", name, configPath, err))
+			}
+			sources[name] = valueSources[i]
+		}
+	}
+	return sources, nil
+}
+
+func profileNames(config *configFile) []string {
+	names := []string{}
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isOptionName(name string) bool {
+	for _, command := range commands {
+		if newFlagSet(command, &Options{}, &rawOptions{}).Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// lists are given as csv, as on the command line
+func setConfigValue(flagSet *flag.FlagSet, name string, value interface{}) error {
+	list, ok := value.([]interface{})
+	if !ok || flagSet.Lookup(name).Value.Type() != "stringArray" {
+		return flagSet.Set(name, configValueToString(value))
+	}
+	values := []string{}
+	for _, listValue := range list {
+		values = append(values, fmt.Sprint(listValue))
+	}
+	return setFlagValues(flagSet, name, values)
+}
+
+func configValueToString(value interface{}) string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	values := []string{}
+	for _, listValue := range list {
+		values = append(values, fmt.Sprint(listValue))
+	}
+	buffer := new(bytes.Buffer)
+	writer := csv.NewWriter(buffer)
+	writer.Write(values)
+	writer.Flush()
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+func getSettings(flagSet *flag.FlagSet, sources map[string]string) []Setting {
+	settings := []Setting{}
+	flagSet.VisitAll(func(flag *flag.Flag) {
+		if flag.Deprecated != "" || flag.Name == "version" {
+			return
+		}
+		value := flag.Value.String()
+		if utils.Contains(secretOptions, flag.Name) {
+			value = maskSecret(value)
+		}
+		settings = append(settings, Setting{Name: flag.Name, Value: value, Source: sources[flag.Name]})
+	})
+	return settings
+}
+
+func maskSecret(value string) string {
+	if len(value) > 3 {
+		return value[0:3] + "..."
+	}
+	if value != "" {
+		return "..."
+	}
+	return ""
+}
+
+func DisplaySettings(settings []Setting) {
+	buffer := new(bytes.Buffer)
+	writer := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "OPTION\tVALUE\tSOURCE")
+	for _, setting := range settings {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", setting.Name, setting.Value, setting.Source)
+	}
+	writer.Flush()
+	outputs.Printfln(outputs.Info, "%s", strings.TrimSuffix(buffer.String(), "\n"))
+}
@@ -0,0 +1,229 @@
+package options
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+defaults:
+  region: config-region
+  max-bandwidth: 1M
+  destination: /config/dest
+  older-than: 720h
+  speed-test-url: http://config/file
+profiles:
+  photos:
+    region: profile-region
+    vault: photos
+    filter: ["photos/*", "videos/*"]
+  speed:
+    speed: 2M
+  all:
+    all-vaults: true
+`
+
+func setTestEnvironment(variables map[string]string) func() {
+	for name, value := range variables {
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name := range variables {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func findSetting(settings []Setting, name string) Setting {
+	for _, setting := range settings {
+		if setting.Name == name {
+			return setting
+		}
+	}
+	return Setting{}
+}
+
+func TestParseArguments_merge_defaults_profile_environment_and_command_line(t *testing.T) {
+	tests := []struct {
+		arguments   []string
+		environment map[string]string
+		region      string
+		source      string
+	}{
+		{[]string{"config", "show"}, nil, "config-region", SOURCE_CONFIG},
+		{[]string{"config", "show", "--profile-name", "photos"}, nil, "profile-region", SOURCE_PROFILE},
+		{[]string{"config", "show", "--profile-name", "photos"}, map[string]string{"RSG_REGION": "env-region"}, "env-region", SOURCE_ENVIRONMENT},
+		{[]string{"config", "show", "--profile-name", "photos", "-r", "cli-region"}, map[string]string{"RSG_REGION": "env-region"}, "cli-region", SOURCE_COMMAND_LINE},
+		{[]string{"config", "show"}, map[string]string{"RSG_PROFILE_NAME": "photos"}, "profile-region", SOURCE_PROFILE},
+	}
+	for _, test := range tests {
+		// Given
+		initTestConfig(testConfig)
+		restoreEnvironment := setTestEnvironment(test.environment)
+
+		// When
+		options, err := parseTestArguments(test.arguments...)
+		restoreEnvironment()
+
+		// Then
+		if !assert.NoError(t, err, "%v %v", test.arguments, test.environment) {
+			continue
+		}
+		assert.Equal(t, test.region, options.Region, "%v %v", test.arguments, test.environment)
+		assert.Equal(t, Setting{Name: "region", Value: test.region, Source: test.source}, findSetting(options.Settings, "region"))
+		assert.Equal(t, Setting{Name: "max-bandwidth", Value: "1M", Source: SOURCE_CONFIG}, findSetting(options.Settings, "max-bandwidth"))
+		assert.Equal(t, Setting{Name: "vaults-cache-ttl", Value: "24h0m0s", Source: SOURCE_DEFAULT}, findSetting(options.Settings, "vaults-cache-ttl"))
+	}
+}
+
+func TestParseArguments_configured_options_do_not_conflict_with_command_line(t *testing.T) {
+	tests := []struct {
+		arguments []string
+		check     func(options Options)
+	}{
+		{[]string{"--profile-name", "photos", "--all-vaults"}, func(options Options) {
+			assert.True(t, options.AllVaults)
+			assert.Empty(t, options.Vaults)
+		}},
+		{[]string{"--profile-name", "all", "--vault", "vault"}, func(options Options) {
+			assert.False(t, options.AllVaults)
+			assert.Equal(t, []string{"vault"}, options.Vaults)
+		}},
+		{[]string{"--speed", "1M"}, func(options Options) {
+			assert.Equal(t, uint64(1024 * 1024), options.Speed)
+		}},
+		{[]string{"--profile-name", "speed", "--speed-test-url", "http://cli/file"}, func(options Options) {
+			assert.Equal(t, uint64(0), options.Speed)
+			assert.Equal(t, "http://cli/file", options.SpeedTestUrl)
+		}},
+		{[]string{"ctl", "list"}, func(options Options) {
+			assert.Equal(t, "", options.Dest)
+		}},
+		{[]string{"ctl", "submit"}, func(options Options) {
+			assert.Equal(t, "/config/dest", options.Dest)
+		}},
+		{[]string{"cache", "list"}, func(options Options) {
+			assert.Equal(t, time.Duration(0), options.OlderThan)
+		}},
+		{[]string{"cache", "prune"}, func(options Options) {
+			assert.Equal(t, 720 * time.Hour, options.OlderThan)
+		}},
+		{[]string{"ls"}, func(options Options) {
+			assert.Equal(t, "", options.Dest)
+			assert.Equal(t, "config-region", options.Region)
+		}},
+	}
+	for _, test := range tests {
+		// Given
+		initTestConfig(testConfig)
+
+		// When
+		options, err := parseTestArguments(test.arguments...)
+
+		// Then
+		if assert.NoError(t, err, "%v", test.arguments) {
+			test.check(options)
+		}
+	}
+}
+
+func TestParseArguments_configuration_errors(t *testing.T) {
+	tests := []struct {
+		config      string
+		arguments   []string
+		environment map[string]string
+		err         string
+	}{
+		{"defaults:\n  vault: vault\n  all-vaults: true\n", []string{}, nil, "--all-vaults and --vault cannot be used together"},
+		{"defaults:\n  unknown: value\n", []string{}, nil, "Unknown option unknown in " + testConfigPath},
+		{"defaults:\n  profile-name: photos\n", []string{}, nil, "Option profile-name cannot be set in " + testConfigPath},
+		{"defaults:\n  job-retries: many\n", []string{}, nil, "Invalid value of job-retries in " + testConfigPath + ": strconv.ParseInt: parsing \"many\": invalid syntax"},
+		{"defaults: [", []string{}, nil, "Cannot read configuration file " + testConfigPath + ": yaml: line 1: did not find expected node content"},
+		{testConfig, []string{"--profile-name", "videos"}, nil, "Profile videos not found in " + testConfigPath + ", profiles: all, photos, speed"},
+		{"", []string{}, map[string]string{"RSG_JOB_RETRIES": "many"}, "Invalid value of RSG_JOB_RETRIES: strconv.ParseInt: parsing \"many\": invalid syntax"},
+	}
+	for _, test := range tests {
+		// Given
+		initTestConfig(test.config)
+		restoreEnvironment := setTestEnvironment(test.environment)
+
+		// When
+		_, err := parseTestArguments(test.arguments...)
+		restoreEnvironment()
+
+		// Then
+		assert.EqualError(t, err, test.err, "%s %v", test.config, test.arguments)
+	}
+}
+
+func TestParseArguments_missing_configuration_file_given_by_option(t *testing.T) {
+	// Given
+	initTestConfig("")
+
+	// When
+	_, err := parseArguments([]string{"--config", testConfigPath + ".missing"})
+
+	// Then
+	assert.Error(t, err)
+}
+
+func TestSplitSecretArguments(t *testing.T) {
+	tests := []struct {
+		arguments      []string
+		otherArguments []string
+		environment    []string
+	}{
+		{[]string{"--region", "eu-west-1", "-v", "vault"}, []string{"--region", "eu-west-1", "-v", "vault"}, []string{}},
+		{[]string{"--aws-id", "id", "--aws-secret=secret", "--verbose"}, []string{"--verbose"}, []string{"RSG_AWS_ID=id", "RSG_AWS_SECRET=secret"}},
+		{[]string{"--aws-secret", "first", "--aws-secret", "second"}, []string{}, []string{"RSG_AWS_SECRET=second"}},
+		{[]string{"--webhook", "https://host/a?x=1,2", "--smtp-password", "password", "--webhook=https://host/b"}, []string{},
+			[]string{"RSG_WEBHOOK=https://host/a?x=1,2\nhttps://host/b", "RSG_SMTP_PASSWORD=password"}},
+	}
+	for _, test := range tests {
+		// When
+		otherArguments, environment := SplitSecretArguments(test.arguments)
+
+		// Then
+		assert.Equal(t, test.otherArguments, otherArguments, "%v", test.arguments)
+		assert.Equal(t, test.environment, environment, "%v", test.arguments)
+	}
+}
+
+func TestParseArguments_secret_options_from_environment(t *testing.T) {
+	// Given
+	initTestConfig("")
+	otherArguments, environment := SplitSecretArguments([]string{"--aws-secret", "secret", "--webhook", "https://host/a?x=1,2", "--webhook", "https://host/b"})
+	variables := make(map[string]string)
+	for _, variable := range environment {
+		nameAndValue := strings.SplitN(variable, "=", 2)
+		variables[nameAndValue[0]] = nameAndValue[1]
+	}
+	restoreEnvironment := setTestEnvironment(variables)
+	defer restoreEnvironment()
+
+	// When
+	options, err := parseTestArguments(otherArguments...)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", options.AwsSecret)
+	assert.Equal(t, []string{"https://host/a?x=1,2", "https://host/b"}, options.Webhooks)
+}
+
+func TestParseArguments_hook_commands_and_webhooks_are_not_split_on_commas(t *testing.T) {
+	// Given
+	initTestConfig("defaults:\n  webhook: [\"https://host/a?x=1,2\", \"https://host/b\"]\n")
+
+	// When
+	fromCommandLine, err := parseTestArguments("--hook-command", "jq '.a,.b' > f", "--hook-command", "cat")
+	fromConfig, configErr := parseTestArguments()
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"jq '.a,.b' > f", "cat"}, fromCommandLine.HookCommands)
+	assert.NoError(t, configErr)
+	assert.Equal(t, []string{"https://host/a?x=1,2", "https://host/b"}, fromConfig.Webhooks)
+}
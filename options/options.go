@@ -1,49 +1,165 @@
 package options
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
 	flag "github.com/spf13/pflag"
 	"rsg/outputs"
+	"rsg/utils"
+	"rsg/bandwidth"
+	"rsg/schedule"
+	"rsg/hooks"
 )
 
 type Options struct {
 	AwsId              string
 	AwsSecret          string
+	AwsProfile         string
+	ConfigPath         string
+	ProfileName        string
 	Verbose            bool
 	Dest               string
 	Filters            []string
-	List               bool
-	ListJobs           bool
 	Region             string
-	Vault              string
+	Vaults             []string
+	AllVaults          bool
 	InfoMessage        bool
 	RefreshMappingFile *bool
 	KeepFiles          *bool
 	Version          bool
+	MaxBandwidth       uint64
+	BandwidthSchedule  []bandwidth.ScheduledRate
+	DownloadWindow     *schedule.Window
+	RetrievalWindow    *schedule.Window
+	Speed              uint64
+	SpeedTestUrl       string
+	SpeedTestMode      string
+	JobRetries         int
+	Regions            []string
+	VaultsCacheTtl     time.Duration
+	RefreshVaults      bool
+	RefreshInventory   bool
+	MappingArchive     string
+	JobStatuses        []string
+	JobActions         []string
+	JobMaxAge          time.Duration
+	Output             string
+	OlderThan          time.Duration
+	WorkDir            string
+	AccountId          string
+	AnswersPath        string
+	NoPrompt           bool
+	HookCommands       []string
+	Webhooks           []string
+	WebhookRetries     int
+	HookEvents         []string
+	Mail               hooks.MailConfig
+	Command            string
+	CommandArgs        []string
+	Settings           []Setting // effective options, for "config show"
 }
 
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON = "json"
+)
+
+const (
+	SPEED_TEST_WEB = "web"
+	SPEED_TEST_GLACIER = "glacier"
+)
+
 func ParseOptions() Options {
-	options := Options{}
-
-	flag.StringVarP(&options.Region, "region", "r", "", "region of the vault to restore")
-	flag.StringVarP(&options.Vault, "vault", "v", "", "vault to restore")
-	flag.BoolVar(&options.Verbose, "verbose", false, "display low level messages")
-	flag.StringSliceVarP(&options.Filters, "filter", "f", []string{}, "filter files to restore (globals * and ?)")
-	flag.StringVar(&options.AwsId, "aws-id", "", "id of aws credentials")
-	flag.StringVar(&options.AwsSecret, "aws-secret", "", "secret of aws credentials")
-	flag.StringVarP(&options.Dest, "destination", "d", "", "path to restoration directory")
-	flag.BoolVarP(&options.List, "list", "l", false, "list files")
-	flag.BoolVar(&options.ListJobs, "list-jobs", false, "list aws jobs")
-	flag.BoolVar(&options.InfoMessage, "info-messages", true, "display information messages")
-	flag.BoolVar(&options.Version, "version", false, "display version")
-	options.RefreshMappingFile = flag.Bool("refresh-mapping-file", false, "enable or disable refresh of mapping file")
-	options.KeepFiles = flag.Bool("keep-files", true, "enable or disable keep existing files")
-	flag.Parse()
-
-	if !flag.Lookup("refresh-mapping-file").Changed {
-		options.RefreshMappingFile = nil
-	}
-	if !flag.Lookup("keep-files").Changed {
-		options.KeepFiles = nil
+	options, err := parseArguments(os.Args[1:])
+	utils.ExitIfError(err)
+	return options
+}
+
+// rsg [command] [options], restore is the default command
+func parseArguments(arguments []string) (Options, error) {
+	options := Options{Command: COMMAND_RESTORE}
+	if len(arguments) > 0 && (arguments[0] == "-h" || arguments[0] == "--help") {
+		arguments = []string{COMMAND_HELP}
+	}
+	if len(arguments) > 0 && !strings.HasPrefix(arguments[0], "-") {
+		options.Command = arguments[0]
+		arguments = arguments[1:]
+	}
+	if options.Command == COMMAND_COMPLETE {
+		// the words to complete are not parsed, they can be incomplete or invalid
+		options.CommandArgs = arguments
+		return options, nil
+	}
+	if options.Command == COMMAND_HELP {
+		displayHelp(arguments)
+	}
+	command := findCommand(options.Command)
+	if command == nil {
+		return options, errors.New("Unknown command: " + options.Command + ", use \"rsg help\" to list commands")
+	}
+
+	rawOptions := &rawOptions{}
+	flagSet := newFlagSet(command, &options, rawOptions)
+	if err := flagSet.Parse(arguments); err == flag.ErrHelp {
+		outputs.Println(outputs.Info, commandUsage(command))
+		os.Exit(0)
+	} else if err != nil {
+		return options, errors.New(fmt.Sprintf("%v, use \"rsg help %s\" to list its options", err, command.name))
+	}
+	options.CommandArgs = flagSet.Args()
+	if err := checkCommandArgs(command, options.CommandArgs); err != nil {
+		return options, err
+	}
+	// conflicts are checked on the options of the command line, the configuration gives only default values
+	commandLineFlags := make(map[string]bool)
+	flagSet.Visit(func(flag *flag.Flag) {
+		commandLineFlags[flag.Name] = true
+	})
+	sources, err := applyConfig(flagSet, command, &options)
+	if err != nil {
+		return options, err
+	}
+	if options.Command == COMMAND_CONFIG {
+		options.Settings = getSettings(flagSet, sources)
+	}
+
+	if rawOptions.list && rawOptions.listJobs {
+		return options, errors.New("--list and --list-jobs cannot be used together")
+	}
+	if rawOptions.list {
+		options.Command = COMMAND_LS
+	}
+	if rawOptions.listJobs {
+		options.Command = COMMAND_JOBS
+	}
+	if flagSet.Changed("refresh-mapping-file") {
+		options.RefreshMappingFile = &rawOptions.refreshMappingFile
+	}
+	if flagSet.Changed("keep-files") {
+		options.KeepFiles = &rawOptions.keepFiles
+	}
+	if options.MaxBandwidth, err = bandwidth.ParseRate(rawOptions.maxBandwidth); err != nil {
+		return options, err
+	}
+	if options.BandwidthSchedule, err = bandwidth.ParseScheduledRates(rawOptions.bandwidthSchedule); err != nil {
+		return options, err
+	}
+	if options.Speed, err = bandwidth.ParseRate(rawOptions.speed); err != nil {
+		return options, err
+	}
+	if options.DownloadWindow, err = parseWindowIfDefined(rawOptions.downloadWindow); err != nil {
+		return options, err
+	}
+	if options.RetrievalWindow, err = parseWindowIfDefined(rawOptions.retrievalWindow); err != nil {
+		return options, err
+	}
+	overrideConfiguredOptions(&options, commandLineFlags)
+	if err = checkOptions(options, command, commandLineFlags); err != nil {
+		return options, err
 	}
 
 	awsIdTruncated := ""
@@ -59,6 +175,20 @@ func ParseOptions() Options {
 	outputs.OptionalInfoFlag = options.InfoMessage
 	outputs.Printfln(outputs.Verbose, "Options aws-id: %v", awsIdTruncated)
 	outputs.Printfln(outputs.Verbose, "Options aws-secret: %v", awsSecretTruncated)
+	outputs.Printfln(outputs.Verbose, "Options aws-profile: %v", options.AwsProfile)
+	outputs.Printfln(outputs.Verbose, "Options config: %v", options.ConfigPath)
+	outputs.Printfln(outputs.Verbose, "Options profile-name: %v", options.ProfileName)
+	outputs.Printfln(outputs.Verbose, "Options answers: %v", options.AnswersPath)
+	outputs.Printfln(outputs.Verbose, "Options no-prompt: %v", options.NoPrompt)
+	outputs.Printfln(outputs.Verbose, "Options hook-command: %v", options.HookCommands)
+	outputs.Printfln(outputs.Verbose, "Options webhook: %v", len(options.Webhooks))
+	outputs.Printfln(outputs.Verbose, "Options webhook-retries: %v", options.WebhookRetries)
+	outputs.Printfln(outputs.Verbose, "Options hook-event: %v", options.HookEvents)
+	outputs.Printfln(outputs.Verbose, "Options smtp-server: %v", options.Mail.Server)
+	outputs.Printfln(outputs.Verbose, "Options smtp-security: %v", options.Mail.Security)
+	outputs.Printfln(outputs.Verbose, "Options smtp-user: %v", options.Mail.User)
+	outputs.Printfln(outputs.Verbose, "Options mail-from: %v", options.Mail.From)
+	outputs.Printfln(outputs.Verbose, "Options mail-to: %v", options.Mail.To)
 	outputs.Printfln(outputs.Verbose, "Options destination: %v", options.Dest)
 	outputs.Printfln(outputs.Verbose, "Options filters: %v", options.Filters)
 	if options.KeepFiles != nil {
@@ -66,17 +196,144 @@ func ParseOptions() Options {
 	} else {
 		outputs.Println(outputs.Verbose, "Options keep-files: nil", )
 	}
-	outputs.Printfln(outputs.Verbose, "Options list: %v", options.List)
-	outputs.Printfln(outputs.Verbose, "Options list jobs: %v", options.ListJobs)
+	outputs.Printfln(outputs.Verbose, "Options max-bandwidth: %v", options.MaxBandwidth)
+	outputs.Printfln(outputs.Verbose, "Options bandwidth-schedule: %v", options.BandwidthSchedule)
+	outputs.Printfln(outputs.Verbose, "Options download-window: %v", options.DownloadWindow)
+	outputs.Printfln(outputs.Verbose, "Options retrieval-window: %v", options.RetrievalWindow)
+	outputs.Printfln(outputs.Verbose, "Options speed: %v", options.Speed)
+	outputs.Printfln(outputs.Verbose, "Options speed-test-url: %v", options.SpeedTestUrl)
+	outputs.Printfln(outputs.Verbose, "Options speed-test-mode: %v", options.SpeedTestMode)
+	outputs.Printfln(outputs.Verbose, "Options job-retries: %v", options.JobRetries)
 	outputs.Printfln(outputs.Verbose, "Options info-messages: %v", options.InfoMessage)
 	if options.RefreshMappingFile != nil {
 		outputs.Printfln(outputs.Verbose, "Options refresh-mapping-file: %v", *options.RefreshMappingFile)
 	} else {
 		outputs.Println(outputs.Verbose, "Options refresh-mapping-file: nil", )
 	}
+	outputs.Printfln(outputs.Verbose, "Options mapping-archive: %v", options.MappingArchive)
 	outputs.Printfln(outputs.Verbose, "Options region: %v", options.Region)
-	outputs.Printfln(outputs.Verbose, "Options vault: %v", options.Vault)
+	outputs.Printfln(outputs.Verbose, "Options regions: %v", options.Regions)
+	outputs.Printfln(outputs.Verbose, "Options vaults-cache-ttl: %v", options.VaultsCacheTtl)
+	outputs.Printfln(outputs.Verbose, "Options refresh-vaults: %v", options.RefreshVaults)
+	outputs.Printfln(outputs.Verbose, "Options refresh-inventory: %v", options.RefreshInventory)
+	outputs.Printfln(outputs.Verbose, "Options status: %v", options.JobStatuses)
+	outputs.Printfln(outputs.Verbose, "Options action: %v", options.JobActions)
+	outputs.Printfln(outputs.Verbose, "Options max-age: %v", options.JobMaxAge)
+	outputs.Printfln(outputs.Verbose, "Options output: %v", options.Output)
+	outputs.Printfln(outputs.Verbose, "Options older-than: %v", options.OlderThan)
+	outputs.Printfln(outputs.Verbose, "Options work-dir: %v", options.WorkDir)
+	outputs.Printfln(outputs.Verbose, "Options account-id: %v", options.AccountId)
+	outputs.Printfln(outputs.Verbose, "Options vault: %v", options.Vaults)
+	outputs.Printfln(outputs.Verbose, "Options all-vaults: %v", options.AllVaults)
 	outputs.Printfln(outputs.Verbose, "Options verbose: %v", options.Verbose)
+	outputs.Printfln(outputs.Verbose, "Options command: %v %v", options.Command, options.CommandArgs)
 	outputs.Printfln(outputs.Verbose, "Options version: %v", options.Version)
-	return options
-}
\ No newline at end of file
+	return options, nil
+}
+
+func parseWindowIfDefined(value string) (*schedule.Window, error) {
+	if value == "" {
+		return nil, nil
+	}
+	window, err := schedule.ParseWindow(value)
+	if err != nil {
+		return nil, err
+	}
+	return &window, nil
+}
+
+func displayHelp(arguments []string) {
+	if len(arguments) > 0 {
+		if command := findCommand(arguments[0]); command != nil {
+			outputs.Println(outputs.Info, commandUsage(command))
+			os.Exit(0)
+		}
+	}
+	outputs.Println(outputs.Info, usage())
+	os.Exit(0)
+}
+
+func checkCommandArgs(command *command, commandArgs []string) error {
+	if len(command.arguments) == 0 {
+		if len(commandArgs) > 0 {
+			return errors.New(fmt.Sprintf("Unexpected argument for command %s: %s", command.name, strings.Join(commandArgs, " ")))
+		}
+		return nil
+	}
+	if len(commandArgs) == 0 || !utils.Contains(command.arguments, commandArgs[0]) {
+		return errors.New(fmt.Sprintf("Command %s expects one argument: %s", command.name, strings.Join(command.arguments, ", ")))
+	}
+	if valueName, ok := command.argumentValues[commandArgs[0]]; ok {
+		if len(commandArgs) != 2 {
+			return errors.New(fmt.Sprintf("Command %s %s expects %s", command.name, commandArgs[0], valueName))
+		}
+	} else if len(commandArgs) > 1 {
+		return errors.New(fmt.Sprintf("Unexpected argument for command %s %s: %s", command.name, commandArgs[0], strings.Join(commandArgs[1:], " ")))
+	}
+	return nil
+}
+
+// an option of the command line replaces a configured option which cannot be used with it
+func overrideConfiguredOptions(options *Options, commandLineFlags map[string]bool) {
+	if options.AllVaults && len(options.Vaults) > 0 {
+		if commandLineFlags["all-vaults"] && !commandLineFlags["vault"] {
+			options.Vaults = []string{}
+		} else if commandLineFlags["vault"] && !commandLineFlags["all-vaults"] {
+			options.AllVaults = false
+		}
+	}
+	if options.Speed != 0 && !commandLineFlags["speed"] && (commandLineFlags["speed-test-url"] || commandLineFlags["speed-test-mode"]) {
+		options.Speed = 0
+	}
+}
+
+// reject combinations of options which would ignore one of them
+func checkOptions(options Options, command *command, commandLineFlags map[string]bool) error {
+	if options.AllVaults && len(options.Vaults) > 0 {
+		return errors.New("--all-vaults and --vault cannot be used together")
+	}
+	if options.SpeedTestMode != "" && options.SpeedTestMode != SPEED_TEST_WEB && options.SpeedTestMode != SPEED_TEST_GLACIER {
+		return errors.New("Speed test mode must be \"" + SPEED_TEST_WEB + "\" or \"" + SPEED_TEST_GLACIER + "\"")
+	}
+	if options.Speed != 0 && (commandLineFlags["speed-test-url"] || commandLineFlags["speed-test-mode"]) {
+		return errors.New("--speed skips the speed test, it cannot be used with --speed-test-url or --speed-test-mode")
+	}
+	if options.SpeedTestMode == SPEED_TEST_GLACIER && commandLineFlags["speed-test-url"] {
+		return errors.New("--speed-test-url cannot be used with --speed-test-mode glacier")
+	}
+	if options.Output != "" && options.Output != OUTPUT_TABLE && options.Output != OUTPUT_JSON {
+		return errors.New("Output must be \"" + OUTPUT_TABLE + "\" or \"" + OUTPUT_JSON + "\"")
+	}
+	for _, event := range options.HookEvents {
+		if !hooks.IsEventName(event) {
+			return errors.New("Unknown hook event " + event + ", events: " + strings.Join(hooks.EventNames, ", "))
+		}
+	}
+	if len(options.Mail.To) > 0 && options.Mail.Server == "" {
+		return errors.New("--mail-to needs --smtp-server")
+	}
+	if !utils.Contains(hooks.SmtpSecurities, options.Mail.Security) {
+		return errors.New("SMTP security must be " + strings.Join(hooks.SmtpSecurities, ", "))
+	}
+	if options.WebhookRetries < 0 {
+		return errors.New("--webhook-retries cannot be negative")
+	}
+	if options.JobRetries < 0 {
+		return errors.New("--job-retries cannot be negative")
+	}
+	for _, flagName := range sortedFlagNames(command.argumentFlags) {
+		if commandLineFlags[flagName] && !command.appliesFlag(flagName, options.CommandArgs) {
+			return errors.New(fmt.Sprintf("--%s can only be used with \"rsg %s %s\"", flagName, command.name, command.argumentFlags[flagName]))
+		}
+	}
+	return nil
+}
+
+func sortedFlagNames(argumentFlags map[string]string) []string {
+	flagNames := []string{}
+	for flagName := range argumentFlags {
+		flagNames = append(flagNames, flagName)
+	}
+	sort.Strings(flagNames)
+	return flagNames
+}
@@ -0,0 +1,229 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+	"rsg/outputs"
+)
+
+var testConfigPath = ""
+
+// the configuration file of the user is never read by tests
+func initTestConfig(content string) {
+	outputs.InitDefaultOutputs()
+	if testConfigPath == "" {
+		configFile, _ := ioutil.TempFile("", "rsg-config")
+		configFile.Close()
+		testConfigPath = configFile.Name()
+	}
+	ioutil.WriteFile(testConfigPath, []byte(content), 0600)
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	os.Remove(testConfigPath)
+	os.Exit(code)
+}
+
+func parseTestArguments(arguments ...string) (Options, error) {
+	return parseArguments(append(arguments, "--config", testConfigPath))
+}
+
+func TestParseArguments_commands_and_their_flags(t *testing.T) {
+	tests := []struct {
+		arguments   []string
+		command     string
+		commandArgs []string
+		check       func(options Options)
+	}{
+		{[]string{"--vault", "vault", "-d", "/dest"}, COMMAND_RESTORE, []string{}, func(options Options) {
+			assert.Equal(t, []string{"vault"}, options.Vaults)
+			assert.Equal(t, "/dest", options.Dest)
+		}},
+		{[]string{"restore", "--max-bandwidth", "1M", "--download-window", "22:00-07:00"}, COMMAND_RESTORE, []string{}, func(options Options) {
+			assert.Equal(t, uint64(1024 * 1024), options.MaxBandwidth)
+			assert.Equal(t, "22:00-07:00", options.DownloadWindow.String())
+			assert.Nil(t, options.RetrievalWindow)
+			assert.Equal(t, 2, options.JobRetries)
+		}},
+		{[]string{"restore", "--refresh-mapping-file=false"}, COMMAND_RESTORE, []string{}, func(options Options) {
+			assert.False(t, *options.RefreshMappingFile)
+			assert.Nil(t, options.KeepFiles)
+		}},
+		{[]string{"ls", "-f", "photos/*", "-r", "eu-west-1"}, COMMAND_LS, []string{}, func(options Options) {
+			assert.Equal(t, []string{"photos/*"}, options.Filters)
+			assert.Equal(t, "eu-west-1", options.Region)
+		}},
+		{[]string{"jobs", "--status", "Failed", "--max-age", "24h", "-o", "json"}, COMMAND_JOBS, []string{}, func(options Options) {
+			assert.Equal(t, []string{"Failed"}, options.JobStatuses)
+			assert.Equal(t, 24 * time.Hour, options.JobMaxAge)
+			assert.Equal(t, OUTPUT_JSON, options.Output)
+		}},
+		{[]string{"vaults", "--all-vaults"}, COMMAND_VAULTS, []string{}, func(options Options) {
+			assert.True(t, options.AllVaults)
+		}},
+		{[]string{"estimate", "--speed", "512K"}, COMMAND_ESTIMATE, []string{}, func(options Options) {
+			assert.Equal(t, uint64(512 * 1024), options.Speed)
+		}},
+		{[]string{"verify", "-d", "/dest", "-f", "photos/*"}, COMMAND_VERIFY, []string{}, func(options Options) {
+			assert.Equal(t, "/dest", options.Dest)
+		}},
+		{[]string{"audit", "--refresh-inventory"}, COMMAND_AUDIT, []string{}, func(options Options) {
+			assert.True(t, options.RefreshInventory)
+		}},
+		{[]string{"cache", "prune", "--older-than", "720h"}, COMMAND_CACHE, []string{"prune"}, func(options Options) {
+			assert.Equal(t, 720 * time.Hour, options.OlderThan)
+		}},
+		{[]string{"completion", "zsh"}, COMMAND_COMPLETION, []string{"zsh"}, nil},
+		{[]string{"ctl", "submit", "-d", "/dest"}, COMMAND_CTL, []string{"submit"}, func(options Options) {
+			assert.Equal(t, "/dest", options.Dest)
+		}},
+		{[]string{"ctl", "cancel", "3"}, COMMAND_CTL, []string{"cancel", "3"}, nil},
+		{[]string{"config", "show", "--speed", "1M", "--older-than", "1h"}, COMMAND_CONFIG, []string{"show"}, func(options Options) {
+			assert.NotEmpty(t, options.Settings)
+		}},
+		{[]string{"__complete", "restore", "--vau"}, COMMAND_COMPLETE, []string{"restore", "--vau"}, nil},
+	}
+	for _, test := range tests {
+		// Given
+		initTestConfig("")
+
+		// When
+		options, err := parseTestArguments(test.arguments...)
+
+		// Then
+		if !assert.NoError(t, err, "%v", test.arguments) {
+			continue
+		}
+		assert.Equal(t, test.command, options.Command, "%v", test.arguments)
+		if test.command != COMMAND_COMPLETE {
+			assert.Equal(t, test.commandArgs, options.CommandArgs, "%v", test.arguments)
+		}
+		if test.check != nil {
+			test.check(options)
+		}
+	}
+}
+
+func TestParseArguments_legacy_flat_flags(t *testing.T) {
+	tests := []struct {
+		arguments []string
+		command   string
+	}{
+		{[]string{"--vault", "vault"}, COMMAND_RESTORE},
+		{[]string{"--list", "--vault", "vault"}, COMMAND_LS},
+		{[]string{"-l"}, COMMAND_LS},
+		{[]string{"--list-jobs"}, COMMAND_JOBS},
+		{[]string{"--list=false"}, COMMAND_RESTORE},
+	}
+	for _, test := range tests {
+		// Given
+		initTestConfig("")
+
+		// When
+		options, err := parseTestArguments(test.arguments...)
+
+		// Then
+		assert.NoError(t, err, "%v", test.arguments)
+		assert.Equal(t, test.command, options.Command, "%v", test.arguments)
+	}
+}
+
+func TestParseArguments_errors(t *testing.T) {
+	tests := []struct {
+		arguments []string
+		err       string
+	}{
+		{[]string{"unknown"}, "Unknown command: unknown, use \"rsg help\" to list commands"},
+		{[]string{"ls", "--destination", "/dest"}, "unknown flag: --destination, use \"rsg help ls\" to list its options"},
+		{[]string{"vaults", "--filter", "photos/*"}, "unknown flag: --filter, use \"rsg help vaults\" to list its options"},
+		{[]string{"jobs", "--max-bandwidth", "1M"}, "unknown flag: --max-bandwidth, use \"rsg help jobs\" to list its options"},
+		{[]string{"restore", "--job-retries", "many"}, "invalid argument \"many\" for --job-retries: strconv.ParseInt: parsing \"many\": invalid syntax, use \"rsg help restore\" to list its options"},
+		{[]string{"vaults", "extra"}, "Unexpected argument for command vaults: extra"},
+		{[]string{"cache"}, "Command cache expects one argument: list, show, clean, prune"},
+		{[]string{"cache", "remove"}, "Command cache expects one argument: list, show, clean, prune"},
+		{[]string{"cache", "list", "extra"}, "Unexpected argument for command cache list: extra"},
+		{[]string{"ctl", "pause"}, "Command ctl pause expects id"},
+		{[]string{"ctl", "pause", "1", "2"}, "Command ctl pause expects id"},
+		{[]string{"--list", "--list-jobs"}, "--list and --list-jobs cannot be used together"},
+		{[]string{"--all-vaults", "--vault", "vault"}, "--all-vaults and --vault cannot be used together"},
+		{[]string{"--speed", "1M", "--speed-test-url", "http://host/file"}, "--speed skips the speed test, it cannot be used with --speed-test-url or --speed-test-mode"},
+		{[]string{"--speed-test-mode", "glacier", "--speed-test-url", "http://host/file"}, "--speed-test-url cannot be used with --speed-test-mode glacier"},
+		{[]string{"--speed-test-mode", "disk"}, "Speed test mode must be \"web\" or \"glacier\""},
+		{[]string{"jobs", "-o", "xml"}, "Output must be \"table\" or \"json\""},
+		{[]string{"--hook-event", "unknown"}, "Unknown hook event unknown, events: mapping-downloaded, job-started, job-ready, archive-restored, archive-skipped, restore-finished, fatal-error"},
+		{[]string{"--mail-to", "me@host"}, "--mail-to needs --smtp-server"},
+		{[]string{"--webhook-retries", "-1"}, "--webhook-retries cannot be negative"},
+		{[]string{"--job-retries", "-1"}, "--job-retries cannot be negative"},
+		{[]string{"--download-window", "22:00"}, "Invalid time window 22:00, expected format is 22:00-07:00"},
+		{[]string{"--bandwidth-schedule", "22:00-07:00"}, "Invalid bandwidth schedule 22:00-07:00, expected format is 08:00-18:00=2M"},
+		{[]string{"ctl", "list", "-d", "/dest"}, "--destination can only be used with \"rsg ctl submit\""},
+		{[]string{"ctl", "pause", "1", "-f", "photos/*"}, "--filter can only be used with \"rsg ctl submit\""},
+		{[]string{"cache", "list", "--older-than", "1h"}, "--older-than can only be used with \"rsg cache prune\""},
+	}
+	for _, test := range tests {
+		// Given
+		initTestConfig("")
+
+		// When
+		_, err := parseTestArguments(test.arguments...)
+
+		// Then
+		assert.EqualError(t, err, test.err, "%v", test.arguments)
+	}
+}
+
+func TestCommandFlags_global_and_command_flags_without_deprecated_ones(t *testing.T) {
+	tests := []struct {
+		command  string
+		accepted []string
+		rejected []string
+	}{
+		{COMMAND_RESTORE, []string{"--vault", "-v", "--destination", "-d", "--job-retries", "--max-bandwidth"}, []string{"--list", "-l", "--list-jobs", "--status"}},
+		{COMMAND_LS, []string{"--vault", "--filter", "-f", "--mapping-archive"}, []string{"--destination", "--max-bandwidth"}},
+		{COMMAND_JOBS, []string{"--status", "--action", "--max-age", "--output", "-o"}, []string{"--filter", "--destination"}},
+		{COMMAND_VAULTS, []string{"--region", "--all-vaults"}, []string{"--filter", "--output"}},
+		{COMMAND_VERIFY, []string{"--destination", "--filter"}, []string{"--refresh-mapping-file"}},
+		{COMMAND_CACHE, []string{"--older-than"}, []string{"--destination"}},
+		{COMMAND_CTL, []string{"--destination", "--filter", "--output"}, []string{"--speed"}},
+		{COMMAND_CONFIG, []string{"--destination", "--speed", "--status", "--older-than"}, []string{"--list"}},
+		{"unknown", []string{}, []string{"--vault"}},
+	}
+	for _, test := range tests {
+		// When
+		flags := CommandFlags(test.command)
+
+		// Then
+		for _, flag := range test.accepted {
+			assert.Contains(t, flags, flag, "%s accepts %s", test.command, flag)
+		}
+		for _, flag := range test.rejected {
+			assert.NotContains(t, flags, flag, "%s rejects %s", test.command, flag)
+		}
+	}
+}
+
+func TestFlagExpectingValue(t *testing.T) {
+	tests := []struct {
+		command string
+		flag    string
+		name    string
+	}{
+		{COMMAND_RESTORE, "--destination", "destination"},
+		{COMMAND_RESTORE, "-d", "destination"},
+		{COMMAND_RESTORE, "--verbose", ""},
+		{COMMAND_LS, "--destination", ""},
+		{COMMAND_JOBS, "-o", "output"},
+		{"unknown", "--vault", ""},
+	}
+	for _, test := range tests {
+		// When
+		name := FlagExpectingValue(test.command, test.flag)
+
+		// Then
+		assert.Equal(t, test.name, name, "%s %s", test.command, test.flag)
+	}
+}
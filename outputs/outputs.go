@@ -5,6 +5,7 @@ import (
 	"io"
 	"fmt"
 	"rsg/consts"
+	"sync"
 )
 
 const (
@@ -25,6 +26,7 @@ var (
 	infoWriter io.Writer
 	warningWriter io.Writer
 	errorWriter io.Writer
+	mutex sync.Mutex
 )
 
 func InitDefaultOutputs() {
@@ -79,5 +81,7 @@ func print(level Level, toPrint string) {
 		writer = errorWriter
 		toPrint = "ERROR: " + toPrint;
 	}
+	mutex.Lock()
+	defer mutex.Unlock()
 	fmt.Fprint(writer, toPrint)
 }
@@ -0,0 +1,113 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Time of day windows like "22:00-07:00", a window can span midnight
+
+const day = 24 * time.Hour
+
+type Window struct {
+	Start time.Duration // offset from midnight
+	End   time.Duration // offset from midnight
+}
+
+func ParseWindow(value string) (Window, error) {
+	bounds := strings.Split(value, "-")
+	if len(bounds) != 2 {
+		return Window{}, errors.New(fmt.Sprintf("Invalid time window %s, expected format is 22:00-07:00", value))
+	}
+	start, err := parseTimeOfDay(bounds[0])
+	if err != nil {
+		return Window{}, err
+	}
+	end, err := parseTimeOfDay(bounds[1])
+	if err != nil {
+		return Window{}, err
+	}
+	return Window{Start: start, End: end}, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	timeOfDay, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid time of day %s, expected format is 15:04", value))
+	}
+	return time.Duration(timeOfDay.Hour()) * time.Hour + time.Duration(timeOfDay.Minute()) * time.Minute, nil
+}
+
+func (window Window) String() string {
+	return formatTimeOfDay(window.Start) + "-" + formatTimeOfDay(window.End)
+}
+
+func formatTimeOfDay(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset / time.Hour), int((offset % time.Hour) / time.Minute))
+}
+
+// a window with same start and end is open all the day
+func (window Window) isAllDay() bool {
+	return window.Start == window.End
+}
+
+func (window Window) Contains(date time.Time) bool {
+	if window.isAllDay() {
+		return true
+	}
+	offset := offsetInDay(date)
+	if window.Start < window.End {
+		return offset >= window.Start && offset < window.End
+	}
+	return offset >= window.Start || offset < window.End
+}
+
+// start of the window if date is outside, date otherwise
+func (window Window) NextStart(date time.Time) time.Time {
+	if window.Contains(date) {
+		return date
+	}
+	start := midnight(date).Add(window.Start)
+	if start.Before(date) {
+		start = start.Add(day)
+	}
+	return start
+}
+
+// duration while the window is open between two dates
+func (window Window) OpenDuration(from, to time.Time) time.Duration {
+	if !to.After(from) {
+		return 0
+	}
+	if window.isAllDay() {
+		return to.Sub(from)
+	}
+	openDuration := time.Duration(0)
+	for dayStart := midnight(from).Add(-day); dayStart.Before(to); dayStart = dayStart.Add(day) {
+		start := dayStart.Add(window.Start)
+		end := dayStart.Add(window.End)
+		if window.End < window.Start {
+			end = end.Add(day)
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			openDuration += end.Sub(start)
+		}
+	}
+	return openDuration
+}
+
+func offsetInDay(date time.Time) time.Duration {
+	return date.Sub(midnight(date))
+}
+
+func midnight(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+}
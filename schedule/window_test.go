@@ -0,0 +1,149 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	"github.com/stretchr/testify/assert"
+)
+
+func at(hour, minute int) time.Time {
+	return time.Date(2016, 6, 15, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		value  string
+		window Window
+		err    string
+	}{
+		{"08:00-18:00", Window{Start: 8 * time.Hour, End: 18 * time.Hour}, ""},
+		{"22:30-07:15", Window{Start: 22 * time.Hour + 30 * time.Minute, End: 7 * time.Hour + 15 * time.Minute}, ""},
+		{" 00:00 - 00:00 ", Window{}, ""},
+		{"08:00", Window{}, "Invalid time window 08:00, expected format is 22:00-07:00"},
+		{"08:00-18:00-20:00", Window{}, "Invalid time window 08:00-18:00-20:00, expected format is 22:00-07:00"},
+		{"08:00-25:00", Window{}, "Invalid time of day 25:00, expected format is 15:04"},
+		{"8h-18h", Window{}, "Invalid time of day 8h, expected format is 15:04"},
+	}
+	for _, test := range tests {
+		// When
+		window, err := ParseWindow(test.value)
+
+		// Then
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.value)
+			continue
+		}
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.window, window, test.value)
+	}
+}
+
+func TestWindow_String(t *testing.T) {
+	// Given
+	window := Window{Start: 22 * time.Hour + 30 * time.Minute, End: 7 * time.Hour}
+
+	// When
+	value := window.String()
+
+	// Then
+	assert.Equal(t, "22:30-07:00", value)
+}
+
+func TestWindow_Contains(t *testing.T) {
+	tests := []struct {
+		window   string
+		date     time.Time
+		contains bool
+	}{
+		{"08:00-18:00", at(8, 0), true},
+		{"08:00-18:00", at(12, 0), true},
+		{"08:00-18:00", at(17, 59), true},
+		{"08:00-18:00", at(18, 0), false},
+		{"08:00-18:00", at(7, 59), false},
+		// wraps past midnight
+		{"22:00-07:00", at(22, 0), true},
+		{"22:00-07:00", at(23, 59), true},
+		{"22:00-07:00", at(0, 0), true},
+		{"22:00-07:00", at(6, 59), true},
+		{"22:00-07:00", at(7, 0), false},
+		{"22:00-07:00", at(12, 0), false},
+		// whole day
+		{"00:00-00:00", at(0, 0), true},
+		{"13:00-13:00", at(12, 0), true},
+		{"13:00-13:00", at(23, 59), true},
+	}
+	for _, test := range tests {
+		// Given
+		window, err := ParseWindow(test.window)
+		assert.NoError(t, err)
+
+		// When
+		contains := window.Contains(test.date)
+
+		// Then
+		assert.Equal(t, test.contains, contains, "%s contains %s", test.window, test.date)
+	}
+}
+
+func TestWindow_NextStart(t *testing.T) {
+	tests := []struct {
+		window    string
+		date      time.Time
+		nextStart time.Time
+	}{
+		{"08:00-18:00", at(6, 0), at(8, 0)},
+		{"08:00-18:00", at(12, 0), at(12, 0)},
+		{"08:00-18:00", at(18, 0), at(8, 0).Add(day)},
+		{"22:00-07:00", at(12, 0), at(22, 0)},
+		{"22:00-07:00", at(23, 0), at(23, 0)},
+		{"22:00-07:00", at(3, 0), at(3, 0)},
+		{"22:00-07:00", at(7, 0), at(22, 0)},
+		{"00:00-00:00", at(12, 0), at(12, 0)},
+	}
+	for _, test := range tests {
+		// Given
+		window, err := ParseWindow(test.window)
+		assert.NoError(t, err)
+
+		// When
+		nextStart := window.NextStart(test.date)
+
+		// Then
+		assert.Equal(t, test.nextStart, nextStart, "next start of %s from %s", test.window, test.date)
+	}
+}
+
+func TestWindow_OpenDuration(t *testing.T) {
+	tests := []struct {
+		window       string
+		from         time.Time
+		to           time.Time
+		openDuration time.Duration
+	}{
+		{"08:00-18:00", at(6, 0), at(12, 0), 4 * time.Hour},
+		{"08:00-18:00", at(9, 0), at(10, 30), 90 * time.Minute},
+		{"08:00-18:00", at(19, 0), at(7, 0).Add(day), 0},
+		{"08:00-18:00", at(12, 0), at(12, 0).Add(day), 10 * time.Hour},
+		{"08:00-18:00", at(0, 0), at(0, 0).Add(3 * day), 30 * time.Hour},
+		// wraps past midnight
+		{"22:00-07:00", at(12, 0), at(12, 0).Add(day), 9 * time.Hour},
+		{"22:00-07:00", at(3, 0), at(23, 0), 5 * time.Hour},
+		{"22:00-07:00", at(23, 0), at(1, 0).Add(day), 2 * time.Hour},
+		// whole day
+		{"00:00-00:00", at(6, 0), at(12, 0).Add(day), 30 * time.Hour},
+		// empty period
+		{"08:00-18:00", at(12, 0), at(12, 0), 0},
+		{"08:00-18:00", at(12, 0), at(10, 0), 0},
+	}
+	for _, test := range tests {
+		// Given
+		window, err := ParseWindow(test.window)
+		assert.NoError(t, err)
+
+		// When
+		openDuration := window.OpenDuration(test.from, test.to)
+
+		// Then
+		assert.Equal(t, test.openDuration, openDuration, "%s open from %s to %s", test.window, test.from, test.to)
+	}
+}
@@ -3,49 +3,64 @@ package speedtest
 import (
 	"rsg/outputs"
 	"net/http"
+	"io"
 	"io/ioutil"
 	"regexp"
 	"time"
 	"errors"
 )
 
-func SpeedTest() (uint64, error) {
-	resp, err := http.Get("https://golang.org/dl/")
+// Measure download speed on a test url, by default on the last go source archive
+
+const DefaultTestPage = "https://golang.org/dl/"
+
+func SpeedTest(testUrl string) (uint64, error) {
+	if testUrl == "" {
+		var err error
+		testUrl, err = findDefaultTestLink()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return measureDownloadSpeed(testUrl)
+}
+
+func findDefaultTestLink() (string, error) {
+	resp, err := http.Get(DefaultTestPage)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
+	defer resp.Body.Close()
 	content, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 	re := regexp.MustCompile("href=\"(.+src.tar.gz)\"")
 	submatches := re.FindStringSubmatch(string(content))
-	if len(submatches) > 1 {
-		link := submatches[1]
-		if link != "" {
-			outputs.Printfln(outputs.Verbose, "Start download speed test on %v", link)
-			resp, err = http.Get(link)
-			if err != nil {
-				return 0, err
-			}
-			start := time.Now()
-			content, err = ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return 0, err
-			}
-			downloadSize := uint64(len(content))
-			downloadDuration := time.Since(start)
-			if downloadDuration.Seconds() == 0 {
-				return downloadSize, nil;
-			} else {
-				return downloadSize / uint64(downloadDuration.Seconds()), nil
-			}
-		}
+	if len(submatches) > 1 && submatches[1] != "" {
+		return submatches[1], nil
 	}
-	return 0, errors.New("No test link found")
+	return "", errors.New("No test link found")
 }
 
-
-
-
-
+func measureDownloadSpeed(link string) (uint64, error) {
+	outputs.Printfln(outputs.Verbose, "Start download speed test on %v", link)
+	resp, err := http.Get(link)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.New("Speed test on " + link + " failed: " + resp.Status)
+	}
+	start := time.Now()
+	downloadSize, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	downloadDuration := time.Since(start)
+	if downloadDuration.Seconds() == 0 {
+		return uint64(downloadSize), nil
+	}
+	return uint64(float64(downloadSize) / downloadDuration.Seconds()), nil
+}
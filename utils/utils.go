@@ -4,6 +4,8 @@ import "os"
 import (
 	"rsg/outputs"
 	"io"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"errors"
 )
@@ -11,9 +13,13 @@ import (
 const S_1MB = 1024 * 1024
 const S_1GB = 1024 * S_1MB
 
+// called before exiting on an error, to fire the hooks
+var OnFatalError = func(err error) {}
+
 func ExitIfError(err error) {
 	if (err != nil) {
 		outputs.Printfln(outputs.Error, "%v", translateAwsErrors(err))
+		OnFatalError(translateAwsErrors(err))
 		os.Exit(1)
 	}
 }
@@ -64,6 +70,30 @@ func Exists(path string) bool {
 	}
 }
 
+// write a temporary file in the same directory then rename it, so a reader never gets a partial file
+func WriteFileAtomically(path string, data []byte, perm os.FileMode) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path) + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmpFile.Write(data); err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+	return err
+}
+
 func CheckingClose(c io.Closer, previousError *error) {
 	err := c.Close()
 	if previousError == nil {